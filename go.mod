@@ -1,9 +1,10 @@
 module sparse
 
-go 1.22.0
+go 1.23.0
 
 require (
-	github.com/google/go-cmp v0.6.0 // indirect
-	github.com/google/uuid v1.6.0 // indirect
-	github.com/shoenig/test v1.7.1 // indirect
+	github.com/google/uuid v1.6.0
+	github.com/shoenig/test v1.7.1
 )
+
+require github.com/google/go-cmp v0.6.0 // indirect
@@ -0,0 +1,239 @@
+// Package charclass implements sets of runes, such as [a-z], \p{Greek} or
+// [:alpha:], for use by the matchers in sparse and speg.
+//
+// A Class is stored as a sorted list of disjoint ranges, plus a bitset for
+// ASCII so that the common case is a single bit test.
+package charclass
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// A Range is an inclusive range of runes.
+type Range struct {
+	Lo, Hi rune
+}
+
+// A Class is an immutable set of runes. The zero value is the empty set.
+type Class struct {
+	ascii  [2]uint64
+	ranges []Range
+}
+
+// New returns the class that contains the runes in each of ranges.
+func New(ranges ...Range) Class {
+	return normalize(append([]Range(nil), ranges...))
+}
+
+// Runes returns the class that contains the runes of s.
+func Runes(s string) Class {
+	var ranges []Range
+	for _, r := range s {
+		ranges = append(ranges, Range{r, r})
+	}
+	return normalize(ranges)
+}
+
+// Between returns the class of runes r with lo <= r <= hi.
+func Between(lo, hi rune) Class {
+	return New(Range{lo, hi})
+}
+
+// Table returns the class of runes in a unicode.RangeTable, such as
+// unicode.Greek or unicode.Lu.
+func Table(table *unicode.RangeTable) Class {
+	var ranges []Range
+	for _, r16 := range table.R16 {
+		ranges = appendStrided(ranges, rune(r16.Lo), rune(r16.Hi), rune(r16.Stride))
+	}
+	for _, r32 := range table.R32 {
+		ranges = appendStrided(ranges, rune(r32.Lo), rune(r32.Hi), rune(r32.Stride))
+	}
+	return normalize(ranges)
+}
+
+func appendStrided(ranges []Range, lo, hi, stride rune) []Range {
+	if stride == 1 {
+		return append(ranges, Range{lo, hi})
+	}
+	for r := lo; r <= hi; r += stride {
+		ranges = append(ranges, Range{r, r})
+	}
+	return ranges
+}
+
+// normalize sorts and merges ranges, which it may modify, and builds the
+// ASCII bitset.
+func normalize(ranges []Range) Class {
+	sort.Slice(ranges, func(i, j int) bool {
+		return ranges[i].Lo < ranges[j].Lo
+	})
+	var merged []Range
+	for _, r := range ranges {
+		if r.Lo > r.Hi {
+			continue
+		}
+		if n := len(merged); n > 0 && r.Lo <= merged[n-1].Hi+1 {
+			merged[n-1].Hi = max(merged[n-1].Hi, r.Hi)
+			continue
+		}
+		merged = append(merged, r)
+	}
+	c := Class{ranges: merged}
+	for _, r := range merged {
+		if r.Lo >= 128 {
+			break
+		}
+		for x := r.Lo; x <= min(r.Hi, 127); x++ {
+			c.ascii[x/64] |= 1 << (x % 64)
+		}
+	}
+	return c
+}
+
+// Contains reports whether r is in c.
+func (c Class) Contains(r rune) bool {
+	if r >= 0 && r < 128 {
+		return c.ascii[r/64]&(1<<(r%64)) != 0
+	}
+	k := sort.Search(len(c.ranges), func(k int) bool {
+		return c.ranges[k].Hi >= r
+	})
+	return k < len(c.ranges) && c.ranges[k].Lo <= r
+}
+
+// Ranges returns the ranges that make up c, sorted and disjoint.
+func (c Class) Ranges() []Range {
+	return append([]Range(nil), c.ranges...)
+}
+
+// IsEmpty reports whether c contains no runes.
+func (c Class) IsEmpty() bool {
+	return len(c.ranges) == 0
+}
+
+// Union returns the class of runes that are in c or any of others.
+func (c Class) Union(others ...Class) Class {
+	ranges := append([]Range(nil), c.ranges...)
+	for _, other := range others {
+		ranges = append(ranges, other.ranges...)
+	}
+	return normalize(ranges)
+}
+
+// Negate returns the class of valid runes that are not in c.
+func (c Class) Negate() Class {
+	var ranges []Range
+	next := rune(0)
+	for _, r := range c.ranges {
+		if r.Lo > next {
+			ranges = append(ranges, Range{next, r.Lo - 1})
+		}
+		next = r.Hi + 1
+	}
+	if next <= unicode.MaxRune {
+		ranges = append(ranges, Range{next, unicode.MaxRune})
+	}
+	return normalize(ranges).Intersect(valid)
+}
+
+// valid contains every rune except the surrogate halves, which can't be
+// encoded in UTF-8.
+var valid = New(Range{0, 0xD7FF}, Range{0xE000, unicode.MaxRune})
+
+// Intersect returns the class of runes that are in c and in all of others.
+func (c Class) Intersect(others ...Class) Class {
+	result := c
+	for _, other := range others {
+		var ranges []Range
+		i, j := 0, 0
+		for i < len(result.ranges) && j < len(other.ranges) {
+			a, b := result.ranges[i], other.ranges[j]
+			if lo, hi := max(a.Lo, b.Lo), min(a.Hi, b.Hi); lo <= hi {
+				ranges = append(ranges, Range{lo, hi})
+			}
+			if a.Hi < b.Hi {
+				i++
+			} else {
+				j++
+			}
+		}
+		result = normalize(ranges)
+	}
+	return result
+}
+
+// Subtract returns the class of runes that are in c but not in other.
+func (c Class) Subtract(other Class) Class {
+	return c.Intersect(other.Negate())
+}
+
+// Span returns the length of the longest prefix of input consisting of
+// runes in c.
+func (c Class) Span(input []rune) int {
+	for k, r := range input {
+		if !c.Contains(r) {
+			return k
+		}
+	}
+	return len(input)
+}
+
+// Random returns a rune chosen at random from c, favoring ASCII if c
+// contains any. It panics if c is empty.
+func (c Class) Random(rnd *rand.Rand) rune {
+	if c.IsEmpty() {
+		panic("charclass: Random called on an empty class")
+	}
+	ranges := c.ranges
+	if c.ascii != [2]uint64{} && rnd.IntN(4) != 0 {
+		ascii := c.Intersect(Between(0, 127)).ranges
+		ranges = ascii
+	}
+	total := 0
+	for _, r := range ranges {
+		total += int(r.Hi-r.Lo) + 1
+	}
+	n := rnd.IntN(total)
+	for _, r := range ranges {
+		size := int(r.Hi-r.Lo) + 1
+		if n < size {
+			return r.Lo + rune(n)
+		}
+		n -= size
+	}
+	return ranges[len(ranges)-1].Hi
+}
+
+// String returns c in the syntax accepted by Parse, e.g., "[0-9A-Fa-f]".
+func (c Class) String() string {
+	var b strings.Builder
+	b.WriteByte('[')
+	for _, r := range c.ranges {
+		writeRune(&b, r.Lo)
+		if r.Hi > r.Lo {
+			if r.Hi > r.Lo+1 {
+				b.WriteByte('-')
+			}
+			writeRune(&b, r.Hi)
+		}
+	}
+	b.WriteByte(']')
+	return b.String()
+}
+
+func writeRune(b *strings.Builder, r rune) {
+	switch {
+	case strings.ContainsRune(`\[]^-&`, r):
+		b.WriteByte('\\')
+		b.WriteRune(r)
+	case unicode.IsPrint(r) && r != ' ':
+		b.WriteRune(r)
+	default:
+		fmt.Fprintf(b, `\x{%x}`, r)
+	}
+}
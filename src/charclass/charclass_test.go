@@ -0,0 +1,93 @@
+package charclass
+
+import (
+	"github.com/shoenig/test"
+	"math/rand/v2"
+	"testing"
+	"unicode"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		spec string
+		in   string
+		out  string
+	}{
+		{"a-z", "amz", "AZ0_"},
+		{"[a-z]", "amz", "AZ0-"},
+		{"[^a-z]", "AZ0-é", "amz"},
+		{"[a-c-]", "abc-", "d"},
+		{`[\-\]\\]`, `-]\`, "a["},
+		{`[\d_]`, "09_", "a "},
+		{`[\D]`, "a_", "09"},
+		{`[\w]`, "aZ9_", "- é"},
+		{`[\s]`, " \t\n", "a"},
+		{`[\p{Greek}]`, "αβΩ", "abж"},
+		{`[\P{Greek}]`, "abж", "αβΩ"},
+		{`[\pL]`, "aéжα", "1 -"},
+		{`[\p{Lu}]`, "AÉЖ", "aé"},
+		{`[[:alpha:][:digit:]]`, "aZ09", "_ -"},
+		{`[[:xdigit:]]`, "09afAF", "gG"},
+		{`[a-z&&[^aeiou]]`, "bcz", "aeiou1"},
+		{`[\p{L}&&\p{Greek}]`, "αΩ", "a΄"},
+		{`[\x41\x{1F600}é]`, "A😀é", "B"},
+		{`[\n\t]`, "\n\t", "nt"},
+		{`[[a-c][x-z]]`, "abcxyz", "dw"},
+		{`\p{Han}`, "中文", "a"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.spec, func(t *testing.T) {
+			c, err := Parse(tc.spec)
+			test.NoError(t, err)
+			for _, r := range tc.in {
+				test.True(t, c.Contains(r), test.Sprintf("%q should contain %q", tc.spec, r))
+			}
+			for _, r := range tc.out {
+				test.False(t, c.Contains(r), test.Sprintf("%q should not contain %q", tc.spec, r))
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, spec := range []string{"[z-a]", `[\p{Klingon}]`, "[[:alpha]", "[a", `a\`, "[[:bogus:]]", `\x{zz}`} {
+		t.Run(spec, func(t *testing.T) {
+			_, err := Parse(spec)
+			test.Error(t, err)
+		})
+	}
+}
+
+func TestOperations(t *testing.T) {
+	lower := Between('a', 'z')
+	vowels := Runes("aeiou")
+	test.Eq(t, "[a-z]", lower.String())
+	test.Eq(t, "[aeiou]", vowels.String())
+	test.Eq(t, "[b-df-hj-np-tv-z]", lower.Subtract(vowels).String())
+	test.Eq(t, "[aeiou]", lower.Intersect(vowels).String())
+	test.Eq(t, "[0-9a-z]", lower.Union(Between('0', '9')).String())
+	test.True(t, lower.Intersect(Between('0', '9')).IsEmpty())
+	test.True(t, Class{}.Negate().Contains('x'))
+	test.False(t, Class{}.Negate().Contains(0xD800))
+	test.Eq(t, "[ab]", New(Range{'b', 'b'}, Range{'a', 'a'}).String())
+	test.Eq(t, 3, lower.Span([]rune("abc1")))
+}
+
+func TestTable(t *testing.T) {
+	upper := Table(unicode.Upper)
+	for _, r := range "AZÀΩЖ" {
+		test.True(t, upper.Contains(r))
+	}
+	for _, r := range "az1 ω" {
+		test.False(t, upper.Contains(r))
+	}
+}
+
+func TestRandom(t *testing.T) {
+	rnd := rand.New(rand.NewPCG(1, 2))
+	for _, c := range []Class{Between('a', 'c'), MustParse(`\p{Greek}`), MustParse("[x一-鿿]")} {
+		for k := 0; k < 100; k++ {
+			test.True(t, c.Contains(c.Random(rnd)))
+		}
+	}
+}
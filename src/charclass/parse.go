@@ -0,0 +1,332 @@
+package charclass
+
+import (
+	"fmt"
+	"strconv"
+	"unicode"
+)
+
+// Parse returns the class described by spec, which uses the familiar syntax
+// of regular expression bracket expressions. The surrounding brackets are
+// optional, so "a-z" and "[a-z]" are equivalent. Within the brackets:
+//
+//	x        the rune x
+//	a-z      a range of runes
+//	^...     (at the start) the complement of what follows
+//	\d \w \s ASCII digits, word runes and whitespace; \D \W \S are complements
+//	\pL      a Unicode category with a one-letter name
+//	\p{Greek} a Unicode category, script or property; \P{Greek} is the complement
+//	[:alpha:] a POSIX class: alnum, alpha, ascii, blank, cntrl, digit, graph,
+//	         lower, print, punct, space, upper, word or xdigit
+//	[...]    a nested class, whose runes are added to the enclosing one
+//	A&&B     the intersection of A and B
+//	\n \t \r \f \v \x41 \x{1F600} é  escaped runes; any other escaped rune stands for itself
+func Parse(spec string) (Class, error) {
+	p := &parser{input: []rune(spec)}
+	if len(p.input) > 1 && p.input[0] == '[' && closingBracket(p.input) == len(p.input)-1 {
+		p.pos = 1
+		p.input = p.input[:len(p.input)-1]
+	}
+	c, err := p.body()
+	if err != nil {
+		return Class{}, err
+	}
+	if p.pos != len(p.input) {
+		return Class{}, p.errorf("unexpected %q", p.input[p.pos])
+	}
+	return c, nil
+}
+
+// MustParse is like Parse but panics if spec is invalid.
+func MustParse(spec string) Class {
+	c, err := Parse(spec)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// closingBracket returns the index of the ']' that closes the '[' at the
+// start of input, or -1 if there is none.
+func closingBracket(input []rune) int {
+	depth := 0
+	for k := 0; k < len(input); k++ {
+		switch input[k] {
+		case '\\':
+			k++
+		case '[':
+			if k+1 < len(input) && input[k+1] == ':' {
+				if end := find(input, k, ":]"); end > 0 {
+					k = end + 1
+					continue
+				}
+			}
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				return k
+			}
+		}
+	}
+	return -1
+}
+
+// find returns the index of the first occurrence of s in input at or
+// after from, or -1.
+func find(input []rune, from int, s string) int {
+	target := []rune(s)
+	for k := from; k+len(target) <= len(input); k++ {
+		if string(input[k:k+len(target)]) == s {
+			return k
+		}
+	}
+	return -1
+}
+
+type parser struct {
+	input []rune
+	pos   int
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return fmt.Errorf("charclass: at %d in %q: %s", p.pos, string(p.input), fmt.Sprintf(format, args...))
+}
+
+func (p *parser) peek(s string) bool {
+	rs := []rune(s)
+	if p.pos+len(rs) > len(p.input) {
+		return false
+	}
+	for k, r := range rs {
+		if p.input[p.pos+k] != r {
+			return false
+		}
+	}
+	return true
+}
+
+// body parses the contents of a bracket expression, up to an unmatched ']'
+// or the end of input.
+func (p *parser) body() (Class, error) {
+	negate := false
+	if p.peek("^") {
+		negate = true
+		p.pos++
+	}
+	result, err := p.union()
+	if err != nil {
+		return Class{}, err
+	}
+	for p.peek("&&") {
+		p.pos += 2
+		other, err := p.union()
+		if err != nil {
+			return Class{}, err
+		}
+		result = result.Intersect(other)
+	}
+	if negate {
+		result = result.Negate()
+	}
+	return result, nil
+}
+
+// union parses a sequence of items, stopping at "&&", ']' or the end.
+func (p *parser) union() (Class, error) {
+	var classes []Class
+	for p.pos < len(p.input) && !p.peek("&&") && !p.peek("]") {
+		c, err := p.item()
+		if err != nil {
+			return Class{}, err
+		}
+		classes = append(classes, c)
+	}
+	return Class{}.Union(classes...), nil
+}
+
+func (p *parser) item() (Class, error) {
+	switch {
+	case p.peek("[:"):
+		end := find(p.input, p.pos, ":]")
+		if end < 0 {
+			return Class{}, p.errorf("unterminated POSIX class")
+		}
+		name := string(p.input[p.pos+2 : end])
+		c, ok := posix[name]
+		if !ok {
+			return Class{}, p.errorf("unknown POSIX class %q", name)
+		}
+		p.pos = end + 2
+		return c, nil
+	case p.peek("["):
+		p.pos++
+		c, err := p.body()
+		if err != nil {
+			return Class{}, err
+		}
+		if !p.peek("]") {
+			return Class{}, p.errorf("missing ]")
+		}
+		p.pos++
+		return c, nil
+	case p.peek("\\"):
+		if c, ok, err := p.classEscape(); ok || err != nil {
+			return c, err
+		}
+	}
+	lo, err := p.single()
+	if err != nil {
+		return Class{}, err
+	}
+	if p.peek("-") && p.pos+1 < len(p.input) && p.input[p.pos+1] != ']' {
+		p.pos++
+		hi, err := p.single()
+		if err != nil {
+			return Class{}, err
+		}
+		if hi < lo {
+			return Class{}, p.errorf("invalid range %q-%q", lo, hi)
+		}
+		return Between(lo, hi), nil
+	}
+	return Between(lo, lo), nil
+}
+
+// classEscape parses an escape that stands for a class, like \d or \p{L}.
+// It returns false if the escape at pos is not one of those.
+func (p *parser) classEscape() (Class, bool, error) {
+	if p.pos+1 >= len(p.input) {
+		return Class{}, false, p.errorf("trailing backslash")
+	}
+	switch e := p.input[p.pos+1]; e {
+	case 'd', 'D', 'w', 'W', 's', 'S':
+		p.pos += 2
+		c := perl[unicode.ToLower(e)]
+		if unicode.IsUpper(e) {
+			c = c.Negate()
+		}
+		return c, true, nil
+	case 'p', 'P':
+		p.pos += 2
+		var name string
+		if p.peek("{") {
+			end := find(p.input, p.pos, "}")
+			if end < 0 {
+				return Class{}, true, p.errorf("unterminated \\%c{", e)
+			}
+			name = string(p.input[p.pos+1 : end])
+			p.pos = end + 1
+		} else if p.pos < len(p.input) {
+			name = string(p.input[p.pos])
+			p.pos++
+		}
+		c, err := Unicode(name)
+		if err != nil {
+			return Class{}, true, p.errorf("%v", err)
+		}
+		if e == 'P' {
+			c = c.Negate()
+		}
+		return c, true, nil
+	}
+	return Class{}, false, nil
+}
+
+// single parses a single, possibly escaped, rune.
+func (p *parser) single() (rune, error) {
+	if p.pos >= len(p.input) {
+		return 0, p.errorf("unexpected end")
+	}
+	r := p.input[p.pos]
+	p.pos++
+	if r != '\\' {
+		return r, nil
+	}
+	if p.pos >= len(p.input) {
+		return 0, p.errorf("trailing backslash")
+	}
+	r = p.input[p.pos]
+	p.pos++
+	switch r {
+	case 'n':
+		return '\n', nil
+	case 't':
+		return '\t', nil
+	case 'r':
+		return '\r', nil
+	case 'f':
+		return '\f', nil
+	case 'v':
+		return '\v', nil
+	case 'x':
+		if p.peek("{") {
+			end := find(p.input, p.pos, "}")
+			if end < 0 {
+				return 0, p.errorf("unterminated \\x{")
+			}
+			hex := string(p.input[p.pos+1 : end])
+			p.pos = end + 1
+			return p.hex(hex)
+		}
+		return p.fixedHex(2)
+	case 'u':
+		return p.fixedHex(4)
+	}
+	return r, nil
+}
+
+func (p *parser) fixedHex(n int) (rune, error) {
+	if p.pos+n > len(p.input) {
+		return 0, p.errorf("short hex escape")
+	}
+	hex := string(p.input[p.pos : p.pos+n])
+	p.pos += n
+	return p.hex(hex)
+}
+
+func (p *parser) hex(s string) (rune, error) {
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil || v > unicode.MaxRune {
+		return 0, p.errorf("invalid hex escape %q", s)
+	}
+	return rune(v), nil
+}
+
+// Unicode returns the class for a Unicode category (like "Lu" or "L"),
+// script (like "Greek") or property (like "White_Space"). "Any" is the
+// class of all runes.
+func Unicode(name string) (Class, error) {
+	if name == "Any" {
+		return valid, nil
+	}
+	for _, tables := range []map[string]*unicode.RangeTable{unicode.Categories, unicode.Scripts, unicode.Properties} {
+		if table, ok := tables[name]; ok {
+			return Table(table), nil
+		}
+	}
+	return Class{}, fmt.Errorf("unknown Unicode class %q", name)
+}
+
+var perl = map[rune]Class{
+	'd': Between('0', '9'),
+	'w': New(Range{'0', '9'}, Range{'A', 'Z'}, Range{'a', 'z'}, Range{'_', '_'}),
+	's': Runes("\t\n\f\r "),
+}
+
+var posix = map[string]Class{
+	"alnum":  New(Range{'0', '9'}, Range{'A', 'Z'}, Range{'a', 'z'}),
+	"alpha":  New(Range{'A', 'Z'}, Range{'a', 'z'}),
+	"ascii":  Between(0, 127),
+	"blank":  Runes("\t "),
+	"cntrl":  New(Range{0, 31}, Range{127, 127}),
+	"digit":  Between('0', '9'),
+	"graph":  Between('!', '~'),
+	"lower":  Between('a', 'z'),
+	"print":  Between(' ', '~'),
+	"punct":  New(Range{'!', '/'}, Range{':', '@'}, Range{'[', '`'}, Range{'{', '~'}),
+	"space":  Runes("\t\n\v\f\r "),
+	"upper":  Between('A', 'Z'),
+	"word":   New(Range{'0', '9'}, Range{'A', 'Z'}, Range{'a', 'z'}, Range{'_', '_'}),
+	"xdigit": New(Range{'0', '9'}, Range{'A', 'F'}, Range{'a', 'f'}),
+}
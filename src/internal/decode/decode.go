@@ -0,0 +1,220 @@
+// Package decode fills Go values from parse trees by reflection. It is
+// shared by the Unmarshal functions of sparse and speg, which differ only in
+// their trees.
+package decode
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// A Tree describes how to read the parse trees of type T.
+type Tree[T comparable] struct {
+	Tag      func(t T) string
+	Text     func(t T) string
+	Children func(t T) []T
+	// Pos returns the position of t in the input, in runes, for errors.
+	Pos func(t T) int
+}
+
+// An Unmarshaler can fill itself from a parse tree of type T.
+type Unmarshaler[T any] interface {
+	UnmarshalTree(t T) error
+}
+
+// An Error describes a tree that couldn't be stored in a Go value.
+type Error struct {
+	// Pos is the position in the input, in runes, of the tree.
+	Pos int
+	// Text is the text of the tree.
+	Text string
+	// Type is the type of the value it was to be stored in.
+	Type reflect.Type
+	// Err is the reason it couldn't be.
+	Err error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("cannot unmarshal %s at %d into %s: %v", strconv.Quote(e.Text), e.Pos, e.Type, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+var errUnsupported = errors.New("unsupported type")
+
+// Unmarshal stores t in the value that v points to.
+func (d Tree[T]) Unmarshal(t T, v any) error {
+	var zero T
+	if t == zero {
+		return errors.New("unmarshal: nil tree")
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("unmarshal: need a non-nil pointer, not %T", v)
+	}
+	return d.value(t, rv.Elem(), 10)
+}
+
+var textUnmarshaler = reflect.TypeFor[encoding.TextUnmarshaler]()
+
+// value stores t in v, which must be settable. Integers are read in base, or
+// with a base prefix if base is 0.
+func (d Tree[T]) value(t T, v reflect.Value, base int) error {
+	if v.CanAddr() {
+		switch u := v.Addr().Interface().(type) {
+		case Unmarshaler[T]:
+			if err := u.UnmarshalTree(t); err != nil {
+				return d.wrap(t, v, err)
+			}
+			return nil
+		case encoding.TextUnmarshaler:
+			if err := u.UnmarshalText([]byte(d.Text(t))); err != nil {
+				return d.wrap(t, v, err)
+			}
+			return nil
+		}
+	}
+	text := d.Text(t)
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(text)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return d.wrap(t, v, err)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(text, base, v.Type().Bits())
+		if err != nil {
+			return d.wrap(t, v, err)
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, err := strconv.ParseUint(text, base, v.Type().Bits())
+		if err != nil {
+			return d.wrap(t, v, err)
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(text, v.Type().Bits())
+		if err != nil {
+			return d.wrap(t, v, err)
+		}
+		v.SetFloat(f)
+	case reflect.Pointer:
+		elem := reflect.New(v.Type().Elem())
+		if err := d.value(t, elem.Elem(), base); err != nil {
+			return err
+		}
+		v.Set(elem)
+	case reflect.Slice:
+		return d.slice(d.Children(t), v, base)
+	case reflect.Struct:
+		return d.fields(t, v)
+	default:
+		return d.wrap(t, v, errUnsupported)
+	}
+	return nil
+}
+
+// slice stores trees in v, one per element.
+func (d Tree[T]) slice(trees []T, v reflect.Value, base int) error {
+	result := reflect.MakeSlice(v.Type(), len(trees), len(trees))
+	for k, t := range trees {
+		if err := d.value(t, result.Index(k), base); err != nil {
+			return err
+		}
+	}
+	v.Set(result)
+	return nil
+}
+
+// fields fills the exported fields of the struct v from the descendants of
+// t with matching tags. A field is filled from the first such tree, or from
+// all of them if it is a slice without the list option. Its integers are read
+// in base 10, or with a base prefix if it has the base option.
+func (d Tree[T]) fields(t T, v reflect.Value) error {
+	typ := v.Type()
+	for k := range typ.NumField() {
+		field := typ.Field(k)
+		if !field.IsExported() {
+			continue
+		}
+		spec, explicit := field.Tag.Lookup("parse")
+		if spec == "-" {
+			continue
+		}
+		name, rest, _ := strings.Cut(spec, ",")
+		options := strings.Split(rest, ",")
+		base := 10
+		if slices.Contains(options, "base") {
+			base = 0
+		}
+		if name == "" {
+			name = field.Name
+			explicit = false
+		}
+		matches := d.find(t, func(tag string) bool {
+			return tag == name || !explicit && strings.EqualFold(tag, name)
+		})
+		if len(matches) == 0 {
+			continue
+		}
+		fv := v.Field(k)
+		if fv.Kind() == reflect.Slice && !slices.Contains(options, "list") && !implements[T](fv) {
+			if err := d.slice(matches, fv, base); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := d.value(matches[0], fv, base); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// implements reports whether v unmarshals itself, in which case a slice is
+// filled from a single tree like any other value.
+func implements[T any](v reflect.Value) bool {
+	p := reflect.PointerTo(v.Type())
+	return p.Implements(reflect.TypeFor[Unmarshaler[T]]()) || p.Implements(textUnmarshaler)
+}
+
+// find returns the descendants of t whose tags satisfy match, in order. It
+// looks inside untagged trees, but not tagged ones, since those are the
+// fields of a different struct.
+func (d Tree[T]) find(t T, match func(tag string) bool) []T {
+	var result []T
+	for _, child := range d.Children(t) {
+		tag := d.Tag(child)
+		switch {
+		case tag == "":
+			result = append(result, d.find(child, match)...)
+		case match(tag):
+			result = append(result, child)
+		}
+	}
+	return result
+}
+
+// wrap returns err, an error storing t in v, with t's position, unless it
+// already has one.
+func (d Tree[T]) wrap(t T, v reflect.Value, err error) error {
+	var e *Error
+	if errors.As(err, &e) {
+		return err
+	}
+	if ne, ok := err.(*strconv.NumError); ok {
+		err = ne.Err
+	}
+	return &Error{Pos: d.Pos(t), Text: d.Text(t), Type: v.Type(), Err: err}
+}
@@ -0,0 +1,275 @@
+// Package traverse traverses and rewrites parse trees. It is shared by sparse
+// and speg, whose trees differ only in their fields.
+package traverse
+
+import "iter"
+
+// An Action tells Walk how to go on after visiting a tree.
+type Action int
+
+const (
+	// Continue goes on to the children of the tree, and then the rest.
+	Continue Action = iota
+	// SkipChildren goes on to the rest, without visiting the children of the
+	// tree.
+	SkipChildren
+	// Stop ends the traversal.
+	Stop
+)
+
+// A Cursor describes a tree during a traversal: the tree itself and where
+// it is. It is only valid until the traversal moves on.
+type Cursor[T any] struct {
+	path    []T
+	indexes []int
+	skip    bool
+}
+
+// Tree returns the tree the cursor is at.
+func (c *Cursor[T]) Tree() T {
+	return c.path[len(c.path)-1]
+}
+
+// Parent returns the parent of the tree, or the zero T for the root.
+func (c *Cursor[T]) Parent() T {
+	var zero T
+	if len(c.path) < 2 {
+		return zero
+	}
+	return c.path[len(c.path)-2]
+}
+
+// Path returns the ancestors of the tree, root first. It is shared with the
+// cursor, so it must not be modified, or kept past the current step.
+func (c *Cursor[T]) Path() []T {
+	return c.path[:len(c.path)-1]
+}
+
+// Index returns the index of the tree among the children of its parent, or
+// -1 for the root.
+func (c *Cursor[T]) Index() int {
+	return c.indexes[len(c.indexes)-1]
+}
+
+// Depth returns the number of ancestors of the tree.
+func (c *Cursor[T]) Depth() int {
+	return len(c.path) - 1
+}
+
+// SkipChildren tells a preorder iterator not to visit the children of the
+// tree.
+func (c *Cursor[T]) SkipChildren() {
+	c.skip = true
+}
+
+func (c *Cursor[T]) push(t T, index int) {
+	c.path = append(c.path, t)
+	c.indexes = append(c.indexes, index)
+}
+
+func (c *Cursor[T]) pop() {
+	c.path = c.path[:len(c.path)-1]
+	c.indexes = c.indexes[:len(c.indexes)-1]
+}
+
+// Walk visits root and its descendants, depth first. It calls pre, if it
+// isn't nil, before visiting the children of each tree, and post, if it
+// isn't nil, after. Post is called even if pre skipped the children. It
+// returns false if pre or post stopped the traversal.
+func Walk[T comparable](root T, children func(T) []T, pre, post func(c *Cursor[T]) Action) bool {
+	var zero T
+	if root == zero {
+		return true
+	}
+	c := &Cursor[T]{}
+	var visit func(t T, index int) bool
+	visit = func(t T, index int) bool {
+		c.push(t, index)
+		defer c.pop()
+		action := Continue
+		if pre != nil {
+			action = pre(c)
+		}
+		switch action {
+		case Stop:
+			return false
+		case Continue:
+			for k, child := range children(t) {
+				if child != zero && !visit(child, k) {
+					return false
+				}
+			}
+		}
+		return post == nil || post(c) != Stop
+	}
+	return visit(root, -1)
+}
+
+// Preorder returns an iterator over root and its descendants, each before
+// its children. Calling SkipChildren on the cursor skips the children of the
+// current tree.
+func Preorder[T comparable](root T, children func(T) []T) iter.Seq2[*Cursor[T], T] {
+	return func(yield func(*Cursor[T], T) bool) {
+		Walk(root, children, func(c *Cursor[T]) Action {
+			if !yield(c, c.Tree()) {
+				return Stop
+			}
+			if c.skip {
+				c.skip = false
+				return SkipChildren
+			}
+			return Continue
+		}, nil)
+	}
+}
+
+// Postorder returns an iterator over root and its descendants, each after
+// its children.
+func Postorder[T comparable](root T, children func(T) []T) iter.Seq2[*Cursor[T], T] {
+	return func(yield func(*Cursor[T], T) bool) {
+		Walk(root, children, nil, func(c *Cursor[T]) Action {
+			if !yield(c, c.Tree()) {
+				return Stop
+			}
+			return Continue
+		})
+	}
+}
+
+// Rewrite rebuilds root from the bottom up. For each tree, f is called with
+// a cursor at the original tree, and the tree with its children already
+// rewritten. It returns the replacement: the tree itself, a new tree, or the
+// zero T to delete it. Trees whose children changed are copied by rebuild,
+// so the original trees aren't modified.
+func Rewrite[T comparable](root T, children func(T) []T, rebuild func(t T, children []T) T, f func(c *Cursor[T], t T) T) T {
+	var zero T
+	if root == zero {
+		return zero
+	}
+	c := &Cursor[T]{}
+	var visit func(t T, index int) T
+	visit = func(t T, index int) T {
+		c.push(t, index)
+		defer c.pop()
+		kids := children(t)
+		var rewritten []T
+		changed := false
+		for k, child := range kids {
+			r := child
+			if child != zero {
+				r = visit(child, k)
+			}
+			changed = changed || r != child
+			if r != zero {
+				rewritten = append(rewritten, r)
+			}
+		}
+		if changed {
+			t = rebuild(t, rewritten)
+		}
+		return f(c, t)
+	}
+	return visit(root, -1)
+}
+
+// Cover returns the shortest slice that covers both a and b, from the start
+// of whichever begins first to the end of whichever ends last, provided they
+// are slices of the same array. Otherwise it returns a and false. An empty b
+// is covered by any a.
+func Cover(a, b []rune) ([]rune, bool) {
+	if len(b) == 0 {
+		return a, true
+	}
+	first, second := a, b
+	if cap(b) > cap(a) {
+		first, second = b, a
+	}
+	if cap(second) == 0 {
+		return a, false
+	}
+	offset := cap(first) - cap(second)
+	full := first[:cap(first)]
+	if &full[offset] != &second[:1][0] {
+		return a, false
+	}
+	return full[:max(len(first), offset+len(second))], true
+}
+
+// Fit returns the runes covered by a tree that covered span, and whose
+// children covered old, once its children cover new instead: the runes of
+// the new children, along with any part of span before or after all of the
+// old children, such as delimiters that aren't children. So removing a child
+// at either end shrinks the result, and adding one beyond span extends it.
+// Slices of arrays other than span's, and empty slices, are ignored, except
+// that if span is empty, it takes the array of the first new child.
+func Fit(span []rune, old, new [][]rune) []rune {
+	full := span
+	for _, n := range new {
+		if len(n) == 0 {
+			continue
+		}
+		if cap(full) == 0 {
+			full = n
+			continue
+		}
+		full, _ = Cover(full, n)
+	}
+	if cap(full) == 0 {
+		return span
+	}
+	// Positions are relative to the start of full.
+	array := full[:cap(full)]
+	offset := func(s []rune) (int, bool) {
+		if len(s) == 0 {
+			return 0, false
+		}
+		if _, ok := Cover(full, s); !ok {
+			return 0, false
+		}
+		return cap(full) - cap(s), true
+	}
+	lo, hi := -1, -1
+	include := func(start, end int) {
+		if lo < 0 || start < lo {
+			lo = start
+		}
+		if end > hi {
+			hi = end
+		}
+	}
+	spanStart, inSpan := offset(span)
+	if inSpan {
+		spanEnd := spanStart + len(span)
+		first, last := -1, -1
+		for _, s := range old {
+			if start, ok := offset(s); ok {
+				if first < 0 || start < first {
+					first = start
+				}
+				last = max(last, start+len(s))
+			}
+		}
+		if first < 0 {
+			include(spanStart, spanEnd)
+		} else {
+			if first > spanStart {
+				include(spanStart, first)
+			}
+			if last < spanEnd {
+				include(last, spanEnd)
+			}
+		}
+	}
+	for _, n := range new {
+		if start, ok := offset(n); ok {
+			include(start, start+len(n))
+		}
+	}
+	if lo < 0 {
+		if inSpan {
+			return array[spanStart:spanStart]
+		}
+		return span
+	}
+	return array[lo:hi]
+}
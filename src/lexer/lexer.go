@@ -0,0 +1,362 @@
+// Package lexer splits input into tokens with rules built from speg parsers,
+// and parses the resulting tokens with speg grammars, for languages large
+// enough that a separate lexical stage pays off.
+//
+// A grammar over tokens is an ordinary speg grammar whose leaves are Kind
+// matchers. It runs on one rune per token, so positions in its Trees are
+// token indices, and its memo tables hold an entry per token rather than per
+// rune.
+package lexer
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"sparse/src/speg"
+	"strconv"
+	"unicode/utf8"
+)
+
+// A Token is a lexeme of the input.
+type Token struct {
+	// Kind is the kind of the rule that matched the token, or for a literal,
+	// the literal itself.
+	Kind string
+	// Text is the input the token matched.
+	Text string
+	// Pos is the position of the token in the input, in runes.
+	Pos int
+}
+
+func (t Token) String() string {
+	return t.Kind + " " + strconv.Quote(t.Text)
+}
+
+// A Lexer splits input into Tokens. At each position it tries all of the
+// rules of the current mode, and the longest match wins. If two rules match
+// the same length, the one added first wins, so literals that look like
+// identifiers, such as keywords, must be added before the identifier rule.
+//
+// The Lexer starts in its base mode, whose rules are added with the methods
+// of the Lexer itself. Rules added with Push and Pop switch to other modes,
+// which have rules of their own; see Mode.
+type Lexer struct {
+	base  *Mode
+	modes map[string]*Mode
+	// codes holds the rune that stands for each kind in the input to a
+	// grammar over tokens. Literals and the kinds of rules share it, as they
+	// share Token.Kind, so literal and named hold which kinds are which.
+	codes   map[string]rune
+	literal map[string]bool
+	named   map[string]bool
+}
+
+// A Mode is a set of lexing rules, such as the rules for the inside of a
+// string literal. The lexer keeps a stack of modes, and uses the rules of the
+// one on top. Rules added with Push and Pop change the stack.
+type Mode struct {
+	lexer *Lexer
+	name  string
+	rules []rule
+}
+
+type rule struct {
+	kind   string
+	parser speg.Parser
+	// skip is set for rules whose matches aren't tokens, like whitespace.
+	skip bool
+	// literals is set for the rule added by Literals, whose kind is the
+	// word it matched.
+	literals bool
+	action   action
+	// mode is the mode a push rule switches to.
+	mode *Mode
+}
+
+// An action is what a rule does to the mode stack.
+type action int
+
+const (
+	stay action = iota
+	push
+	pop
+)
+
+// firstCode is the rune that stands for the first kind. Kinds are numbered
+// from the start of a private use plane, so they can't be confused with
+// runes of the input.
+const firstCode = 0xF0000
+
+// New returns a Lexer without rules.
+func New() *Lexer {
+	l := &Lexer{
+		modes:   make(map[string]*Mode),
+		codes:   make(map[string]rune),
+		literal: make(map[string]bool),
+		named:   make(map[string]bool),
+	}
+	l.base = l.Mode("")
+	return l
+}
+
+// Mode returns the mode with the given name, creating it if necessary. The
+// base mode is named "".
+func (l *Lexer) Mode(name string) *Mode {
+	m, ok := l.modes[name]
+	if !ok {
+		m = &Mode{lexer: l, name: name}
+		l.modes[name] = m
+	}
+	return m
+}
+
+// Rule adds a rule to the base mode; see Mode.Rule.
+func (l *Lexer) Rule(kind string, p speg.Parser) *Lexer {
+	l.base.Rule(kind, p)
+	return l
+}
+
+// Skip adds a skip rule to the base mode; see Mode.Skip.
+func (l *Lexer) Skip(p speg.Parser) *Lexer {
+	l.base.Skip(p)
+	return l
+}
+
+// Literals adds a rule for words to the base mode; see Mode.Literals.
+func (l *Lexer) Literals(words ...string) *Lexer {
+	l.base.Literals(words...)
+	return l
+}
+
+// Push adds a rule to the base mode that switches modes; see Mode.Push.
+func (l *Lexer) Push(kind string, p speg.Parser, mode string) *Lexer {
+	l.base.Push(kind, p, mode)
+	return l
+}
+
+// Pop adds a rule to the base mode that pops a mode; see Mode.Pop. Since
+// there is nothing to return to from the base mode, Lex fails if it matches,
+// which is how to report unbalanced closing delimiters.
+func (l *Lexer) Pop(kind string, p speg.Parser) *Lexer {
+	l.base.Pop(kind, p)
+	return l
+}
+
+// Rule adds a rule that produces tokens of kind where p matches. It panics
+// if kind is also a literal; see Literals.
+func (m *Mode) Rule(kind string, p speg.Parser) *Mode {
+	m.lexer.name(kind)
+	m.rules = append(m.rules, rule{kind: kind, parser: p})
+	return m
+}
+
+// Skip adds a rule for input that separates tokens, like whitespace and
+// comments, and isn't part of any.
+func (m *Mode) Skip(p speg.Parser) *Mode {
+	m.rules = append(m.rules, rule{parser: p, skip: true})
+	return m
+}
+
+// Literals adds a rule for words, such as keywords and punctuation, each of
+// which is a kind of its own, so Kind("if") matches the token "if". A word
+// can't also be the kind of a rule; Literals panics if it is.
+func (m *Mode) Literals(words ...string) *Mode {
+	for _, w := range words {
+		if m.lexer.named[w] {
+			panic(fmt.Sprintf("lexer: literal %s is also the kind of a rule", strconv.Quote(w)))
+		}
+		m.lexer.code(w)
+		m.lexer.literal[w] = true
+	}
+	m.rules = append(m.rules, rule{parser: speg.Literals(words...), literals: true})
+	return m
+}
+
+// Push adds a rule that produces a token of kind where p matches, and then
+// pushes mode onto the mode stack, so that the following input is lexed by
+// the rules of mode until a Pop rule of mode matches. If kind is empty, the
+// match is skipped rather than made a token.
+func (m *Mode) Push(kind string, p speg.Parser, mode string) *Mode {
+	m.rules = append(m.rules, m.switching(kind, p, push, m.lexer.Mode(mode)))
+	return m
+}
+
+// Pop adds a rule that produces a token of kind where p matches, and then
+// pops this mode off the mode stack, returning to the mode that pushed it.
+// If kind is empty, the match is skipped rather than made a token.
+func (m *Mode) Pop(kind string, p speg.Parser) *Mode {
+	m.rules = append(m.rules, m.switching(kind, p, pop, nil))
+	return m
+}
+
+func (m *Mode) switching(kind string, p speg.Parser, a action, mode *Mode) rule {
+	if kind != "" {
+		m.lexer.name(kind)
+	}
+	return rule{kind: kind, parser: p, skip: kind == "", action: a, mode: mode}
+}
+
+// name records that kind is the kind of a rule, and panics if it is also a
+// literal, since Kind and Token.Kind couldn't tell the two apart.
+func (l *Lexer) name(kind string) {
+	if l.literal[kind] {
+		panic(fmt.Sprintf("lexer: kind %s is also a literal", strconv.Quote(kind)))
+	}
+	l.code(kind)
+	l.named[kind] = true
+}
+
+// code returns the rune that stands for kind, assigning one if necessary.
+func (l *Lexer) code(kind string) rune {
+	c, ok := l.codes[kind]
+	if !ok {
+		c = firstCode + rune(len(l.codes))
+		l.codes[kind] = c
+	}
+	return c
+}
+
+// Lex splits input into tokens. If some input matches no rule, it returns
+// the tokens before it and a *speg.ParseError that describes what the rules
+// expected there. It also fails if a Pop rule matches in the base mode, or
+// if the input ends in another mode.
+func (l *Lexer) Lex(input []rune) ([]Token, error) {
+	ctx := speg.NewContext()
+	var tokens []Token
+	stack := []*Mode{l.base}
+	for pos := 0; pos < len(input); {
+		mode := stack[len(stack)-1]
+		r, t := mode.longest(input, pos, ctx)
+		if t == nil {
+			return tokens, mode.lexError(input, pos, mode.rules)
+		}
+		switch r.action {
+		case push:
+			stack = append(stack, r.mode)
+		case pop:
+			if len(stack) == 1 {
+				return tokens, &speg.ParseError{
+					Pos:    pos,
+					Errors: []error{fmt.Errorf("unbalanced %s", strconv.Quote(string(t.Match)))},
+				}
+			}
+			stack = stack[:len(stack)-1]
+		}
+		if !r.skip {
+			kind := r.kind
+			if r.literals {
+				kind = t.Tag
+			}
+			tokens = append(tokens, Token{Kind: kind, Text: string(t.Match), Pos: pos})
+		}
+		pos += len(t.Match)
+	}
+	if mode := stack[len(stack)-1]; mode != l.base {
+		var pops []rule
+		for _, r := range mode.rules {
+			if r.action == pop {
+				pops = append(pops, r)
+			}
+		}
+		return tokens, mode.lexError(input, len(input), pops)
+	}
+	return tokens, nil
+}
+
+// longest returns the rule with the longest match at pos, and its match.
+// Rules that match the empty string are ignored, since they would never
+// make progress.
+func (m *Mode) longest(input []rune, pos int, ctx *speg.Context) (rule, *speg.Tree) {
+	var best rule
+	var match *speg.Tree
+	for _, r := range m.rules {
+		t := ctx.Parse(r.parser, input, pos)
+		if t != nil && len(t.Match) > 0 && (match == nil || len(t.Match) > len(match.Match)) {
+			best, match = r, t
+		}
+	}
+	return best, match
+}
+
+// lexError describes why none of rules matched at pos. The rules are run
+// again in a new context, so that failures from earlier tokens aren't
+// reported.
+func (m *Mode) lexError(input []rune, pos int, rules []rule) error {
+	ctx := speg.NewContext()
+	for _, r := range rules {
+		ctx.Parse(r.parser, input, pos)
+	}
+	if err := ctx.Error(); err != nil {
+		return err
+	}
+	expected := "token"
+	if m.name != "" {
+		expected = "end of " + m.name
+	}
+	return &speg.ParseError{Pos: pos, Expected: []string{expected}}
+}
+
+// Kind matches a single token of kind. Kinds added by Literals are
+// described by the quoted literal in errors, and other kinds by their name.
+func (l *Lexer) Kind(kind string) speg.Matcher {
+	code := l.code(kind)
+	expected := kind
+	if l.literal[kind] {
+		expected = strconv.Quote(kind)
+	}
+	return speg.NewMatcher(func(input []rune) int {
+		if len(input) == 0 || input[0] != code {
+			return -1
+		}
+		return 1
+	}).WithGenerator(func(*rand.Rand) []rune {
+		return []rune{code}
+	}).Expecting(expected)
+}
+
+// Runes returns the input for a grammar over tokens: one rune for each
+// token, standing for its kind. Tokens of kinds the lexer doesn't know
+// match no Kind.
+func (l *Lexer) Runes(tokens []Token) []rune {
+	result := make([]rune, len(tokens))
+	for k, t := range tokens {
+		result[k] = l.codes[t.Kind]
+	}
+	return result
+}
+
+// Parse runs grammar, a grammar over tokens, on tokens. Positions in the
+// result are token indices; see Span. If the parse fails, the error is a
+// *speg.ParseError whose Pos is the position in the input, in runes, of the
+// token where it failed.
+func (l *Lexer) Parse(grammar speg.Parser, tokens []Token) (*speg.Tree, error) {
+	ctx := speg.NewContext()
+	result := ctx.Parse(grammar, l.Runes(tokens), 0)
+	if result != nil {
+		return result, nil
+	}
+	err, ok := ctx.Error().(*speg.ParseError)
+	if !ok {
+		err = &speg.ParseError{}
+	}
+	err.Pos = inputPos(tokens, err.Pos)
+	return nil, err
+}
+
+// inputPos returns the position in the input of the token with index k, or
+// of the end of the last token if there is no such token.
+func inputPos(tokens []Token, k int) int {
+	if k < len(tokens) {
+		return tokens[k].Pos
+	}
+	if len(tokens) == 0 {
+		return 0
+	}
+	last := tokens[len(tokens)-1]
+	return last.Pos + utf8.RuneCountInString(last.Text)
+}
+
+// Span returns the tokens that t, the result of a grammar over tokens,
+// matched.
+func Span(tokens []Token, t *speg.Tree) []Token {
+	return tokens[t.Start : t.Start+len(t.Match)]
+}
@@ -0,0 +1,150 @@
+package lexer
+
+import (
+	"github.com/shoenig/test"
+	"sparse/src/speg"
+	"strings"
+	"testing"
+)
+
+func newLexer() *Lexer {
+	return New().
+		Skip(speg.WhiteSpace()).
+		Skip(speg.LineComment("//")).
+		Literals("if", "else", "(", ")", "{", "}", "=", "==", ";").
+		Rule("IDENT", speg.Identifier()).
+		Rule("NUMBER", speg.Digits())
+}
+
+func kinds(tokens []Token) []string {
+	var result []string
+	for _, t := range tokens {
+		result = append(result, t.String())
+	}
+	return result
+}
+
+func TestLex(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []string
+	}{
+		{"empty", "", nil},
+		{"assignment", "x = 12;", []string{`IDENT "x"`, `= "="`, `NUMBER "12"`, `; ";"`}},
+		{"longest literal", "x==y", []string{`IDENT "x"`, `== "=="`, `IDENT "y"`}},
+		{"keyword", "if iffy", []string{`if "if"`, `IDENT "iffy"`}},
+		{"comments", "a // b\nc", []string{`IDENT "a"`, `IDENT "c"`}},
+	}
+	l := newLexer()
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tokens, err := l.Lex([]rune(tc.input))
+			test.NoError(t, err)
+			test.Eq(t, tc.expected, kinds(tokens))
+		})
+	}
+}
+
+func TestLexPositions(t *testing.T) {
+	tokens, err := newLexer().Lex([]rune("é = 1"))
+	test.NoError(t, err)
+	var positions []int
+	for _, tok := range tokens {
+		positions = append(positions, tok.Pos)
+	}
+	test.Eq(t, []int{0, 2, 4}, positions)
+}
+
+func TestLexError(t *testing.T) {
+	tokens, err := newLexer().Lex([]rune("x = $1"))
+	test.Eq(t, []string{`IDENT "x"`, `= "="`}, kinds(tokens))
+	test.Eq(t, 4, err.(*speg.ParseError).Pos)
+}
+
+func TestKindCollision(t *testing.T) {
+	tests := []struct {
+		name     string
+		build    func()
+		expected string
+	}{
+		{"rule after literal", func() { newLexer().Rule("if", speg.Identifier()) }, `lexer: kind "if" is also a literal`},
+		{"literal after rule", func() { newLexer().Literals("NUMBER") }, `lexer: literal "NUMBER" is also the kind of a rule`},
+		{"push after literal", func() { newLexer().Push("{", speg.Exactly("{"), "block") }, `lexer: kind "{" is also a literal`},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			defer func() {
+				test.Eq(t, any(tc.expected), recover())
+			}()
+			tc.build()
+		})
+	}
+}
+
+// statements returns a grammar over the tokens of newLexer.
+func statements(l *Lexer) speg.Parser {
+	var stmt speg.Parser
+	block := speg.Between(l.Kind("{"), speg.Star(speg.Indirect(&stmt)), l.Kind("}")).Tagged("block")
+	expr := speg.Tagged(speg.Or(l.Kind("IDENT"), l.Kind("NUMBER")), "expr")
+	assign := speg.Seq(l.Kind("IDENT"), l.Kind("="), expr, l.Kind(";")).Tagged("assign")
+	cond := speg.Seq(l.Kind("if"), l.Kind("("), expr, l.Kind(")"), block, speg.Opt(speg.Seq(l.Kind("else"), block))).Tagged("if")
+	stmt = speg.Or(assign, cond, block)
+	return speg.Seq(speg.Star(stmt), speg.Not(speg.Any()))
+}
+
+func TestParse(t *testing.T) {
+	l := newLexer()
+	grammar := statements(l)
+	tokens, err := l.Lex([]rune("x = 1; if (x) { y = x; } else { // nothing\n }"))
+	test.NoError(t, err)
+	tree, err := l.Parse(grammar, tokens)
+	test.NoError(t, err)
+	stmts := tree.Children[0].Children
+	test.Len(t, 2, stmts)
+	test.Eq(t, "assign", stmts[0].Tag)
+	test.Eq(t, "if", stmts[1].Tag)
+
+	// Positions are token indices.
+	test.Eq(t, 4, stmts[1].Start)
+	var text []string
+	for _, tok := range Span(tokens, stmts[1]) {
+		text = append(text, tok.Text)
+	}
+	test.Eq(t, "if ( x ) { y = x ; } else { }", strings.Join(text, " "))
+}
+
+func TestParseError(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"missing semicolon", "x = 1 y = 2;", `parse error at 6: expected ";"`},
+		{"missing expression", "x = ;", `parse error at 4: expected IDENT or NUMBER`},
+		{"unclosed block", "if (x) { y = 1;", `parse error at 15: expected IDENT, "if", "{" or "}"`},
+	}
+	l := newLexer()
+	grammar := statements(l)
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tokens, err := l.Lex([]rune(tc.input))
+			test.NoError(t, err)
+			tree, err := l.Parse(grammar, tokens)
+			test.Nil(t, tree)
+			test.EqError(t, err, tc.expected)
+		})
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	// A Generator produces token kinds, which the grammar accepts.
+	l := newLexer()
+	grammar := statements(l)
+	g := speg.NewGenerator(grammar, 1)
+	for range 10 {
+		s, err := g.Generate()
+		test.NoError(t, err)
+		test.NotNil(t, grammar.Parse([]rune(s), 0, speg.NewContext()))
+	}
+}
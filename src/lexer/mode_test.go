@@ -0,0 +1,121 @@
+package lexer
+
+import (
+	"github.com/shoenig/test"
+	"sparse/src/speg"
+	"testing"
+)
+
+// interpolating lexes expressions with strings like "a ${b + "c"} d", in
+// which code is interpolated into strings and strings into code.
+func interpolating() *Lexer {
+	l := New().
+		Skip(speg.WhiteSpace()).
+		Literals("+", "{").
+		Pop("}", speg.Exactly("}")).
+		Push("OPEN", speg.Exactly(`"`), "string").
+		Rule("IDENT", speg.Identifier())
+	l.Mode("string").
+		Rule("TEXT", speg.NewMatcher(func(input []rune) int {
+			for k, r := range input {
+				if r == '"' || r == '$' && k+1 < len(input) && input[k+1] == '{' {
+					return k
+				}
+			}
+			return len(input)
+		})).
+		Push("INTERP", speg.Exactly("${"), "code").
+		Pop("CLOSE", speg.Exactly(`"`))
+	l.Mode("code").
+		Skip(speg.WhiteSpace()).
+		Literals("+").
+		Push("LBRACE", speg.Exactly("{"), "code").
+		Pop("}", speg.Exactly("}")).
+		Push("OPEN", speg.Exactly(`"`), "string").
+		Rule("IDENT", speg.Identifier())
+	return l
+}
+
+func TestModes(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []string
+	}{
+		{"plain string", `x + "a b"`, []string{`IDENT "x"`, `+ "+"`, `OPEN "\""`, `TEXT "a b"`, `CLOSE "\""`}},
+		{"empty string", `""`, []string{`OPEN "\""`, `CLOSE "\""`}},
+		{
+			"interpolation",
+			`"a ${b} c"`,
+			[]string{`OPEN "\""`, `TEXT "a "`, `INTERP "${"`, `IDENT "b"`, `} "}"`, `TEXT " c"`, `CLOSE "\""`},
+		},
+		{
+			// Whitespace is skipped in code but not in strings, and a lone $
+			// is text.
+			"nested",
+			`"$ ${ "x${y}" + z }"`,
+			[]string{
+				`OPEN "\""`, `TEXT "$ "`, `INTERP "${"`,
+				`OPEN "\""`, `TEXT "x"`, `INTERP "${"`, `IDENT "y"`, `} "}"`, `CLOSE "\""`,
+				`+ "+"`, `IDENT "z"`, `} "}"`, `CLOSE "\""`,
+			},
+		},
+		{
+			"braces in code",
+			`"${ {a} }"`,
+			[]string{`OPEN "\""`, `INTERP "${"`, `LBRACE "{"`, `IDENT "a"`, `} "}"`, `} "}"`, `CLOSE "\""`},
+		},
+	}
+	l := interpolating()
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tokens, err := l.Lex([]rune(tc.input))
+			test.NoError(t, err)
+			test.Eq(t, tc.expected, kinds(tokens))
+		})
+	}
+}
+
+func TestModeErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"unterminated string", `"abc`, `parse error at 4: expected "\""`},
+		{"unterminated interpolation", `"a ${b`, `parse error at 6: expected "}"`},
+		{"unbalanced brace", `a }`, `parse error at 2: unbalanced "}"`},
+		{"no rule in mode", `"${ $ }"`, `parse error at 4: expected whitespace, "+", "{", "}", "\"" or identifier`},
+	}
+	l := interpolating()
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := l.Lex([]rune(tc.input))
+			test.EqError(t, err, tc.expected)
+		})
+	}
+}
+
+func TestModeParse(t *testing.T) {
+	// The tokens of all modes are parsed by one grammar.
+	l := interpolating()
+	var expr speg.Parser
+	str := speg.Seq(l.Kind("OPEN"), speg.Star(speg.Or(
+		l.Kind("TEXT"),
+		speg.Seq(l.Kind("INTERP"), speg.Indirect(&expr), l.Kind("}")),
+	)), l.Kind("CLOSE")).Tagged("string")
+	term := speg.Or(l.Kind("IDENT"), str)
+	expr = speg.Seq(term, speg.Star(speg.Seq(l.Kind("+"), term)))
+	grammar := speg.Seq(expr, speg.Not(speg.Any()))
+
+	tokens, err := l.Lex([]rune(`"a ${b + "c"}" + d`))
+	test.NoError(t, err)
+	tree, err := l.Parse(grammar, tokens)
+	test.NoError(t, err)
+	test.NotNil(t, tree)
+
+	tokens, err = l.Lex([]rune(`"a ${b + }"`))
+	test.NoError(t, err)
+	_, err = l.Parse(grammar, tokens)
+	test.EqError(t, err, `parse error at 9: expected IDENT or OPEN`)
+}
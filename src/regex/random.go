@@ -0,0 +1,88 @@
+package regex
+
+import (
+	"math/rand/v2"
+	"regexp/syntax"
+	"unicode"
+)
+
+// Random returns a random string that re is likely to match. Repetitions
+// are bounded, and assertions like \b are ignored, so callers that need a
+// guarantee should check the result with MatchPrefix.
+func (re *Regexp) Random(r *rand.Rand) []rune {
+	return random(r, re.tree, nil)
+}
+
+func random(r *rand.Rand, tree *syntax.Regexp, out []rune) []rune {
+	switch tree.Op {
+	case syntax.OpLiteral:
+		for _, c := range tree.Rune {
+			if tree.Flags&syntax.FoldCase != 0 && r.IntN(2) == 0 {
+				c = foldRandomly(r, c)
+			}
+			out = append(out, c)
+		}
+	case syntax.OpCharClass:
+		out = append(out, randomInClass(r, tree.Rune))
+	case syntax.OpAnyCharNotNL:
+		out = append(out, rune(' '+r.IntN('~'-' '+1)))
+	case syntax.OpAnyChar:
+		out = append(out, rune(' '+r.IntN('~'-' '+1)))
+	case syntax.OpCapture:
+		out = random(r, tree.Sub[0], out)
+	case syntax.OpConcat:
+		for _, sub := range tree.Sub {
+			out = random(r, sub, out)
+		}
+	case syntax.OpAlternate:
+		out = random(r, tree.Sub[r.IntN(len(tree.Sub))], out)
+	case syntax.OpStar:
+		out = repeatRandomly(r, tree.Sub[0], out, 0, 3)
+	case syntax.OpPlus:
+		out = repeatRandomly(r, tree.Sub[0], out, 1, 4)
+	case syntax.OpQuest:
+		out = repeatRandomly(r, tree.Sub[0], out, 0, 1)
+	case syntax.OpRepeat:
+		most := tree.Max
+		if most < 0 {
+			most = tree.Min + 3
+		}
+		out = repeatRandomly(r, tree.Sub[0], out, tree.Min, most)
+	}
+	return out
+}
+
+func repeatRandomly(r *rand.Rand, tree *syntax.Regexp, out []rune, least, most int) []rune {
+	for n := least + r.IntN(most-least+1); n > 0; n-- {
+		out = random(r, tree, out)
+	}
+	return out
+}
+
+// randomInClass returns a random rune from a class, represented as in
+// syntax.Regexp by pairs of inclusive bounds.
+func randomInClass(r *rand.Rand, ranges []rune) rune {
+	total := 0
+	for k := 0; k < len(ranges); k += 2 {
+		total += int(ranges[k+1]-ranges[k]) + 1
+	}
+	if total == 0 {
+		return 0
+	}
+	n := r.IntN(total)
+	for k := 0; k < len(ranges); k += 2 {
+		size := int(ranges[k+1]-ranges[k]) + 1
+		if n < size {
+			return ranges[k] + rune(n)
+		}
+		n -= size
+	}
+	return ranges[len(ranges)-1]
+}
+
+func foldRandomly(r *rand.Rand, c rune) rune {
+	for n := r.IntN(3); n > 0; n-- {
+		c = unicode.SimpleFold(c)
+	}
+	return c
+}
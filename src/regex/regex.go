@@ -0,0 +1,209 @@
+// Package regex matches regular expressions against prefixes of []rune
+// input, for use by the matchers in sparse and speg.
+//
+// Patterns use the syntax of package regexp. They are compiled with
+// regexp/syntax into an NFA, which is simulated directly over runes (a Pike
+// VM), so matching never needs to convert the input to a string and takes
+// time linear in the length of the match.
+package regex
+
+import (
+	"fmt"
+	"regexp/syntax"
+)
+
+// A Regexp is a compiled regular expression. It is safe for concurrent use.
+type Regexp struct {
+	expr  string
+	prog  *syntax.Prog
+	names []string
+	tree  *syntax.Regexp
+}
+
+// Compile parses pattern and returns a Regexp that matches it.
+func Compile(pattern string) (*Regexp, error) {
+	tree, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return nil, fmt.Errorf("regex: %w", err)
+	}
+	names := tree.CapNames()
+	tree = tree.Simplify()
+	prog, err := syntax.Compile(tree)
+	if err != nil {
+		return nil, fmt.Errorf("regex: %w", err)
+	}
+	return &Regexp{
+		expr:  pattern,
+		prog:  prog,
+		names: names,
+		tree:  tree,
+	}, nil
+}
+
+// MustCompile is like Compile but panics if pattern is invalid.
+func MustCompile(pattern string) *Regexp {
+	re, err := Compile(pattern)
+	if err != nil {
+		panic(err)
+	}
+	return re
+}
+
+// String returns the pattern used to compile re.
+func (re *Regexp) String() string {
+	return re.expr
+}
+
+// NumSubexp returns the number of parenthesized groups in re.
+func (re *Regexp) NumSubexp() int {
+	return len(re.names) - 1
+}
+
+// SubexpNames returns the names of the groups in re, indexed by group number.
+// Element 0 stands for the whole match and, like unnamed groups, is "".
+func (re *Regexp) SubexpNames() []string {
+	return append([]string(nil), re.names...)
+}
+
+// MatchPrefix matches re against a prefix of input. The match is anchored: it
+// must start at input[0]. If there is a match, MatchPrefix returns its length
+// and the positions of the groups: group k matched input[groups[2*k]:groups[2*k+1]],
+// or didn't participate if both are -1. Group 0 is the whole match. If there
+// is no match, MatchPrefix returns -1 and nil.
+//
+// As with package regexp, alternatives are preferred from left to right and
+// repetitions are greedy unless marked otherwise, so the match is the one
+// a backtracking implementation would find first, not necessarily the longest.
+// Assertions like ^ and \b treat input[0] as the beginning of the text.
+func (re *Regexp) MatchPrefix(input []rune) (int, []int) {
+	m := &machine{
+		prog:  re.prog,
+		input: input,
+		ncap:  2 * len(re.names),
+	}
+	return m.run()
+}
+
+type thread struct {
+	pc   uint32
+	caps []int
+}
+
+// A queue is the set of threads to run at one position, in priority order.
+// Each instruction appears at most once, since a lower-priority thread at the
+// same instruction can't do anything the higher-priority one can't.
+type queue struct {
+	seen    []bool
+	marked  []uint32
+	threads []thread
+}
+
+func newQueue(size int) *queue {
+	return &queue{seen: make([]bool, size)}
+}
+
+func (q *queue) clear() {
+	for _, pc := range q.marked {
+		q.seen[pc] = false
+	}
+	q.marked = q.marked[:0]
+	q.threads = q.threads[:0]
+}
+
+type machine struct {
+	prog  *syntax.Prog
+	input []rune
+	ncap  int
+}
+
+func (m *machine) run() (int, []int) {
+	current := newQueue(len(m.prog.Inst))
+	next := newQueue(len(m.prog.Inst))
+
+	caps := make([]int, m.ncap)
+	for k := range caps {
+		caps[k] = -1
+	}
+	var matched []int
+	m.add(current, uint32(m.prog.Start), 0, caps)
+	for pos := 0; len(current.threads) > 0; pos++ {
+		r := rune(-1)
+		if pos < len(m.input) {
+			r = m.input[pos]
+		}
+	run:
+		for _, t := range current.threads {
+			inst := &m.prog.Inst[t.pc]
+			switch inst.Op {
+			case syntax.InstMatch:
+				matched = append([]int(nil), t.caps...)
+				if len(matched) > 1 {
+					matched[1] = pos
+				}
+				// Threads after this one have lower priority.
+				break run
+			case syntax.InstRune, syntax.InstRune1, syntax.InstRuneAny, syntax.InstRuneAnyNotNL:
+				if r >= 0 && inst.MatchRune(r) {
+					m.add(next, inst.Out, pos+1, t.caps)
+				}
+			}
+		}
+		current.clear()
+		current, next = next, current
+		if pos >= len(m.input) {
+			break
+		}
+	}
+	if matched == nil {
+		return -1, nil
+	}
+	if len(matched) == 0 {
+		// A program with no capture instructions still matches the prefix.
+		return 0, []int{0, 0}
+	}
+	matched[0] = 0
+	return matched[1], matched
+}
+
+// add adds a thread at pc to q, following empty transitions, with the
+// positions of groups in caps.
+func (m *machine) add(q *queue, pc uint32, pos int, caps []int) {
+	if q.seen[pc] {
+		return
+	}
+	q.seen[pc] = true
+	q.marked = append(q.marked, pc)
+	inst := &m.prog.Inst[pc]
+	switch inst.Op {
+	case syntax.InstFail:
+	case syntax.InstAlt, syntax.InstAltMatch:
+		m.add(q, inst.Out, pos, caps)
+		m.add(q, inst.Arg, pos, caps)
+	case syntax.InstNop:
+		m.add(q, inst.Out, pos, caps)
+	case syntax.InstCapture:
+		if int(inst.Arg) < len(caps) {
+			caps = append([]int(nil), caps...)
+			caps[inst.Arg] = pos
+		}
+		m.add(q, inst.Out, pos, caps)
+	case syntax.InstEmptyWidth:
+		if syntax.EmptyOp(inst.Arg)&^m.context(pos) == 0 {
+			m.add(q, inst.Out, pos, caps)
+		}
+	default:
+		q.threads = append(q.threads, thread{pc: pc, caps: caps})
+	}
+}
+
+// context returns the empty-width assertions that hold at pos.
+func (m *machine) context(pos int) syntax.EmptyOp {
+	r1, r2 := rune(-1), rune(-1)
+	if pos > 0 {
+		r1 = m.input[pos-1]
+	}
+	if pos < len(m.input) {
+		r2 = m.input[pos]
+	}
+	return syntax.EmptyOpContext(r1, r2)
+}
@@ -0,0 +1,72 @@
+package regex
+
+import (
+	"github.com/shoenig/test"
+	"math/rand/v2"
+	"testing"
+)
+
+func TestMatchPrefix(t *testing.T) {
+	tests := []struct {
+		pattern string
+		input   string
+		length  int
+	}{
+		{`abc`, "abcd", 3},
+		{`abc`, "abd", -1},
+		{`abc`, "xabc", -1},
+		{``, "xyz", 0},
+		{`a*`, "aaab", 3},
+		{`a*?`, "aaab", 0},
+		{`a|ab`, "abc", 1},
+		{`ab|a`, "abc", 2},
+		{`(a|ab)c`, "abc", 3},
+		{`[0-9]+(\.[0-9]+)?([eE][-+]?[0-9]+)?`, "3.14e-10x", 8},
+		{`[0-9]+(\.[0-9]+)?([eE][-+]?[0-9]+)?`, "3.x", 1},
+		{`[\p{L}_][\p{L}\p{N}_]*`, "größe_2 = 1", 7},
+		{`(?i)select`, "SeLeCt *", 6},
+		{`\w+\b`, "hello world", 5},
+		{`a$`, "a", 1},
+		{`a$`, "ab", -1},
+		{`x{2,3}`, "xxxxx", 3},
+		{`.*`, "ab\ncd", 2},
+		{`(?s).*`, "ab\ncd", 5},
+	}
+	for _, tc := range tests {
+		t.Run(tc.pattern+"/"+tc.input, func(t *testing.T) {
+			length, _ := MustCompile(tc.pattern).MatchPrefix([]rune(tc.input))
+			test.Eq(t, tc.length, length)
+		})
+	}
+}
+
+func TestGroups(t *testing.T) {
+	re := MustCompile(`(?P<int>[0-9]+)(?:\.(?P<frac>[0-9]+))?(e([0-9]+))?`)
+	test.Eq(t, 4, re.NumSubexp())
+	test.Eq(t, []string{"", "int", "frac", "", ""}, re.SubexpNames())
+
+	length, groups := re.MatchPrefix([]rune("12.5e3"))
+	test.Eq(t, 6, length)
+	test.Eq(t, []int{0, 6, 0, 2, 3, 4, 4, 6, 5, 6}, groups)
+
+	length, groups = re.MatchPrefix([]rune("12"))
+	test.Eq(t, 2, length)
+	test.Eq(t, []int{0, 2, 0, 2, -1, -1, -1, -1, -1, -1}, groups)
+}
+
+func TestCompileError(t *testing.T) {
+	_, err := Compile(`a(b`)
+	test.Error(t, err)
+}
+
+func TestRandom(t *testing.T) {
+	r := rand.New(rand.NewPCG(1, 1))
+	for _, pattern := range []string{`[0-9]+(\.[0-9]+)?`, `(?i)select|insert`, `[a-z]{2,4}x?`, `\p{Greek}+`} {
+		re := MustCompile(pattern)
+		for k := 0; k < 50; k++ {
+			s := re.Random(r)
+			length, _ := re.MatchPrefix(s)
+			test.Eq(t, len(s), length, test.Sprintf("%q on %q", pattern, string(s)))
+		}
+	}
+}
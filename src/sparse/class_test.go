@@ -0,0 +1,28 @@
+package sparse
+
+import (
+	"github.com/shoenig/test"
+	"sparse/src/charclass"
+	"testing"
+)
+
+func TestClass(t *testing.T) {
+	testCases := []struct {
+		input    string
+		parser   Parser
+		expected *Tree
+	}{
+		{"cat", Class("[a-f]"), &Tree{Runes: []rune("c")}},
+		{"xyz", Class("[a-f]"), nil},
+		{"", Class("[a-f]"), nil},
+		{"xyz", Class("[^a-f]"), &Tree{Runes: []rune("x")}},
+		{"λx", Class(`\p{Greek}`), &Tree{Runes: []rune("λ")}},
+		{"snake_case1 x", RunOf(charclass.MustParse(`\w`)), &Tree{Runes: []rune("snake_case1")}},
+		{" x", RunOf(charclass.MustParse(`\w`)), nil},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.input, func(t *testing.T) {
+			test.Eq(t, tt.expected, tt.parser([]rune(tt.input)))
+		})
+	}
+}
@@ -0,0 +1,31 @@
+package sparse
+
+import (
+	"github.com/shoenig/test"
+	"testing"
+)
+
+func TestLiterals(t *testing.T) {
+	ops := []string{"<", "<=", "<<", "<<=", "="}
+	testCases := []struct {
+		input    string
+		parser   Parser
+		expected *Tree
+	}{
+		{"<<=1", Literals(ops...), &Tree{Runes: []rune("<<="), Tag: "<<="}},
+		{"<<1", Literals(ops...), &Tree{Runes: []rune("<<"), Tag: "<<"}},
+		{"<1", Literals(ops...), &Tree{Runes: []rune("<"), Tag: "<"}},
+		{">", Literals(ops...), nil},
+		{"FROM t", LiteralsIgnoreCase("select", "from"), &Tree{Runes: []rune("FROM"), Tag: "from"}},
+		{"ΣΊΣΥΦΟΣ", LiteralsIgnoreCase("σίσυφος"), &Tree{Runes: []rune("ΣΊΣΥΦΟΣ"), Tag: "σίσυφος"}},
+		{"a<=b", Seq(Letter, Literals(ops...), Letter), &Tree{
+			Runes:    []rune("a<=b"),
+			Children: []*Tree{{Runes: []rune("<="), Tag: "<="}},
+		}},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.input, func(t *testing.T) {
+			test.Eq(t, tt.expected, tt.parser([]rune(tt.input)))
+		})
+	}
+}
@@ -1,7 +1,9 @@
 package sparse
 
 import (
-	"strings"
+	"sparse/src/charclass"
+	"sparse/src/regex"
+	"sparse/src/trie"
 	"unicode"
 )
 
@@ -38,43 +40,46 @@ var Any Parser = func(input []rune) *Tree {
 
 // OneOf matches any of the runes in s.
 func OneOf(s string) Parser {
-	// TODO: maybe use a bit map if the runes are all small.
-	m := make(map[rune]bool)
-	for _, c := range s {
-		m[c] = true
+	return InClass(charclass.Runes(s))
+}
+
+// ZeroOrMoreOf returns a parser that matches the longest prefix that consists
+// of runes that are in s.
+func ZeroOrMoreOf(s string) Parser {
+	c := charclass.Runes(s)
+	return func(input []rune) *Tree {
+		return &Tree{Runes: input[:c.Span(input)]}
 	}
+}
+
+// InClass returns a parser that matches any single rune in c.
+func InClass(c charclass.Class) Parser {
 	return func(input []rune) *Tree {
-		if len(input) == 0 {
+		if len(input) == 0 || !c.Contains(input[0]) {
 			return nil
 		}
-		_, ok := m[input[0]]
-		if ok {
-			return &Tree{Runes: input[:1]}
-		}
-		return nil
+		return &Tree{Runes: input[:1]}
 	}
 }
 
-// ZeroOrMoreOf returns a parser that matches the longest prefix that consists
-// of runes that are in s.
-func ZeroOrMoreOf(s string) Parser {
-	// TODO: maybe use a bit map if the runes are all small.
-	m := make(map[rune]bool)
-	for _, c := range s {
-		m[c] = true
-	}
+// RunOf returns a parser that matches one or more runes in c.
+func RunOf(c charclass.Class) Parser {
 	return func(input []rune) *Tree {
-		pos := 0
-		for pos < len(input) {
-			if _, ok := m[input[pos]]; !ok {
-				return &Tree{Runes: input[:pos]}
-			}
-			pos++
+		length := c.Span(input)
+		if length == 0 {
+			return nil
 		}
-		return &Tree{Runes: input}
+		return &Tree{Runes: input[:length]}
 	}
 }
 
+// Class returns a parser that matches a single rune in the character class
+// described by spec, e.g., Class("[a-zA-Z_]") or Class(`\p{Greek}`). See
+// [charclass.Parse] for the syntax. It panics if spec is invalid.
+func Class(spec string) Parser {
+	return InClass(charclass.MustParse(spec))
+}
+
 // Tagged returns a new parser that matches exactly what p matches. However, if p
 // succeeds, the resulting parse tree will be tagged with the specified tag instead
 // of the default ("").
@@ -201,31 +206,83 @@ var WS Parser = func(input []rune) *Tree {
 
 // Exactly returns a parser that succeeds when s is a prefix of the input.
 func Exactly(s string) Parser {
+	target := []rune(s)
 	return func(input []rune) *Tree {
-		var length = 0
-		for index, r := range s {
-			if index >= len(input) || input[index] != r {
+		if len(input) < len(target) {
+			return nil
+		}
+		for k, r := range target {
+			if input[k] != r {
 				return nil
 			}
-			length++
 		}
-		return &Tree{Runes: input[:length]}
+		return &Tree{Runes: input[:len(target)]}
 	}
 }
 
 // IgnoreCase returns a parser that succeeds when s is a prefix of input ignoring case.
-// [unicode.ToLower] is used to canonicalize case.
+// Case is compared using Unicode simple case folding, which maps each rune to a
+// single rune, so the match is always as long as s.
 func IgnoreCase(s string) Parser {
-	target := strings.ToLower(s)
+	target := []rune(s)
 	return func(input []rune) *Tree {
-		var length = 0
-		for index, r := range target {
-			if index >= len(input) || unicode.ToLower(input[index]) != r {
+		if len(input) < len(target) {
+			return nil
+		}
+		for k, r := range target {
+			if input[k] != r && trie.Fold(input[k]) != trie.Fold(r) {
 				return nil
 			}
-			length++
 		}
-		return &Tree{Runes: input[:length]}
+		return &Tree{Runes: input[:len(target)]}
+	}
+}
+
+// Literals returns a parser that matches the longest of words that is a
+// prefix of the input, scanning the input once no matter how many words there
+// are. The result is tagged with the word that matched, so in a Seq it shows
+// up as a child.
+func Literals(words ...string) Parser {
+	return literals(trie.New(words...))
+}
+
+// LiteralsIgnoreCase is like [Literals], but matches without regard to case,
+// using Unicode simple case folding. The result is tagged with the word as
+// it was given, not as it appears in the input.
+func LiteralsIgnoreCase(words ...string) Parser {
+	return literals(trie.NewFolded(words...))
+}
+
+func literals(words *trie.Trie) Parser {
+	return func(input []rune) *Tree {
+		m, ok := words.Longest(input)
+		if !ok {
+			return nil
+		}
+		return &Tree{Runes: input[:m.Length], Tag: words.Word(m.Word)}
+	}
+}
+
+// Regex returns a parser that matches the regular expression pattern, which
+// uses the syntax of package regexp, against a prefix of the input. The
+// result has a child for each named group that participated in the match,
+// tagged with the group's name. Unnamed groups are not included. Regex panics
+// if pattern is invalid.
+func Regex(pattern string) Parser {
+	re := regex.MustCompile(pattern)
+	names := re.SubexpNames()
+	return func(input []rune) *Tree {
+		length, groups := re.MatchPrefix(input)
+		if length < 0 {
+			return nil
+		}
+		var children []*Tree
+		for k, name := range names {
+			if name != "" && groups[2*k] >= 0 {
+				children = append(children, &Tree{Runes: input[groups[2*k]:groups[2*k+1]], Tag: name})
+			}
+		}
+		return &Tree{Runes: input[:length], Children: children}
 	}
 }
 
@@ -253,6 +310,32 @@ func (p Parser) NonEmpty() Parser {
 	}
 }
 
+// Where returns a parser that matches what p matches, provided accept returns
+// true for the result. E.g.,
+//
+//	Where(Digits, func(t *Tree) bool { return len(t.Runes) <= 3 })
+//
+// matches up to three digits, and fails on "1234".
+func Where(p Parser, accept func(tree *Tree) bool) Parser {
+	return func(input []rune) *Tree {
+		t := p(input)
+		if t == nil || !accept(t) {
+			return nil
+		}
+		return t
+	}
+}
+
+// Check is like [Where], but check returns an error to reject the result.
+// Since sparse parsers don't report errors, the error is only used to decide
+// whether to fail; Check is convenient when the check is written in terms of a
+// function like [strconv.ParseInt] that returns one.
+func Check(p Parser, check func(tree *Tree) error) Parser {
+	return Where(p, func(tree *Tree) bool {
+		return check(tree) == nil
+	})
+}
+
 // Seq returns a [Parser] that matches a sequence of parsers, left-to-right.
 // If it succeeds, the result will have one child for each of the parameters
 // that are tagged. E.g., if
@@ -608,6 +608,22 @@ func TestIgnoreCase(t *testing.T) {
 			input:    "lower than that",
 			parser:   IgnoreCase("Lower Case"),
 			expected: nil,
+		}, {
+			input:    "ÉCOLE normale",
+			parser:   IgnoreCase("école"),
+			expected: &Tree{Runes: []rune("ÉCOLE")},
+		}, {
+			input:    "ΣΊΣΥΦΟΣ",
+			parser:   IgnoreCase("σίσυφος"),
+			expected: &Tree{Runes: []rune("ΣΊΣΥΦΟΣ")},
+		}, {
+			input:    "İstanbul",
+			parser:   IgnoreCase("İSTANBUL"),
+			expected: &Tree{Runes: []rune("İstanbul")},
+		}, {
+			input:    "low",
+			parser:   IgnoreCase("lower"),
+			expected: nil,
 		},
 	}
 	for _, tt := range tests {
@@ -0,0 +1,33 @@
+package sparse
+
+import (
+	"github.com/shoenig/test"
+	"testing"
+)
+
+func TestRegex(t *testing.T) {
+	testCases := []struct {
+		input    string
+		parser   Parser
+		expected *Tree
+	}{
+		{"3.25e-2+1", Regex(`[0-9]+(\.[0-9]+)?([eE][-+]?[0-9]+)?`), &Tree{Runes: []rune("3.25e-2")}},
+		{"x", Regex(`[0-9]+`), nil},
+		{"key=val;", Regex(`(?P<key>\w+)=(?P<val>\w+)`), &Tree{
+			Runes: []rune("key=val"),
+			Children: []*Tree{
+				{Runes: []rune("key"), Tag: "key"},
+				{Runes: []rune("val"), Tag: "val"},
+			},
+		}},
+		{"12", Regex(`(?P<int>\d+)(\.(?P<frac>\d+))?`), &Tree{
+			Runes:    []rune("12"),
+			Children: []*Tree{{Runes: []rune("12"), Tag: "int"}},
+		}},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.input, func(t *testing.T) {
+			test.Eq(t, tt.expected, tt.parser([]rune(tt.input)))
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package sparse
+
+import "sparse/src/internal/decode"
+
+// An Unmarshaler fills itself from a parse tree. Unmarshal calls its
+// UnmarshalTree method, with a pointer receiver, instead of filling it.
+type Unmarshaler interface {
+	UnmarshalTree(t *Tree) error
+}
+
+// An UnmarshalError describes a tree that Unmarshal couldn't store in a Go
+// value, such as "x" in an int. Its Pos is the position of the tree's runes
+// in the input.
+type UnmarshalError = decode.Error
+
+// Unmarshal stores t, the result of a parse, in the value that v points to.
+// Strings get the runes of a tree, numbers and bools are parsed from them,
+// slices get one element per child, and the exported fields of structs are
+// filled from the descendants with the same tag, or the one in a
+// `parse:"name"` struct tag. See speg.Unmarshal for the details, which are
+// the same.
+//
+// Since sparse trees don't record positions, the position of a tree in an
+// UnmarshalError is found from its runes, which are a slice of the input, so
+// t must be the tree for the whole parse. A tree without runes, such as one
+// built by Wrap without children, is placed where the next tree in t that has
+// runes begins, or at the end of the input if there is none.
+func Unmarshal(t *Tree, v any) error {
+	d := decode.Tree[*Tree]{
+		Tag:  func(t *Tree) string { return t.Tag },
+		Text: (*Tree).String,
+		Children: func(t *Tree) []*Tree {
+			return t.Children
+		},
+		Pos: func(n *Tree) int {
+			return position(t, n)
+		},
+	}
+	return d.Unmarshal(t, v)
+}
+
+// position returns the position of n in the input that root matched.
+func position(root, n *Tree) int {
+	if n.Runes != nil {
+		return cap(root.Runes) - cap(n.Runes)
+	}
+	seen := false
+	for _, u := range root.Preorder() {
+		if u == n {
+			seen = true
+		} else if seen && u.Runes != nil {
+			return cap(root.Runes) - cap(u.Runes)
+		}
+	}
+	return cap(root.Runes)
+}
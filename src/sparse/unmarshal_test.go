@@ -0,0 +1,98 @@
+package sparse
+
+import (
+	"github.com/shoenig/test"
+	"strconv"
+	"testing"
+)
+
+type entry struct {
+	Key    string `parse:"key"`
+	Values []int  `parse:"values,list"`
+	Debug  bool
+}
+
+// entries matches entries like "a=1, 2; debug b=3;".
+func entries() Parser {
+	ws := ZeroOrMoreOf(" ")
+	value := Class(`[0-9a-z]`).Tagged("value")
+	debug := Optional(Seq(Exactly("debug"), ws).Tagged("debug"))
+	values := OneOrMore(ws, value, Optional(Exactly(","))).Tagged("values")
+	entry := Seq(ws, debug, Letters.Tagged("key"), Exactly("="), values, Exactly(";")).Tagged("entry")
+	return ZeroOrMore(entry)
+}
+
+func TestUnmarshal(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []entry
+	}{
+		{"empty", "", []entry{}},
+		{"entries", "a=1, 2; bb=3;", []entry{{"a", []int{1, 2}, false}, {"bb", []int{3}, false}}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var es []entry
+			test.NoError(t, Unmarshal(entries()([]rune(tc.input)), &es))
+			test.Eq(t, tc.expected, es)
+		})
+	}
+}
+
+func TestUnmarshalError(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		pos      int
+		expected string
+	}{
+		{"int", "a=1; b=1, x;", 10, `cannot unmarshal "x" at 10 into int: invalid syntax`},
+		{"bool", "a=1; debug b=2;", 5, `cannot unmarshal "debug " at 5 into bool: invalid syntax`},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var es []entry
+			err := Unmarshal(entries()([]rune(tc.input)), &es)
+			test.EqError(t, err, tc.expected)
+			test.Eq(t, tc.pos, err.(*UnmarshalError).Pos)
+		})
+	}
+}
+
+func TestUnmarshalErrorWithoutRunes(t *testing.T) {
+	// A debug flag without runes, added to the entry for b, has no position
+	// of its own, so it is reported where what follows it begins.
+	addDebug := func(c *Cursor, t *Tree) *Tree {
+		if t.Tag == "entry" && t.Get("key").String() == "b" {
+			result := *t
+			result.Children = append([]*Tree{Wrap("debug")}, t.Children...)
+			return &result
+		}
+		return t
+	}
+	addEmpty := func(c *Cursor, t *Tree) *Tree {
+		if t.Tag == "entry" {
+			result := *t
+			result.Children = append(t.Children[:len(t.Children):len(t.Children)], Wrap("debug"))
+			return &result
+		}
+		return t
+	}
+	tests := []struct {
+		name    string
+		input   string
+		rewrite func(c *Cursor, t *Tree) *Tree
+		pos     int
+	}{
+		{"before other trees", "a=1; b=2;", addDebug, 5},
+		{"at the end", "a=1;", addEmpty, 4},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var es []entry
+			err := Unmarshal(Rewrite(entries()([]rune(tc.input)), tc.rewrite), &es)
+			test.EqError(t, err, `cannot unmarshal "" at `+strconv.Itoa(tc.pos)+` into bool: invalid syntax`)
+		})
+	}
+}
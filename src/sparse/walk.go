@@ -0,0 +1,91 @@
+package sparse
+
+import (
+	"iter"
+	"sparse/src/internal/traverse"
+)
+
+// A Cursor describes a tree during a traversal by Walk, Preorder, Postorder
+// or Rewrite: Tree, Parent, Path and Index tell where it is, and
+// SkipChildren, in a Preorder loop, skips its children. It is only valid
+// until the traversal moves on.
+type Cursor = traverse.Cursor[*Tree]
+
+// An Action tells Walk how to go on after visiting a tree.
+type Action = traverse.Action
+
+const (
+	// Continue goes on to the children of the tree, and then the rest.
+	Continue = traverse.Continue
+	// SkipChildren goes on without visiting the children of the tree.
+	SkipChildren = traverse.SkipChildren
+	// Stop ends the traversal.
+	Stop = traverse.Stop
+)
+
+func children(t *Tree) []*Tree {
+	return t.Children
+}
+
+// Walk visits t and its descendants, depth first. It calls pre, if it isn't
+// nil, before visiting the children of each tree, and post, if it isn't nil,
+// after. Post is called even if pre skipped the children. It returns false
+// if pre or post returned Stop.
+func Walk(t *Tree, pre, post func(c *Cursor) Action) bool {
+	return traverse.Walk(t, children, pre, post)
+}
+
+// Preorder returns an iterator over t and its descendants, each before its
+// children. Calling SkipChildren on the cursor skips the children of the
+// current tree.
+func (t *Tree) Preorder() iter.Seq2[*Cursor, *Tree] {
+	return traverse.Preorder(t, children)
+}
+
+// Postorder returns an iterator over t and its descendants, each after its
+// children.
+func (t *Tree) Postorder() iter.Seq2[*Cursor, *Tree] {
+	return traverse.Postorder(t, children)
+}
+
+// Rewrite returns t rebuilt from the bottom up by f. For each tree, f gets a
+// cursor at the original tree, and the tree with its children already
+// rewritten, and returns its replacement: the tree itself, a new tree, say
+// one made with Wrap, or nil to delete it.
+//
+// Trees whose children changed are copied, so t isn't modified. The Runes of
+// a copy are fitted to its new children, provided they are slices of the same
+// input: they are extended to cover new children, and shrink when a child at
+// either end is deleted.
+func Rewrite(t *Tree, f func(c *Cursor, t *Tree) *Tree) *Tree {
+	return traverse.Rewrite(t, children, rebuild, f)
+}
+
+func rebuild(t *Tree, children []*Tree) *Tree {
+	result := *t
+	result.Children = children
+	result.Runes = traverse.Fit(t.Runes, runesOf(t.Children), runesOf(children))
+	return &result
+}
+
+func runesOf(trees []*Tree) [][]rune {
+	result := make([][]rune, len(trees))
+	for k, t := range trees {
+		result[k] = t.Runes
+	}
+	return result
+}
+
+// Wrap returns a tree tagged tag with the given children, whose Runes cover
+// theirs. The children must be slices of the same input.
+func Wrap(tag string, children ...*Tree) *Tree {
+	result := &Tree{Tag: tag, Children: children}
+	for _, child := range children {
+		if result.Runes == nil {
+			result.Runes = child.Runes
+			continue
+		}
+		result.Runes, _ = traverse.Cover(result.Runes, child.Runes)
+	}
+	return result
+}
@@ -0,0 +1,77 @@
+package sparse
+
+import (
+	"github.com/shoenig/test"
+	"testing"
+)
+
+// listParser matches nested lists like "[a[b c]d]".
+func listParser() Parser {
+	var list Parser
+	item := FirstOf(Letters.Tagged("word"), Deref(&list), Exactly(" "))
+	list = Seq(Exactly("["), ZeroOrMore(item).Tagged("items"), Exactly("]")).Tagged("list")
+	return list
+}
+
+func TestWalk(t *testing.T) {
+	tree := listParser()([]rune("[a[b c]d]"))
+	test.NotNil(t, tree)
+	var events []string
+	Walk(tree, func(c *Cursor) Action {
+		events = append(events, "<"+c.Tree().String())
+		if c.Depth() > 0 && c.Tree().Tag == "list" {
+			return SkipChildren
+		}
+		return Continue
+	}, func(c *Cursor) Action {
+		events = append(events, c.Tree().String()+">")
+		return Continue
+	})
+	test.Eq(t, []string{"<[a[b c]d]", "<a[b c]d", "<a", "a>", "<[b c]", "[b c]>", "<d", "d>", "a[b c]d>", "[a[b c]d]>"}, events)
+}
+
+func TestIterators(t *testing.T) {
+	tree := listParser()([]rune("[a[b c]d]"))
+	var pre, post []string
+	for c, n := range tree.Preorder() {
+		if n.Tag == "word" {
+			pre = append(pre, n.String()+":"+c.Path()[c.Depth()-2].String())
+		}
+	}
+	for _, n := range tree.Postorder() {
+		post = append(post, n.String())
+	}
+	test.Eq(t, []string{"a:[a[b c]d]", "b:[b c]", "c:[b c]", "d:[a[b c]d]"}, pre)
+	test.Eq(t, []string{"a", "b", "c", "b c", "[b c]", "d", "a[b c]d", "[a[b c]d]"}, post)
+}
+
+func TestRewrite(t *testing.T) {
+	tree := listParser()([]rune("[a[b c]d]"))
+	// Replace nested lists with wrappers around their items, without the
+	// brackets.
+	flat := Rewrite(tree, func(c *Cursor, t *Tree) *Tree {
+		if c.Depth() > 0 && t.Tag == "list" {
+			return Wrap("pair", t.Children...)
+		}
+		return t
+	})
+	var words []string
+	for _, n := range flat.Preorder() {
+		words = append(words, n.Tag+"="+n.String())
+	}
+	test.Eq(t, []string{"list=[a[b c]d]", "items=a[b c]d", "word=a", "pair=b c", "items=b c", "word=b", "word=c", "word=d"}, words)
+
+	// Deleting the words at the ends of the items shrinks them, but the
+	// brackets of the nested list, which aren't children, are kept.
+	empty := Rewrite(tree, func(c *Cursor, t *Tree) *Tree {
+		if t.Tag == "word" {
+			return nil
+		}
+		return t
+	})
+	items := empty.Children[0]
+	test.Eq(t, "[b c]", items.String())
+	test.Len(t, 1, items.Children)
+	test.Len(t, 0, items.Children[0].Children[0].Children)
+	test.Len(t, 3, tree.Children[0].Children)
+}
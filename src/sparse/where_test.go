@@ -0,0 +1,37 @@
+package sparse
+
+import (
+	"github.com/shoenig/test"
+	"strconv"
+	"testing"
+)
+
+func TestWhere(t *testing.T) {
+	small := Where(Digits, func(t *Tree) bool { return len(t.Runes) <= 3 })
+	i32 := Check(Digits, func(t *Tree) error {
+		_, err := strconv.ParseInt(string(t.Runes), 10, 32)
+		return err
+	})
+	name := Letters.Tagged("name")
+	element := Where(Seq(Exactly("<"), name, Exactly(">"), Letters, Exactly("</"), name, Exactly(">")), func(t *Tree) bool {
+		return string(t.Children[0].Runes) == string(t.Children[1].Runes)
+	})
+	testCases := []struct {
+		input    string
+		parser   Parser
+		expected string
+	}{
+		{"123", small, "123"},
+		{"1234", small, ""},
+		{"2147483647", i32, "2147483647"},
+		{"2147483648", i32, ""},
+		{"<b>bold</b>", element, "<b>bold</b>"},
+		{"<b>bold</i>", element, ""},
+		{"abc", FirstOf(small, Letters), "abc"},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.input, func(t *testing.T) {
+			test.Eq(t, tt.expected, tt.parser([]rune(tt.input)).String())
+		})
+	}
+}
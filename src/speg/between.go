@@ -0,0 +1,82 @@
+package speg
+
+import "github.com/google/uuid"
+
+type BetweenParser struct {
+	id     uuid.UUID
+	open   Parser
+	parser Parser
+	close  Parser
+}
+
+func (b BetweenParser) Omit() Parser {
+	return Omit(b)
+}
+
+func (b BetweenParser) Star() Parser {
+	return Star(b)
+}
+
+func (b BetweenParser) Flatten() TokenParser {
+	return Token(b)
+}
+
+func (b BetweenParser) ID() uuid.UUID {
+	return b.id
+}
+
+func (b BetweenParser) Tagged(tag string) TaggedParser {
+	return Tagged(b, tag)
+}
+
+func (b BetweenParser) Parse(input []rune, start int, ctx *Context) *Tree {
+	cached, ok := ctx.getCachedValue(b.id, start)
+	if ok {
+		return cached
+	}
+	if err := ctx.pushActive(b, start); err != nil {
+		ctx.forget(b.id, start)
+		return nil
+	}
+	defer ctx.popActive()
+
+	var result *Tree
+	pos := start
+	if open := ctx.parse(b.open, input, pos); open != nil {
+		pos += len(open.Match)
+		if inner := ctx.parse(b.parser, input, pos); inner != nil {
+			pos += len(inner.Match)
+			if end := ctx.parse(b.close, input, pos); end != nil {
+				pos += len(end.Match)
+				var children, nodes []*Tree
+				if ctx.withChildren {
+					children = []*Tree{inner}
+				}
+				if ctx.lossless {
+					nodes = []*Tree{open, inner, end}
+				}
+				result = &Tree{
+					Start:    start,
+					Match:    input[start:pos],
+					Children: children,
+					Nodes:    nodes,
+				}
+			}
+		}
+	}
+	ctx.setCachedValue(b.id, start, result)
+	return result
+}
+
+// Between returns a parser that matches open, then p, then close. The result
+// has a single child, the tree from p. It is the same as
+//
+//	Seq(open.Omit(), p, close.Omit())
+func Between(open, p, close Parser) BetweenParser {
+	return BetweenParser{
+		id:     uuid.New(),
+		open:   open,
+		parser: p,
+		close:  close,
+	}
+}
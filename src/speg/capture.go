@@ -0,0 +1,196 @@
+package speg
+
+import (
+	"github.com/google/uuid"
+	"maps"
+	"sparse/src/trie"
+	"strconv"
+)
+
+// captures holds the text most recently captured under each name. It is
+// immutable, and kept in the user state under capturesKey, so captures are
+// undone on backtracking like any other change to the state. Only the latest
+// capture of each name is kept, so the state doesn't grow with the input.
+type captures struct {
+	texts map[string][]rune
+}
+
+type capturesKey struct{}
+
+func (c *captures) lookup(name string) ([]rune, bool) {
+	if c == nil {
+		return nil, false
+	}
+	text, ok := c.texts[name]
+	return text, ok
+}
+
+// with returns a copy of c in which name is bound to text.
+func (c *captures) with(name string, text []rune) *captures {
+	result := &captures{texts: make(map[string][]rune)}
+	if c != nil {
+		maps.Copy(result.texts, c.texts)
+	}
+	result.texts[name] = text
+	return result
+}
+
+func currentCaptures(ctx *Context) *captures {
+	c, _ := ctx.Value(capturesKey{}).(*captures)
+	return c
+}
+
+// A CaptureParser matches what its parser matches and remembers the text
+// under a name, for BackRef. Build one with Capture.
+type CaptureParser struct {
+	id     ID
+	name   string
+	parser Parser
+}
+
+// Capture returns a parser that matches what p matches, and records the text
+// it matched under name. A later BackRef(name) matches the same text again:
+//
+//	heredoc := Seq(Exactly("<<"), Capture("end", Letters()), Exactly("\n"),
+//		Star(Seq(Not(Seq(BackRef("end"), Exactly("\n"))), Any())),
+//		BackRef("end"), Exactly("\n"))
+//
+// The capture lasts until the end of the enclosing Scope, or of the parse,
+// and is replaced by a later capture with the same name. The result of
+// Capture is the result of p.
+func Capture(name string, p Parser) CaptureParser {
+	return CaptureParser{
+		id:     uuid.New(),
+		name:   name,
+		parser: p,
+	}
+}
+
+func (p CaptureParser) Parse(input []rune, start int, ctx *Context) *Tree {
+	cached, ok := ctx.getCachedValue(p.id, start)
+	if ok {
+		return cached
+	}
+	tree := ctx.parse(p.parser, input, start)
+	if tree != nil {
+		ctx.SetValue(capturesKey{}, currentCaptures(ctx).with(p.name, tree.Match))
+	}
+	ctx.setCachedValue(p.id, start, tree)
+	return tree
+}
+
+func (p CaptureParser) ID() uuid.UUID {
+	return p.id
+}
+
+func (p CaptureParser) Omit() Parser {
+	return Omit(p)
+}
+
+func (p CaptureParser) Tagged(tag string) TaggedParser {
+	return Tagged(p, tag)
+}
+
+// A BackRefParser matches text captured earlier by Capture. Build one with
+// BackRef.
+type BackRefParser struct {
+	id   ID
+	name string
+}
+
+// BackRef returns a parser that matches the text most recently captured under
+// name by Capture, within the current Scope. It fails if there is no such
+// capture. In a context that folds case (see FoldCase), the text is matched
+// without regard to case.
+func BackRef(name string) BackRefParser {
+	return BackRefParser{
+		id:   uuid.New(),
+		name: name,
+	}
+}
+
+func (p BackRefParser) Parse(input []rune, start int, ctx *Context) *Tree {
+	text, ok := currentCaptures(ctx).lookup(p.name)
+	if !ok {
+		ctx.expect(start, "capture "+strconv.Quote(p.name))
+		return nil
+	}
+	if len(input)-start < len(text) {
+		ctx.expect(start, strconv.Quote(string(text)))
+		return nil
+	}
+	for k, r := range text {
+		if c := input[start+k]; c != r && (!ctx.foldCase || trie.Fold(c) != trie.Fold(r)) {
+			ctx.expect(start, strconv.Quote(string(text)))
+			return nil
+		}
+	}
+	return &Tree{
+		Start: start,
+		Match: input[start : start+len(text)],
+	}
+}
+
+func (p BackRefParser) ID() uuid.UUID {
+	return p.id
+}
+
+func (p BackRefParser) Omit() Parser {
+	return Omit(p)
+}
+
+func (p BackRefParser) Tagged(tag string) TaggedParser {
+	return Tagged(p, tag)
+}
+
+// A ScopeParser limits the extent of the captures made by its parser. Build
+// one with Scope.
+type ScopeParser struct {
+	id     ID
+	parser Parser
+}
+
+// Scope returns a parser that matches what p matches, and then forgets the
+// captures made within p, so that captures made before it are visible again.
+// It is what makes nested constructs work:
+//
+//	var element Parser
+//	element = Scope(Seq(
+//		Exactly("<"), Capture("tag", name), Exactly(">"),
+//		Star(Indirect(&element)),
+//		Exactly("</"), BackRef("tag"), Exactly(">"),
+//	))
+//
+// Without the Scope, the closing tag of <a><b></b></a> would have to be
+// </b>, since the inner element captured "b" last.
+func Scope(p Parser) ScopeParser {
+	return ScopeParser{
+		id:     uuid.New(),
+		parser: p,
+	}
+}
+
+func (p ScopeParser) Parse(input []rune, start int, ctx *Context) *Tree {
+	outer := currentCaptures(ctx)
+	tree := ctx.parse(p.parser, input, start)
+	if tree != nil && currentCaptures(ctx) != outer {
+		ctx.SetValue(capturesKey{}, outer)
+	}
+	return tree
+}
+
+func (p ScopeParser) ID() uuid.UUID {
+	return p.id
+}
+
+func (p ScopeParser) Omit() Parser {
+	return Omit(p)
+}
+
+func (p ScopeParser) Star() Parser {
+	return Star(p)
+}
+
+func (p ScopeParser) Tagged(tag string) TaggedParser {
+	return Tagged(p, tag)
+}
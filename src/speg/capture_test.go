@@ -0,0 +1,116 @@
+package speg
+
+import (
+	"fmt"
+	"github.com/shoenig/test"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBackRef(t *testing.T) {
+	heredoc := Seq(Exactly("<<").Omit(), Capture("end", Letters()).Omit(), Exactly("\n").Omit(),
+		Token(Star(Seq(Not(Seq(BackRef("end"), Exactly("\n"))), Any()))).Tagged("body"),
+		BackRef("end").Omit(), Exactly("\n").Omit())
+	hashes := Star(Exactly("#"))
+	raw := Seq(Exactly("r"), Capture("hashes", hashes), Exactly(`"`),
+		Token(Star(Seq(Not(Seq(Exactly(`"`), BackRef("hashes"))), Any()))).Tagged("text"),
+		Exactly(`"`), BackRef("hashes"))
+	tests := []struct {
+		name     string
+		parser   Parser
+		input    string
+		expected string
+	}{
+		{"heredoc", heredoc, "<<EOF\nline\nEOF is here\nEOF\n", `((body "line\nEOF is here\n"))`},
+		{"heredoc unterminated", heredoc, "<<EOF\nline\nEOT\n", `<nil>`},
+		{"raw", raw, `r#"say "hi""#`, `("r" "#" "\"" (text "say \"hi\"") "\"" "#")`},
+		{"raw no hashes", raw, `r"a#"`, `("r" "" "\"" (text "a#") "\"" "")`},
+		{"raw unterminated", raw, `r##"a"#`, `<nil>`},
+		{"no capture", BackRef("x"), "x", `<nil>`},
+		{"fold case", FoldCase(Seq(Capture("x", Letters()), Exactly("="), BackRef("x"))), "ab=AB", `("ab" "=" "AB")`},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			test.Eq(t, tc.expected, tc.parser.Parse([]rune(tc.input), 0, NewContext()).String())
+		})
+	}
+}
+
+// xmlGrammar returns a grammar for nested elements whose end tags must match
+// their start tags.
+func xmlGrammar() Parser {
+	var element Parser
+	element = Scope(Seq(
+		Exactly("<").Omit(), Capture("tag", Letters()).Tagged("tag"), Exactly(">").Omit(),
+		Star(Or(Indirect(&element), Letters())),
+		Exactly("</").Omit(), BackRef("tag").Omit(), Exactly(">").Omit(),
+	)).Tagged("element")
+	return Seq(element, Not(Any()).Omit())
+}
+
+func TestScope(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"flat", "<a>x</a>", `((element (tag "a") ("x")))`},
+		{"nested", "<a><b>x</b>y</a>", `((element (tag "a") ((element (tag "b") ("x")) "y")))`},
+		{"mismatched", "<a><b>x</a></b>", `<nil>`},
+		{"inner tag", "<a><b>x</b></b>", `<nil>`},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			test.Eq(t, tc.expected, xmlGrammar().Parse([]rune(tc.input), 0, NewContext()).String())
+		})
+	}
+}
+
+func TestCaptureBacktracking(t *testing.T) {
+	// The first alternative captures "ab" and then fails. The capture is
+	// undone, so the back-reference sees the capture of "a" instead.
+	p := Seq(Or(
+		Seq(Capture("x", Exactly("ab")), Exactly("!")),
+		Capture("x", Exactly("a")),
+	), Star(Exactly("b")), Exactly("|"), BackRef("x"))
+	test.Eq(t, `("a" "b" "|" "a")`, p.Parse([]rune("ab|a"), 0, NewContext()).String())
+	test.Eq(t, "ab|a", string(p.Parse([]rune("ab|ab"), 0, NewContext()).Match))
+}
+
+func TestGenerateBackRef(t *testing.T) {
+	g := NewGenerator(xmlGrammar(), 1)
+	for k := 0; k < 20; k++ {
+		_, err := g.Generate()
+		test.NoError(t, err)
+	}
+}
+
+func TestCaptureScales(t *testing.T) {
+	if testing.Short() {
+		t.Skip("timing test")
+	}
+	heredoc := Seq(Exactly("<<"), Capture("end", Letters()), Exactly("\n"),
+		Star(Seq(Not(Seq(BackRef("end"), Exactly("\n"))), Any())),
+		BackRef("end"), Exactly("\n"))
+	docs := Seq(Star(heredoc), Not(Any()))
+	elapsed := func(n int) time.Duration {
+		var input strings.Builder
+		for k := range n {
+			end := fmt.Sprintf("E%s", strings.Repeat("x", k%7+1)+string(rune('a'+k%26)))
+			fmt.Fprintf(&input, "<<%s\nline %d\n%s\n", end, k, end)
+		}
+		best := time.Duration(math.MaxInt64)
+		for range 3 {
+			start := time.Now()
+			test.NotNil(t, docs.Parse([]rune(input.String()), 0, NewContext()))
+			best = min(best, time.Since(start))
+		}
+		return best
+	}
+	// Four times the input should take about four times as long, not the
+	// sixteen or more of a quadratic parse.
+	small, large := elapsed(250), elapsed(1000)
+	test.Less(t, 10*small, large, test.Sprintf("250 heredocs took %v, 1000 took %v", small, large))
+}
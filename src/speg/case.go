@@ -0,0 +1,63 @@
+package speg
+
+import "github.com/google/uuid"
+
+// A CaseParser runs its parser with case folding turned on or off. Build one
+// with FoldCase or MatchCase.
+type CaseParser struct {
+	id     ID
+	parser Parser
+	fold   bool
+}
+
+// FoldCase returns a parser that matches what parser matches, except that
+// the literal matchers within it (Exactly, Literals, Keyword and the like)
+// match without regard to case, using Unicode simple case folding. It is
+// meant for languages like SQL whose keywords aren't case sensitive:
+//
+//	query := FoldCase(Seq(Keyword("select"), columns, Keyword("from"), table))
+//
+// Matchers that don't match literal text, like Letters or Regex, are not
+// affected. To fold case for an entire parse, use Context.FoldingCase.
+func FoldCase(parser Parser) CaseParser {
+	return CaseParser{
+		id:     uuid.New(),
+		parser: parser,
+		fold:   true,
+	}
+}
+
+// MatchCase returns a parser that matches what parser matches with case
+// folding turned off, even within FoldCase. It is useful for parts of a
+// grammar like string literals.
+func MatchCase(parser Parser) CaseParser {
+	return CaseParser{
+		id:     uuid.New(),
+		parser: parser,
+	}
+}
+
+func (p CaseParser) Parse(input []rune, start int, ctx *Context) *Tree {
+	if ctx.foldCase != p.fold {
+		result := *ctx
+		result.foldCase = p.fold
+		ctx = &result
+	}
+	return ctx.parse(p.parser, input, start)
+}
+
+func (p CaseParser) ID() uuid.UUID {
+	return p.id
+}
+
+func (p CaseParser) Omit() Parser {
+	return Omit(p)
+}
+
+func (p CaseParser) Star() Parser {
+	return Star(p)
+}
+
+func (p CaseParser) Tagged(tag string) TaggedParser {
+	return Tagged(p, tag)
+}
@@ -0,0 +1,67 @@
+package speg
+
+import (
+	"github.com/shoenig/test"
+	"testing"
+)
+
+func TestIgnoreCase(t *testing.T) {
+	tests := []struct {
+		name     string
+		parser   Parser
+		input    string
+		expected string
+	}{
+		{"same case", IgnoreCase("select"), "select *", `"select"`},
+		{"upper case", IgnoreCase("select"), "SELECT *", `"SELECT"`},
+		{"mixed case", IgnoreCase("Select"), "sElEcT *", `"sElEcT"`},
+		{"greek", IgnoreCase("σίσυφος"), "ΣΊΣΥΦΟΣ", `"ΣΊΣΥΦΟΣ"`},
+		{"dotted capital I", IgnoreCase("İSTANBUL"), "İstanbul", `"İstanbul"`},
+		{"kelvin sign", IgnoreCase("k"), "K", `"K"`},
+		{"too short", IgnoreCase("select"), "SELEC", `<nil>`},
+		{"different", IgnoreCase("select"), "insert", `<nil>`},
+		{"exactly non-ascii", Exactly("école"), "école", `"école"`},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			test.Eq(t, tc.expected, tc.parser.Parse([]rune(tc.input), 0, NewContext()).String())
+		})
+	}
+}
+
+func TestFoldCase(t *testing.T) {
+	query := FoldCase(Seq(
+		Keyword("select").Tagged("select"),
+		Token(Literals("*", "count")).Tagged("what"),
+		Token(Keyword("from")).Tagged("from"),
+		Token(Identifier("select", "from", "where")).Tagged("table"),
+		Opt(Seq(Token(Keyword("where")), Token(Exactly("name=")), MatchCase(Seq(Exactly("'"), IgnoreCase("x"), Exactly("'"))))),
+	))
+	tests := []struct {
+		name     string
+		parser   Parser
+		input    string
+		expected string
+	}{
+		{"lower", query, "select * from t", `((select "select") (what (* "*")) (from "from") (table "t") "")`},
+		{"upper", query, "SELECT COUNT FROM t", `((select "SELECT") (what (count "COUNT")) (from "FROM") (table "t") "")`},
+		{"match case fails", FoldCase(Seq(Exactly("a"), MatchCase(Exactly("b")))), "AB", `<nil>`},
+		{"match case", FoldCase(Seq(Exactly("a"), MatchCase(Exactly("b")))), "Ab", `("A" "b")`},
+		{"reserved in any case", query, "select * from WHERE", `<nil>`},
+		{"ignore case within match case", query, "select * from t where NAME='X'", `((select "select") (what (* "*")) (from "from") (table "t") (("where") ("NAME=") ("'" "X" "'")))`},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			test.Eq(t, tc.expected, tc.parser.Parse([]rune(tc.input), 0, NewContext()).String())
+		})
+	}
+}
+
+func TestFoldingCaseContext(t *testing.T) {
+	p := Seq(Exactly("begin"), Exactly(" "), Literals("end", "endif").Tagged("end"))
+	ctx := NewContext()
+	test.Nil(t, p.Parse([]rune("BEGIN ENDIF"), 0, ctx))
+	// The folding context has its own cache, so the failure above isn't reused.
+	test.Eq(t, `("BEGIN" " " (end "ENDIF"))`, p.Parse([]rune("BEGIN ENDIF"), 0, ctx.FoldingCase()).String())
+	test.Nil(t, p.Parse([]rune("BEGIN ENDIF"), 0, ctx))
+}
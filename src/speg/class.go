@@ -0,0 +1,52 @@
+package speg
+
+import (
+	"math/rand/v2"
+	"sparse/src/charclass"
+)
+
+// InClass matches a single rune in c.
+func InClass(c charclass.Class) Matcher {
+	result := NewMatcher(func(input []rune) int {
+		if len(input) == 0 || !c.Contains(input[0]) {
+			return -1
+		}
+		return 1
+	})
+	if !c.IsEmpty() {
+		result.generate = func(r *rand.Rand) []rune {
+			return []rune{c.Random(r)}
+		}
+	}
+	result.expected = c.String()
+	return result
+}
+
+// RunOf matches one or more runes in c.
+func RunOf(c charclass.Class) Matcher {
+	result := NewMatcher(func(input []rune) int {
+		length := c.Span(input)
+		if length == 0 {
+			return -1
+		}
+		return length
+	})
+	if !c.IsEmpty() {
+		result.generate = func(r *rand.Rand) []rune {
+			runes := make([]rune, 1+r.IntN(6))
+			for k := range runes {
+				runes[k] = c.Random(r)
+			}
+			return runes
+		}
+	}
+	result.expected = c.String() + "+"
+	return result
+}
+
+// Class matches a single rune in the character class described by spec,
+// e.g., Class("[a-zA-Z_]") or Class(`\p{Greek}`). See charclass.Parse for
+// the syntax. It panics if spec is invalid.
+func Class(spec string) Matcher {
+	return InClass(charclass.MustParse(spec)).Expecting(spec)
+}
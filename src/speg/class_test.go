@@ -0,0 +1,35 @@
+package speg
+
+import (
+	"github.com/shoenig/test"
+	"sparse/src/charclass"
+	"testing"
+)
+
+func TestClass(t *testing.T) {
+	tests := []struct {
+		name     string
+		parser   Parser
+		input    string
+		expected string
+	}{
+		{"class", Class("[a-f]"), "cat", `"c"`},
+		{"class fails", Class("[a-f]"), "xyz", `<nil>`},
+		{"negated", Class("[^a-f]"), "xyz", `"x"`},
+		{"greek", Class(`\p{Greek}`), "λx", `"λ"`},
+		{"run", RunOf(charclass.MustParse(`[\w]`)), "snake_case1 x", `"snake_case1"`},
+		{"run fails", RunOf(charclass.MustParse(`[\w]`)), " x", `<nil>`},
+		{"identifier", Token(Seq(Class("[a-zA-Z_]"), Star(Class(`[\w]`)))).Tagged("id"), "  _x1+", `(id "_x1")`},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			test.Eq(t, tc.expected, tc.parser.Parse([]rune(tc.input), 0, NewContext()).String())
+		})
+	}
+}
+
+func TestClassExpectation(t *testing.T) {
+	ctx := NewContext()
+	test.Nil(t, Class("[0-9a-f]").Parse([]rune("x"), 0, ctx))
+	test.EqError(t, ctx.Error(), "parse error at 0: expected [0-9a-f]")
+}
@@ -6,9 +6,17 @@ import (
 )
 
 type Context struct {
-	cache         Cache
+	memo          *memo
+	foldCase      bool
+	lossless      bool
+	skip          Parser
+	lexical       bool
 	activeParsers []ActiveParser
 	withChildren  bool
+	tracer        Tracer
+	coverage      *Coverage
+	failure       *failure
+	quiet         bool
 }
 
 // A Cache holds Trees previously produced for this input.
@@ -41,37 +49,172 @@ func (context *Context) isActive(parser Parser, start int) bool {
 	return false
 }
 
-func (context *Context) getCache(id ID) map[int]*Tree {
-	parserCache, ok := context.cache[id]
+// memoKey returns the key of the cache for the current modes and state.
+func (context *Context) memoKey(state *state) memoKey {
+	return memoKey{
+		foldCase:     context.foldCase,
+		lossless:     context.lossless,
+		withChildren: context.withChildren,
+		skip:         context.skipID(),
+		state:        state,
+	}
+}
+
+// getCache returns the cache of results of the parser with the given id for
+// the current case mode and a parse that began in state.
+func (context *Context) getCache(id ID, state *state) map[int]*Tree {
+	key := context.memoKey(state)
+	cache, ok := context.memo.caches[key]
+	if !ok {
+		cache = make(Cache)
+		context.memo.caches[key] = cache
+	}
+	parserCache, ok := cache[id]
 	if !ok {
 		parserCache = make(map[int]*Tree)
-		context.cache[id] = parserCache
+		cache[id] = parserCache
 	}
 	return parserCache
 }
 
+// getCachedValue looks up the result of the parser with the given id at pos
+// in the current state. If it's found, the state the parser left behind is
+// restored as well. If not, the current state is remembered so that
+// setCachedValue can file the result under it.
 func (context *Context) getCachedValue(id ID, pos int) (*Tree, bool) {
-	cache := context.getCache(id)
-	value, ok := cache[pos]
+	m := context.memo
+	value, ok := context.getCache(id, m.state)[pos]
+	if context.tracer != nil {
+		context.tracer.Memo(id, pos, ok)
+	}
+	if ok {
+		if exit, changed := m.exits[exitKey{context.memoKey(m.state), site{id, pos}}]; changed {
+			m.state = exit
+		}
+	} else {
+		s := site{id, pos}
+		m.entries[s] = append(m.entries[s], m.state)
+	}
 	return value, ok
 }
 
 func (context *Context) setCachedValue(id ID, pos int, value *Tree) {
-	context.getCache(id)[pos] = value
+	m := context.memo
+	entry, ok := context.popEntry(id, pos)
+	if !ok {
+		entry = m.state
+	}
+	context.getCache(id, entry)[pos] = value
+	if value != nil && m.state != entry {
+		m.exits[exitKey{context.memoKey(entry), site{id, pos}}] = m.state
+	}
+}
+
+// forget is called instead of setCachedValue by a parser that returns
+// without caching its result after getCachedValue didn't find it.
+func (context *Context) forget(id ID, pos int) {
+	context.popEntry(id, pos)
+}
+
+// popEntry removes the state in which the innermost running parser with the
+// given id at pos started from the entries, and returns it.
+func (context *Context) popEntry(id ID, pos int) (*state, bool) {
+	m := context.memo
+	s := site{id, pos}
+	entries := m.entries[s]
+	if len(entries) == 0 {
+		return nil, false
+	}
+	entry := entries[len(entries)-1]
+	if len(entries) == 1 {
+		delete(m.entries, s)
+	} else {
+		m.entries[s] = entries[:len(entries)-1]
+	}
+	return entry, true
 }
 
 func (context *Context) WithoutChildren() *Context {
-	return &Context{
-		cache:         context.cache,
-		activeParsers: context.activeParsers,
-		withChildren:  false,
+	if context.lossless {
+		return context
+	}
+	result := *context
+	result.withChildren = false
+	return &result
+}
+
+// WithTracer returns a new Context that shares this context's cache and
+// reports every parser invocation to tracer.
+func (context *Context) WithTracer(tracer Tracer) *Context {
+	result := *context
+	result.tracer = tracer
+	return &result
+}
+
+// WithCoverage returns a new Context that shares this context's cache and
+// records grammar coverage in coverage.
+func (context *Context) WithCoverage(coverage *Coverage) *Context {
+	result := *context
+	result.coverage = coverage
+	return &result
+}
+
+// FoldingCase returns a new Context that shares this context's cache and
+// in which literal matchers like Exactly, Literals and Keyword match without
+// regard to case. See FoldCase.
+func (context *Context) FoldingCase() *Context {
+	result := *context
+	result.foldCase = true
+	return &result
+}
+
+// Parse runs parser on input beginning at start. Unlike calling parser.Parse
+// directly, the top-level invocation is reported to the context's Tracer
+// and Coverage, and in a lossless parse, trailing trivia is attached.
+func (context *Context) Parse(parser Parser, input []rune, start int) *Tree {
+	result := context.parse(parser, input, start)
+	if context.lossless && result != nil {
+		result = attachTrailing(result, input)
+	}
+	return result
+}
+
+// parse is how combinators invoke their sub-parsers. It is equivalent to
+// parser.Parse(input, start, context), except that it notifies the tracer
+// and records coverage.
+//
+// If parser fails, any change it made to the state of the parse (see Indent)
+// is undone.
+func (context *Context) parse(parser Parser, input []rune, start int) *Tree {
+	before := context.memo.state
+	if context.tracer == nil && context.coverage == nil {
+		result := parser.Parse(input, start, context)
+		if result == nil {
+			context.memo.state = before
+		}
+		return result
+	}
+	if context.tracer != nil {
+		context.tracer.Enter(parser, start)
+	}
+	result := parser.Parse(input, start, context)
+	if result == nil {
+		context.memo.state = before
+	}
+	if context.tracer != nil {
+		context.tracer.Exit(parser, start, result)
+	}
+	if context.coverage != nil && result != nil {
+		context.coverage.matched(parser.ID())
 	}
+	return result
 }
 
 func NewContext() *Context {
 	return &Context{
-		cache:         make(map[ID]map[int]*Tree),
+		memo:          newMemo(),
 		activeParsers: []ActiveParser{},
 		withChildren:  true,
+		failure:       &failure{pos: -1},
 	}
 }
@@ -0,0 +1,133 @@
+package speg
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Coverage records which parts of a grammar have matched input. It is
+// typically shared by all the tests of a grammar:
+//
+//	var coverage = NewCoverage()
+//
+//	func TestSomething(t *testing.T) {
+//		tree := NewContext().WithCoverage(coverage).Parse(grammar, input, 0)
+//		...
+//	}
+//
+//	func TestMain(m *testing.M) {
+//		code := m.Run()
+//		coverage.WriteReport(os.Stdout, grammar)
+//		os.Exit(code)
+//	}
+//
+// A parser is covered if it matched at least once. An alternative of an Or is
+// covered if the Or matched by way of that alternative. An Opt has two
+// branches: it is fully covered once its parser has both matched and failed.
+//
+// Coverage is safe for concurrent use.
+type Coverage struct {
+	mu      sync.Mutex
+	parsers map[ID]bool
+	choices map[ID]map[int]bool
+}
+
+// NewCoverage returns an empty Coverage.
+func NewCoverage() *Coverage {
+	return &Coverage{
+		parsers: make(map[ID]bool),
+		choices: make(map[ID]map[int]bool),
+	}
+}
+
+func (c *Coverage) matched(id ID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.parsers[id] = true
+}
+
+// chose records that the parser with the given id took its k'th branch.
+func (c *Coverage) chose(id ID, k int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	choices, ok := c.choices[id]
+	if !ok {
+		choices = make(map[int]bool)
+		c.choices[id] = choices
+	}
+	choices[k] = true
+}
+
+// Covered reports whether parser has matched.
+func (c *Coverage) Covered(parser Parser) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.parsers[parser.ID()]
+}
+
+// Uncovered returns a description of each part of the grammar root that
+// was never exercised, in depth-first order. It returns nil if the grammar
+// is fully covered.
+func (c *Coverage) Uncovered(root Parser) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var result []string
+	walk(root, func(p Parser) {
+		if !c.parsers[p.ID()] {
+			result = append(result, fmt.Sprintf("%s never matched", describe(p)))
+			return
+		}
+		switch pp := p.(type) {
+		case OrParser:
+			for k, sub := range pp.subParsers {
+				if !c.choices[pp.id][k] {
+					result = append(result, fmt.Sprintf("%s alternative %d (%s) never chosen", describe(p), k, describe(sub)))
+				}
+			}
+		case OptionalParser:
+			if !c.choices[pp.id][boolIndex(true)] {
+				result = append(result, fmt.Sprintf("%s never matched its parser", describe(p)))
+			}
+			if !c.choices[pp.id][boolIndex(false)] {
+				result = append(result, fmt.Sprintf("%s never skipped its parser", describe(p)))
+			}
+		}
+	})
+	return result
+}
+
+// WriteReport writes a summary of the coverage of the grammar root,
+// followed by the list returned by Uncovered.
+func (c *Coverage) WriteReport(w io.Writer, root Parser) error {
+	total := 0
+	walk(root, func(p Parser) {
+		total++
+	})
+	uncovered := c.Uncovered(root)
+	c.mu.Lock()
+	covered := 0
+	walk(root, func(p Parser) {
+		if c.parsers[p.ID()] {
+			covered++
+		}
+	})
+	c.mu.Unlock()
+	if _, err := fmt.Fprintf(w, "%d of %d parsers matched, %d uncovered branches\n", covered, total, len(uncovered)-(total-covered)); err != nil {
+		return err
+	}
+	for _, line := range uncovered {
+		if _, err := fmt.Fprintf(w, "  %s\n", line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// boolIndex maps the two branches of an Opt to choice indexes.
+func boolIndex(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
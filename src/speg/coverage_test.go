@@ -0,0 +1,38 @@
+package speg
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/shoenig/test"
+)
+
+func TestCoverage(t *testing.T) {
+	number := Digits().Tagged("num")
+	word := Letters().Tagged("word")
+	minus := Exactly("-")
+	sign := Opt(minus)
+	grammar := Or(Seq(sign, number), word)
+
+	coverage := NewCoverage()
+	ctx := NewContext().WithCoverage(coverage)
+	test.NotNil(t, ctx.Parse(grammar, []rune("12"), 0))
+
+	test.True(t, coverage.Covered(grammar))
+	test.True(t, coverage.Covered(number))
+	test.False(t, coverage.Covered(word))
+	test.Eq(t, []string{
+		describe(grammar) + " alternative 1 (" + describe(word) + ") never chosen",
+		describe(sign) + " never matched its parser",
+		describe(minus) + " never matched",
+		describe(word) + " never matched",
+	}, coverage.Uncovered(grammar))
+
+	test.NotNil(t, NewContext().WithCoverage(coverage).Parse(grammar, []rune("-3"), 0))
+	test.NotNil(t, NewContext().WithCoverage(coverage).Parse(grammar, []rune("abc"), 0))
+	test.Nil(t, coverage.Uncovered(grammar))
+
+	var report bytes.Buffer
+	test.NoError(t, coverage.WriteReport(&report, grammar))
+	test.StrContains(t, report.String(), "0 uncovered branches")
+}
@@ -0,0 +1,356 @@
+package speg
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+// GrammarFor returns a parser derived from the struct type T, whose results
+// Unmarshal stores in a T, so that the grammar and the type can't drift
+// apart. The grammar is declared in `grammar` struct tags, in a notation like
+// that of the participle library:
+//
+//	type Let struct {
+//		Name  string `grammar:"'let' @ '='"`
+//		Value *Expr  `grammar:"@ ';'"`
+//	}
+//
+// The tags of the fields are concatenated, in order, to form the grammar of
+// the struct, which may contain:
+//
+//   - 'text' or \"text\", a literal token, which is matched and dropped. A
+//     literal that is a word only matches a whole word, as with Keyword.
+//   - @, which matches a value of the type of the field it appears in and
+//     stores it there. Strings are identifiers, numbers and bools are the
+//     usual literals, structs are matched by their own grammars, and the
+//     elements of slices and pointers are matched by the grammars of their
+//     types. Each match of @ for a slice field appends an element.
+//   - @ident, @int, @float and @string, which match an identifier, an
+//     integer, a floating point number or a double-quoted string, whatever
+//     the type of the field. Integers are decimal, so 010 is 10. The quotes
+//     of a string aren't stored, and its backslash escapes are stored as
+//     written, not decoded: a field type that implements Unmarshaler can
+//     decode them, say with strconv.Unquote.
+//   - @'text', which matches a literal token and stores its text.
+//   - Sequences, ( ) for grouping, | for alternatives, and the postfix
+//     operators *, + and ? for repetition and options.
+//
+// Since the tags are concatenated, an alternative can span fields:
+//
+//	type Value struct {
+//		Number *float64 `grammar:"@"`
+//		Name   *string  `grammar:"| @"`
+//		List   *List    `grammar:"| '[' @ ']'"`
+//	}
+//
+// Fields without a grammar tag aren't part of the grammar. Every token skips
+// leading whitespace, or within Skipping, the grammar's trivia. Recursive
+// types are allowed, but left-recursive grammars are not.
+//
+// The trees for values are tagged with the names Unmarshal looks for, which
+// are the names in `parse` tags, if any.
+func GrammarFor[T any]() (Parser, error) {
+	t := reflect.TypeFor[T]()
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("grammar: %s is not a struct", t)
+	}
+	b := &deriver{structs: make(map[reflect.Type]*Parser)}
+	return b.structParser(t)
+}
+
+// ParseInto parses all of input, but for trailing whitespace, with the
+// grammar GrammarFor derives from T, and stores the result in v. If the parse
+// fails, the error is a *ParseError.
+func ParseInto[T any](input []rune, v *T) error {
+	grammar, err := GrammarFor[T]()
+	if err != nil {
+		return err
+	}
+	ctx := NewContext()
+	tree := ctx.Parse(Seq(grammar, Token(endOfInput()).Omit()), input, 0)
+	if tree == nil {
+		if err := ctx.Error(); err != nil {
+			return err
+		}
+		// Nothing recorded why, as when the grammar is left-recursive.
+		return &ParseError{Pos: 0}
+	}
+	return Unmarshal(tree.Children[0], v)
+}
+
+// endOfInput matches the empty string at the end of the input.
+func endOfInput() Matcher {
+	return NewMatcher(func(input []rune) int {
+		if len(input) > 0 {
+			return -1
+		}
+		return 0
+	}).Expecting("end of input")
+}
+
+// A deriver builds the parsers for struct types.
+type deriver struct {
+	// structs holds the parser for each struct type, which is set once the
+	// struct's grammar has been built, so that recursive types can refer to
+	// it with Indirect.
+	structs map[reflect.Type]*Parser
+}
+
+func (d *deriver) structParser(t reflect.Type) (Parser, error) {
+	if p, ok := d.structs[t]; ok {
+		return Indirect(p), nil
+	}
+	p := new(Parser)
+	d.structs[t] = p
+	var tokens []grammarToken
+	for k := range t.NumField() {
+		field := t.Field(k)
+		spec, ok := field.Tag.Lookup("grammar")
+		if !ok {
+			continue
+		}
+		if !field.IsExported() {
+			return nil, fmt.Errorf("grammar: field %s of %s is not exported", field.Name, t)
+		}
+		ts, err := lexGrammar(spec, field)
+		if err != nil {
+			return nil, fmt.Errorf("grammar: field %s of %s: %w", field.Name, t, err)
+		}
+		tokens = append(tokens, ts...)
+	}
+	g := &grammarParser{deriver: d, tokens: tokens}
+	result, err := g.alternatives()
+	if err == nil && g.pos < len(tokens) {
+		err = fmt.Errorf("unexpected %s", tokens[g.pos].text)
+	}
+	if err != nil {
+		field := tokens[min(g.pos, len(tokens)-1)].field
+		return nil, fmt.Errorf("grammar: field %s of %s: %w", field.Name, t, err)
+	}
+	// The Seq gives the struct a tree of its own, even if its grammar is a
+	// single capture, which has the tag of its field.
+	*p = Seq(result)
+	return Indirect(p), nil
+}
+
+// A grammarToken is a token of a grammar tag.
+type grammarToken struct {
+	kind  grammarTokenKind
+	text  string
+	field reflect.StructField
+}
+
+type grammarTokenKind int
+
+const (
+	literalToken grammarTokenKind = iota
+	captureToken
+	// capturedLiteralToken is @'text'.
+	capturedLiteralToken
+	punctuationToken
+)
+
+// lexGrammar splits the grammar tag of field into tokens.
+func lexGrammar(spec string, field reflect.StructField) ([]grammarToken, error) {
+	var result []grammarToken
+	input := []rune(spec)
+	for pos := 0; pos < len(input); {
+		r := input[pos]
+		switch {
+		case unicode.IsSpace(r):
+			pos++
+		case r == '\'' || r == '"':
+			end := pos + 1
+			for end < len(input) && input[end] != r {
+				end++
+			}
+			if end == len(input) {
+				return nil, errors.New("unterminated literal")
+			}
+			kind := literalToken
+			if pos > 0 && input[pos-1] == '@' {
+				kind = capturedLiteralToken
+			}
+			result = append(result, grammarToken{kind, string(input[pos+1 : end]), field})
+			pos = end + 1
+		case r == '@' && pos+1 < len(input) && (input[pos+1] == '\'' || input[pos+1] == '"'):
+			pos++
+		case r == '@':
+			end := pos + 1
+			for end < len(input) && unicode.IsLetter(input[end]) {
+				end++
+			}
+			result = append(result, grammarToken{captureToken, string(input[pos+1 : end]), field})
+			pos = end
+		case strings.ContainsRune("()|*+?", r):
+			result = append(result, grammarToken{punctuationToken, string(r), field})
+			pos++
+		default:
+			return nil, fmt.Errorf("unexpected %q", r)
+		}
+	}
+	return result, nil
+}
+
+// A grammarParser builds a parser from the tokens of a struct's grammar, by
+// recursive descent.
+type grammarParser struct {
+	deriver *deriver
+	tokens  []grammarToken
+	pos     int
+}
+
+func (g *grammarParser) peek(s string) bool {
+	return g.pos < len(g.tokens) && g.tokens[g.pos].kind == punctuationToken && g.tokens[g.pos].text == s
+}
+
+// alternatives parses sequences separated by |.
+func (g *grammarParser) alternatives() (Parser, error) {
+	var alts []Parser
+	for {
+		seq, err := g.sequence()
+		if err != nil {
+			return nil, err
+		}
+		alts = append(alts, seq)
+		if !g.peek("|") {
+			break
+		}
+		g.pos++
+	}
+	if len(alts) == 1 {
+		return alts[0], nil
+	}
+	return Or(alts...), nil
+}
+
+// sequence parses terms up to a | or ), or the end.
+func (g *grammarParser) sequence() (Parser, error) {
+	var terms []Parser
+	for g.pos < len(g.tokens) && !g.peek("|") && !g.peek(")") {
+		term, err := g.term()
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, term)
+	}
+	if len(terms) == 1 {
+		return terms[0], nil
+	}
+	return Seq(terms...), nil
+}
+
+// term parses an atom and its postfix operators.
+func (g *grammarParser) term() (Parser, error) {
+	result, err := g.atom()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch {
+		case g.peek("*"):
+			result = Star(result)
+		case g.peek("+"):
+			result = Plus(result)
+		case g.peek("?"):
+			result = Opt(result)
+		default:
+			return result, nil
+		}
+		g.pos++
+	}
+}
+
+func (g *grammarParser) atom() (Parser, error) {
+	token := g.tokens[g.pos]
+	g.pos++
+	switch token.kind {
+	case literalToken:
+		return literalParser(token.text).Omit(), nil
+	case capturedLiteralToken:
+		return Tagged(literalParser(token.text), fieldName(token.field)), nil
+	case captureToken:
+		return g.deriver.capture(token.text, token.field.Type, fieldName(token.field))
+	}
+	if token.text == "(" {
+		result, err := g.alternatives()
+		if err != nil {
+			return nil, err
+		}
+		if !g.peek(")") {
+			return nil, errors.New("missing )")
+		}
+		g.pos++
+		return result, nil
+	}
+	g.pos--
+	return nil, fmt.Errorf("unexpected %s", token.text)
+}
+
+// literalParser matches text as a token, and as a whole word if it is one.
+func literalParser(text string) Parser {
+	word := len(text) > 0
+	for _, r := range text {
+		word = word && DefaultKeywords.word.Contains(r)
+	}
+	if word {
+		return Token(Keyword(text))
+	}
+	return Token(Exactly(text))
+}
+
+// fieldName returns the name Unmarshal looks for to fill field.
+func fieldName(field reflect.StructField) string {
+	if spec, ok := field.Tag.Lookup("parse"); ok {
+		if name, _, _ := strings.Cut(spec, ","); name != "" && name != "-" {
+			return name
+		}
+	}
+	return field.Name
+}
+
+// capture returns the parser for @class in a field of type t, or for a value
+// of type t if class is empty, whose tree is tagged name.
+func (d *deriver) capture(class string, t reflect.Type, name string) (Parser, error) {
+	switch class {
+	case "ident":
+		return Token(Identifier()).Tagged(name), nil
+	case "int":
+		return Token(Regex(`[-+]?[0-9]+`).Expecting("integer")).Tagged(name), nil
+	case "float":
+		return Token(Regex(`[-+]?([0-9]+\.?[0-9]*|\.[0-9]+)([eE][-+]?[0-9]+)?`).Expecting("number")).Tagged(name), nil
+	case "string":
+		// Only the text between the quotes is tagged.
+		return Seq(
+			Token(Exactly(`"`)).Omit(),
+			Lexical(Seq(Regex(`([^"\\]|\\.)*`).Tagged(name), Exactly(`"`).Omit())),
+		), nil
+	case "":
+	default:
+		return nil, fmt.Errorf("unknown class @%s", class)
+	}
+	for t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return d.capture("ident", t, name)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return d.capture("int", t, name)
+	case reflect.Float32, reflect.Float64:
+		return d.capture("float", t, name)
+	case reflect.Bool:
+		return Token(DefaultKeywords.OneOf("true", "false")).Tagged(name), nil
+	case reflect.Struct:
+		p, err := d.structParser(t)
+		if err != nil {
+			return nil, err
+		}
+		return Tagged(p, name), nil
+	}
+	return nil, fmt.Errorf("no grammar for %s", t)
+}
@@ -0,0 +1,175 @@
+package speg
+
+import (
+	"github.com/shoenig/test"
+	"strconv"
+	"testing"
+)
+
+type calcProgram struct {
+	Stmts []calcStmt `grammar:"@*"`
+}
+
+type calcStmt struct {
+	Let   *calcLet  `grammar:"@"`
+	Print *calcExpr `grammar:"| 'print' @ ';'"`
+}
+
+type calcLet struct {
+	Name  string   `grammar:"'let' @ '='"`
+	Value calcExpr `grammar:"@ ';'" parse:"value"`
+}
+
+type calcExpr struct {
+	Terms []calcTerm `grammar:"@ ('+' @)*"`
+}
+
+type calcTerm struct {
+	Number *float64  `grammar:"@"`
+	Text   *string   `grammar:"| @string"`
+	Name   *string   `grammar:"| @ident"`
+	Group  *calcExpr `grammar:"| '(' @ ')'"`
+	Note   string
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestParseInto(t *testing.T) {
+	var p calcProgram
+	err := ParseInto([]rune(`
+		let x = 1 + 2.5;
+		let y = (x + 1) + "a b";
+		print y;
+	`), &p)
+	test.NoError(t, err)
+	test.Eq(t, calcProgram{Stmts: []calcStmt{
+		{Let: &calcLet{Name: "x", Value: calcExpr{Terms: []calcTerm{{Number: ptr(1.0)}, {Number: ptr(2.5)}}}}},
+		{Let: &calcLet{Name: "y", Value: calcExpr{Terms: []calcTerm{
+			{Group: &calcExpr{Terms: []calcTerm{{Name: ptr("x")}, {Number: ptr(1.0)}}}},
+			{Text: ptr("a b")},
+		}}}},
+		{Print: &calcExpr{Terms: []calcTerm{{Name: ptr("y")}}}},
+	}}, p)
+}
+
+func TestParseIntoErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"missing semicolon", "let x = 1", `parse error at 9: expected "+" or ";"`},
+		{"keyword needs boundary", "letx = 1;", `parse error at 0: expected "let", "print" or end of input`},
+		{"trailing input", "print 1; 2", `parse error at 9: expected "let", "print" or end of input`},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var p calcProgram
+			test.EqError(t, ParseInto([]rune(tc.input), &p), tc.expected)
+		})
+	}
+}
+
+// sumExpr is left-recursive, which GrammarFor doesn't support, so it never
+// matches.
+type sumExpr struct {
+	Left  *sumExpr `grammar:"@ '+'"`
+	Right int      `grammar:"@"`
+}
+
+func TestParseIntoFailure(t *testing.T) {
+	// The parse fails, with an error, whether or not anything in the grammar
+	// records what it expected.
+	var v struct {
+		V int `grammar:"@"`
+	}
+	test.EqError(t, ParseInto([]rune("1 x"), &v), `parse error at 2: expected end of input`)
+	var e sumExpr
+	test.EqError(t, ParseInto([]rune("1+2"), &e), `parse error at 0`)
+}
+
+func TestParseIntoLeadingZeros(t *testing.T) {
+	var v struct {
+		A int   `grammar:"@"`
+		B int   `grammar:"@int"`
+		C []int `grammar:"@*"`
+	}
+	test.NoError(t, ParseInto([]rune("08 010 007 0"), &v))
+	test.Eq(t, 8, v.A)
+	test.Eq(t, 10, v.B)
+	test.Eq(t, []int{7, 0}, v.C)
+}
+
+// unquoted is a string whose escapes are decoded.
+type unquoted string
+
+func (u *unquoted) UnmarshalTree(t *Tree) error {
+	s, err := strconv.Unquote(`"` + t.Text() + `"`)
+	*u = unquoted(s)
+	return err
+}
+
+func TestParseIntoStringEscapes(t *testing.T) {
+	var v struct {
+		Raw     string   `grammar:"@string"`
+		Decoded unquoted `grammar:"@string"`
+	}
+	test.NoError(t, ParseInto([]rune(`"a\"b\n" "a\"b\n"`), &v))
+	test.Eq(t, `a\"b\n`, v.Raw)
+	test.Eq(t, "a\"b\n", v.Decoded)
+}
+
+func TestCapturedLiteral(t *testing.T) {
+	type decl struct {
+		Kind string `grammar:"@'var' | @'const'"`
+		Name string `grammar:"@"`
+	}
+	var d decl
+	test.NoError(t, ParseInto([]rune("const pi"), &d))
+	test.Eq(t, decl{Kind: "const", Name: "pi"}, d)
+}
+
+func TestGrammarForErrors(t *testing.T) {
+	type unterminated struct {
+		A string `grammar:"'x"`
+	}
+	type unbalanced struct {
+		A string `grammar:"( @"`
+	}
+	type class struct {
+		A string `grammar:"@number"`
+	}
+	type unsupported struct {
+		A chan int `grammar:"@"`
+	}
+	type extra struct {
+		A string `grammar:"@"`
+		B string `grammar:") @"`
+	}
+	var err error
+	_, err = GrammarFor[unterminated]()
+	test.EqError(t, err, "grammar: field A of speg.unterminated: unterminated literal")
+	_, err = GrammarFor[unbalanced]()
+	test.EqError(t, err, "grammar: field A of speg.unbalanced: missing )")
+	_, err = GrammarFor[class]()
+	test.EqError(t, err, "grammar: field A of speg.class: unknown class @number")
+	_, err = GrammarFor[unsupported]()
+	test.EqError(t, err, "grammar: field A of speg.unsupported: no grammar for chan int")
+	_, err = GrammarFor[extra]()
+	test.EqError(t, err, "grammar: field B of speg.extra: unexpected )")
+	_, err = GrammarFor[int]()
+	test.EqError(t, err, "grammar: int is not a struct")
+}
+
+func TestGenerateDerived(t *testing.T) {
+	grammar, err := GrammarFor[calcProgram]()
+	test.NoError(t, err)
+	g := NewGenerator(grammar, 3)
+	for range 10 {
+		s, err := g.Generate()
+		test.NoError(t, err)
+		test.NotNil(t, grammar.Parse([]rune(s), 0, NewContext()))
+	}
+}
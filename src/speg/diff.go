@@ -0,0 +1,477 @@
+package speg
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// An EditKind is the kind of an Edit.
+type EditKind int
+
+const (
+	// EditInsert adds a tree that wasn't in the old version.
+	EditInsert EditKind = iota
+	// EditDelete removes a tree that isn't in the new version.
+	EditDelete
+	// EditUpdate changes the text of a tree, other than that of its tagged
+	// descendants.
+	EditUpdate
+	// EditMove moves a tree to a different parent, or to a different place
+	// among its siblings.
+	EditMove
+)
+
+func (k EditKind) String() string {
+	switch k {
+	case EditInsert:
+		return "insert"
+	case EditDelete:
+		return "delete"
+	case EditUpdate:
+		return "update"
+	case EditMove:
+		return "move"
+	}
+	return fmt.Sprintf("EditKind(%d)", int(k))
+}
+
+// An Edit is a change from one version of a parse tree to another. Old is
+// the tree in the old version, and New the one in the new version. EditInsert
+// has no Old and EditDelete no New.
+type Edit struct {
+	Kind EditKind
+	Old  *Tree
+	New  *Tree
+}
+
+// Diff returns the edits that turn old into new, both the results of the same
+// grammar. Only tagged trees are compared: untagged trees are looked through,
+// and their text is part of their nearest tagged ancestor. Trees are paired
+// up first by tag and text, from the largest down, then by tag and how many
+// of their descendants are paired up, and then siblings with the same tag, by
+// the similarity of their text. Pairs with different text are updates, pairs
+// with different parents, or out of order among their siblings, are moves,
+// and the trees left over are deletes and inserts. Of a deleted or inserted
+// subtree, only the root is reported.
+//
+// Whitespace is ignored, except as a separator.
+func Diff(old, new *Tree) []Edit {
+	d := &differ{old: diffView(old), new: diffView(new)}
+	d.pair(d.old, d.new)
+	d.matchIdentical()
+	d.matchContainers()
+	return d.script()
+}
+
+// A diffNode is a tagged tree, in a view of a parse tree without the
+// untagged ones.
+type diffNode struct {
+	tree     *Tree
+	parent   *diffNode
+	children []*diffNode
+	// key is the tag and the normalized text.
+	key string
+	// own is the normalized text outside of tagged descendants.
+	own string
+	// size is the number of nodes in the subtree.
+	size  int
+	match *diffNode
+}
+
+// diffView returns the view of t, which is its root even if t is untagged.
+func diffView(t *Tree) *diffNode {
+	n := &diffNode{tree: t}
+	n.children = taggedChildren(t, n)
+	n.size = 1
+	for _, c := range n.children {
+		n.size += c.size
+	}
+	n.key = t.Tag + "\x00" + normalize(t.Text())
+	var own strings.Builder
+	pos := t.Start + len(t.Leading)
+	text := []rune(t.Text())
+	for _, c := range n.children {
+		start := c.tree.Start - pos
+		if start >= 0 && start <= len(text) {
+			own.WriteString(string(text[:start]) + " ")
+			end := min(len(text), start+len(c.tree.Match))
+			text = text[end:]
+			pos += end
+		}
+	}
+	own.WriteString(string(text))
+	n.own = normalize(own.String())
+	return n
+}
+
+func taggedChildren(t *Tree, parent *diffNode) []*diffNode {
+	var result []*diffNode
+	for _, c := range t.Children {
+		if c.Tag == "" {
+			result = append(result, taggedChildren(c, parent)...)
+			continue
+		}
+		n := diffView(c)
+		n.parent = parent
+		result = append(result, n)
+	}
+	return result
+}
+
+// normalize collapses runs of whitespace.
+func normalize(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func (n *diffNode) preorder(visit func(n *diffNode)) {
+	visit(n)
+	for _, c := range n.children {
+		c.preorder(visit)
+	}
+}
+
+func (n *diffNode) postorder(visit func(n *diffNode)) {
+	for _, c := range n.children {
+		c.postorder(visit)
+	}
+	visit(n)
+}
+
+// contains reports whether m is n or one of its descendants.
+func (n *diffNode) contains(m *diffNode) bool {
+	for ; m != nil; m = m.parent {
+		if m == n {
+			return true
+		}
+	}
+	return false
+}
+
+type differ struct {
+	old, new *diffNode
+}
+
+func (d *differ) pair(a, b *diffNode) {
+	a.match, b.match = b, a
+}
+
+// unmatched reports whether n and all its descendants are unmatched.
+func unmatched(n *diffNode) bool {
+	result := true
+	n.preorder(func(m *diffNode) {
+		result = result && m.match == nil
+	})
+	return result
+}
+
+// matchIdentical pairs up subtrees with the same tags and text, largest
+// first.
+func (d *differ) matchIdentical() {
+	candidates := make(map[string][]*diffNode)
+	d.new.preorder(func(n *diffNode) {
+		candidates[n.key] = append(candidates[n.key], n)
+	})
+	var olds []*diffNode
+	d.old.preorder(func(n *diffNode) {
+		olds = append(olds, n)
+	})
+	slices.SortStableFunc(olds, func(a, b *diffNode) int {
+		return b.size - a.size
+	})
+	for _, a := range olds {
+		if !unmatched(a) {
+			continue
+		}
+		var best *diffNode
+		for _, b := range candidates[a.key] {
+			if !unmatched(b) || !sameShape(a, b) {
+				continue
+			}
+			if best == nil || a.parent != nil && a.parent.match != nil && a.parent.match == b.parent {
+				best = b
+			}
+		}
+		if best != nil {
+			d.pairAll(a, best)
+		}
+	}
+}
+
+func sameShape(a, b *diffNode) bool {
+	if a.key != b.key || len(a.children) != len(b.children) {
+		return false
+	}
+	for k := range a.children {
+		if !sameShape(a.children[k], b.children[k]) {
+			return false
+		}
+	}
+	return true
+}
+
+// pairAll pairs up a and b, which have the same shape, and their
+// descendants.
+func (d *differ) pairAll(a, b *diffNode) {
+	d.pair(a, b)
+	for k := range a.children {
+		d.pairAll(a.children[k], b.children[k])
+	}
+}
+
+// minSimilarity is how similar two trees must be to be paired up.
+const minSimilarity = 0.5
+
+// matchContainers pairs up trees with the same tag that have enough paired
+// descendants in common, from the bottom up, and then the unpaired children
+// of each pair.
+func (d *differ) matchContainers() {
+	d.old.postorder(func(a *diffNode) {
+		if a.match != nil || len(a.children) == 0 {
+			return
+		}
+		var best *diffNode
+		bestScore := 0.0
+		d.new.preorder(func(b *diffNode) {
+			if b.match != nil || b.tree.Tag != a.tree.Tag || len(b.children) == 0 {
+				return
+			}
+			if score := d.commonDescendants(a, b); score > bestScore {
+				best, bestScore = b, score
+			}
+		})
+		if best != nil && bestScore >= minSimilarity {
+			d.pair(a, best)
+		}
+	})
+	d.recover(d.old)
+}
+
+// commonDescendants returns the dice coefficient of the descendants of a and
+// b: how many of them are paired with each other, relative to their number.
+func (d *differ) commonDescendants(a, b *diffNode) float64 {
+	common := 0
+	a.preorder(func(n *diffNode) {
+		if n != a && n.match != nil && n.match != b && b.contains(n.match) {
+			common++
+		}
+	})
+	return 2 * float64(common) / float64(a.size-1+b.size-1)
+}
+
+// recover pairs up the unpaired children of a and its match that have the
+// same tag: the most similar ones, or the only ones with that tag, and so on
+// down.
+func (d *differ) recover(a *diffNode) {
+	if b := a.match; b != nil {
+		for _, x := range a.children {
+			if x.match != nil {
+				continue
+			}
+			var best *diffNode
+			bestScore := -1.0
+			for _, y := range b.children {
+				if y.match != nil || y.tree.Tag != x.tree.Tag {
+					continue
+				}
+				if score := similarity(x.key, y.key); score > bestScore {
+					best, bestScore = y, score
+				}
+			}
+			if best != nil && (bestScore >= minSimilarity || d.onlyWithTag(a, b, x.tree.Tag)) {
+				d.pair(x, best)
+			}
+		}
+	}
+	for _, c := range a.children {
+		d.recover(c)
+	}
+}
+
+// onlyWithTag reports whether a and b each have a single unpaired child
+// tagged tag.
+func (d *differ) onlyWithTag(a, b *diffNode, tag string) bool {
+	count := func(n *diffNode) int {
+		result := 0
+		for _, c := range n.children {
+			if c.match == nil && c.tree.Tag == tag {
+				result++
+			}
+		}
+		return result
+	}
+	return count(a) == 1 && count(b) == 1
+}
+
+// similarity returns the dice coefficient of the bigrams of a and b.
+func similarity(a, b string) float64 {
+	bigrams := func(s string) map[[2]rune]int {
+		result := make(map[[2]rune]int)
+		r := []rune(s)
+		for k := 0; k+1 < len(r); k++ {
+			result[[2]rune{r[k], r[k+1]}]++
+		}
+		return result
+	}
+	x, y := bigrams(a), bigrams(b)
+	total, common := 0, 0
+	for g, n := range x {
+		total += n
+		common += min(n, y[g])
+	}
+	for _, n := range y {
+		total += n
+	}
+	if total == 0 {
+		if a == b {
+			return 1
+		}
+		return 0
+	}
+	return 2 * float64(common) / float64(total)
+}
+
+// script lists the edits: deletes in the order of the old tree, then the
+// rest in the order of the new one.
+func (d *differ) script() []Edit {
+	var result []Edit
+	d.old.preorder(func(a *diffNode) {
+		if a.match == nil && (a.parent == nil || a.parent.match != nil) {
+			result = append(result, Edit{Kind: EditDelete, Old: a.tree})
+		}
+	})
+	moved := d.reordered()
+	d.new.preorder(func(b *diffNode) {
+		a := b.match
+		switch {
+		case a == nil:
+			if b.parent == nil || b.parent.match != nil {
+				result = append(result, Edit{Kind: EditInsert, New: b.tree})
+			}
+			return
+		case a.parent != nil && (b.parent == nil || a.parent.match != b.parent) || moved[b]:
+			result = append(result, Edit{Kind: EditMove, Old: a.tree, New: b.tree})
+		}
+		if a.own != b.own {
+			result = append(result, Edit{Kind: EditUpdate, Old: a.tree, New: b.tree})
+		}
+	})
+	return result
+}
+
+// reordered returns the trees that stay with the same parent but move among
+// their siblings: those that aren't in the longest common subsequence of
+// the paired children of the parent in each version.
+func (d *differ) reordered() map[*diffNode]bool {
+	result := make(map[*diffNode]bool)
+	d.new.preorder(func(b *diffNode) {
+		a := b.match
+		if a == nil {
+			return
+		}
+		var xs, ys []*diffNode
+		for _, x := range a.children {
+			if x.match != nil && x.match.parent == b {
+				xs = append(xs, x.match)
+			}
+		}
+		for _, y := range b.children {
+			if y.match != nil && y.match.parent == a {
+				ys = append(ys, y)
+			}
+		}
+		kept := make(map[*diffNode]bool)
+		for _, n := range lcs(xs, ys) {
+			kept[n] = true
+		}
+		for _, y := range ys {
+			if !kept[y] {
+				result[y] = true
+			}
+		}
+	})
+	return result
+}
+
+// lcs returns a longest common subsequence of xs and ys.
+func lcs(xs, ys []*diffNode) []*diffNode {
+	table := make([][]int, len(xs)+1)
+	for i := range table {
+		table[i] = make([]int, len(ys)+1)
+	}
+	for i := len(xs) - 1; i >= 0; i-- {
+		for j := len(ys) - 1; j >= 0; j-- {
+			if xs[i] == ys[j] {
+				table[i][j] = table[i+1][j+1] + 1
+			} else {
+				table[i][j] = max(table[i+1][j], table[i][j+1])
+			}
+		}
+	}
+	var result []*diffNode
+	for i, j := 0, 0; i < len(xs) && j < len(ys); {
+		switch {
+		case xs[i] == ys[j]:
+			result = append(result, xs[i])
+			i++
+			j++
+		case table[i+1][j] >= table[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+	return result
+}
+
+// maxReportedText is the length past which WriteDiff shortens text.
+const maxReportedText = 40
+
+// WriteDiff writes a line for each of edits, giving the line and column of
+// the trees in oldInput and newInput, the inputs they were parsed from:
+//
+//	update value at 3:9 -> 3:9: "1" -> "2"
+func WriteDiff(w io.Writer, edits []Edit, oldInput, newInput []rune) error {
+	for _, e := range edits {
+		var line string
+		switch e.Kind {
+		case EditInsert:
+			line = fmt.Sprintf("insert %s at %s: %s", e.New.Tag, position(newInput, e.New), reported(e.New))
+		case EditDelete:
+			line = fmt.Sprintf("delete %s at %s: %s", e.Old.Tag, position(oldInput, e.Old), reported(e.Old))
+		case EditUpdate:
+			line = fmt.Sprintf("update %s at %s -> %s: %s -> %s", e.New.Tag, position(oldInput, e.Old), position(newInput, e.New), reported(e.Old), reported(e.New))
+		case EditMove:
+			line = fmt.Sprintf("move %s from %s to %s: %s", e.New.Tag, position(oldInput, e.Old), position(newInput, e.New), reported(e.New))
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// position returns the line and column, counting from 1, of the text of t.
+func position(input []rune, t *Tree) string {
+	pos := min(textStart(t), len(input))
+	line, col := 1, 1
+	for _, r := range input[:pos] {
+		if r == '\n' {
+			line, col = line+1, 1
+		} else {
+			col++
+		}
+	}
+	return fmt.Sprintf("%d:%d", line, col)
+}
+
+// reported returns the quoted text of t, shortened if it is long.
+func reported(t *Tree) string {
+	text := []rune(normalize(t.Text()))
+	if len(text) > maxReportedText {
+		return strconv.Quote(string(text[:maxReportedText-3]) + "...")
+	}
+	return strconv.Quote(string(text))
+}
@@ -0,0 +1,123 @@
+package speg
+
+import (
+	"github.com/shoenig/test"
+	"strings"
+	"testing"
+)
+
+// configGrammar matches lines like "key = value", which may be grouped under
+// section headers like "[name]".
+func configGrammar() Parser {
+	entry := Seq(
+		Token(Identifier()).Tagged("key"),
+		Token(Exactly("=")),
+		Token(Regex(`[0-9a-z]+`)).Tagged("value"),
+	).Tagged("entry")
+	section := Seq(
+		Token(Exactly("[")), Token(Identifier()).Tagged("name"), Token(Exactly("]")),
+		Star(entry),
+	).Tagged("section")
+	return Seq(Star(entry), Star(section)).Tagged("config")
+}
+
+func parseConfig(t *testing.T, input string) *Tree {
+	tree := configGrammar().Parse([]rune(input), 0, NewContext())
+	test.NotNil(t, tree)
+	test.Eq(t, len(strings.TrimSpace(input)), len(strings.TrimSpace(tree.Matched())))
+	return tree
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new string
+		expected []string
+	}{
+		{"same", "a = 1\nb = 2", "a = 1\nb = 2", nil},
+		{"whitespace", "a = 1\nb = 2", "a=1\n\n  b   = 2", nil},
+		{"update", "a = 1\nb = 2", "a = 1\nb = 3", []string{
+			`update value at 2:5 -> 2:5: "2" -> "3"`,
+		}},
+		{"rename", "a = 1\nb = 2", "a = 1\nc = 2", []string{
+			`update key at 2:1 -> 2:1: "b" -> "c"`,
+		}},
+		{"insert", "a = 1\nb = 2", "a = 1\nc = 3\nb = 2", []string{
+			`insert entry at 2:1: "c = 3"`,
+		}},
+		{"delete", "a = 1\nb = 2\nc = 3", "a = 1\nc = 3", []string{
+			`delete entry at 2:1: "b = 2"`,
+		}},
+		{"reorder", "a = 1\nb = 2\nc = 3", "b = 2\nc = 3\na = 1", []string{
+			`move entry from 1:1 to 3:1: "a = 1"`,
+		}},
+		{"move to section", "a = 1\nb = 2\n[s]\nc = 3", "a = 1\n[s]\nc = 3\nb = 2", []string{
+			`move entry from 2:1 to 4:1: "b = 2"`,
+		}},
+		{"move and update", "a = 1\nb = 2\n[s]\nc = 3", "a = 1\n[s]\nc = 3\nb = 4", []string{
+			`move entry from 2:1 to 4:1: "b = 4"`,
+			`update value at 2:5 -> 4:5: "2" -> "4"`,
+		}},
+		{"rename section", "[s]\na = 1\nb = 2", "[t]\na = 1\nb = 2", []string{
+			`update name at 1:2 -> 1:2: "s" -> "t"`,
+		}},
+		{"new section", "a = 1", "a = 1\n[s]\nb = 2\nc = 3", []string{
+			`insert section at 2:1: "[s] b = 2 c = 3"`,
+		}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			old, new := parseConfig(t, tc.old), parseConfig(t, tc.new)
+			var b strings.Builder
+			test.NoError(t, WriteDiff(&b, Diff(old, new), []rune(tc.old), []rune(tc.new)))
+			var got []string
+			if b.Len() > 0 {
+				got = strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+			}
+			test.Eq(t, tc.expected, got)
+		})
+	}
+}
+
+func TestWriteDiffPositions(t *testing.T) {
+	// The dash of a bullet is omitted, so a bullet starts with the whitespace
+	// before the dash, which its position skips.
+	bullet := Seq(Token(Exactly("-")).Omit(), Token(Identifier()).Tagged("item")).Tagged("bullet")
+	list := Tagged(Star(bullet), "list")
+	tests := []struct {
+		name     string
+		old, new string
+		expected string
+	}{
+		{"delete", "- a\n- b", "- a", `delete bullet at 2:1: "- b"`},
+		{"insert", "- a", "- a\n\n  - b", `insert bullet at 3:3: "- b"`},
+		{"update", "- a\n- b", "- a\n- c", `update item at 2:3 -> 2:3: "b" -> "c"`},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			old := list.Parse([]rune(tc.old), 0, NewContext())
+			new := list.Parse([]rune(tc.new), 0, NewContext())
+			var b strings.Builder
+			test.NoError(t, WriteDiff(&b, Diff(old, new), []rune(tc.old), []rune(tc.new)))
+			test.Eq(t, tc.expected+"\n", b.String())
+		})
+	}
+}
+
+func TestDiffEdits(t *testing.T) {
+	old, new := parseConfig(t, "a = 1\nb = 2"), parseConfig(t, "b = 3")
+	edits := Diff(old, new)
+	test.SliceLen(t, 2, edits)
+	test.Eq(t, EditDelete, edits[0].Kind)
+	test.Eq(t, `(entry (key "a") ("=") (value "1"))`, edits[0].Old.String())
+	test.Nil(t, edits[0].New)
+	test.Eq(t, EditUpdate, edits[1].Kind)
+	test.Eq(t, "2", edits[1].Old.Text())
+	test.Eq(t, "3", edits[1].New.Text())
+}
+
+func TestEditKindString(t *testing.T) {
+	test.Eq(t, "insert", EditInsert.String())
+	test.Eq(t, "move", EditMove.String())
+	test.Eq(t, "EditKind(7)", EditKind(7).String())
+}
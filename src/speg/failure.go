@@ -0,0 +1,124 @@
+package speg
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// failure records the farthest position at which a parser failed, and what
+// it expected to find there. It is shared by all the contexts derived from
+// the one returned by NewContext.
+type failure struct {
+	pos      int
+	expected []string
+	errs     []error
+}
+
+// A ParseError describes the farthest point a parse reached before failing.
+type ParseError struct {
+	// Pos is the position in the input, in runes.
+	Pos int
+	// Expected describes each of the things that would have allowed the parse
+	// to continue at Pos.
+	Expected []string
+	// Errors holds the errors returned by Check parsers that rejected what
+	// they matched at Pos.
+	Errors []error
+}
+
+func (e *ParseError) Error() string {
+	var parts []string
+	for _, err := range e.Errors {
+		parts = append(parts, err.Error())
+	}
+	if n := len(e.Expected); n > 0 {
+		expected := e.Expected[0]
+		if n > 1 {
+			expected = strings.Join(e.Expected[:n-1], ", ") + " or " + e.Expected[n-1]
+		}
+		parts = append(parts, "expected "+expected)
+	}
+	if len(parts) == 0 {
+		return fmt.Sprintf("parse error at %d", e.Pos)
+	}
+	return fmt.Sprintf("parse error at %d: %s", e.Pos, strings.Join(parts, "; "))
+}
+
+// Unwrap returns Errors, so that errors.Is and errors.As can find them.
+func (e *ParseError) Unwrap() []error {
+	return e.Errors
+}
+
+// expect records that what was expected but not found at pos. Only the
+// expectations at the farthest position are kept.
+func (context *Context) expect(pos int, what string) {
+	if context.quiet || what == "" {
+		return
+	}
+	f := context.failure
+	switch {
+	case pos > f.pos:
+		f.pos = pos
+		f.expected = []string{what}
+		f.errs = nil
+	case pos == f.pos && !slices.Contains(f.expected, what):
+		f.expected = append(f.expected, what)
+	}
+}
+
+// reject records that a parser matched at pos, but err rejected the match.
+// Like expectations, only the errors at the farthest position are kept.
+func (context *Context) reject(pos int, err error) {
+	if context.quiet {
+		return
+	}
+	f := context.failure
+	switch {
+	case pos > f.pos:
+		f.pos = pos
+		f.expected = nil
+		f.errs = []error{err}
+	case pos == f.pos:
+		f.errs = append(f.errs, err)
+	}
+}
+
+// failAt records that the parse failed at pos, without saying what was
+// expected there.
+func (context *Context) failAt(pos int) {
+	if context.quiet {
+		return
+	}
+	f := context.failure
+	if pos > f.pos {
+		f.pos = pos
+		f.expected = nil
+		f.errs = nil
+	}
+}
+
+// quietly returns a context in which failures are not recorded. It is used
+// by predicates like Not, where failure of the sub-parser is not an error.
+func (context *Context) quietly() *Context {
+	if context.quiet {
+		return context
+	}
+	result := *context
+	result.quiet = true
+	return &result
+}
+
+// Error returns a *ParseError describing the farthest position at which any
+// parser using this context failed, or nil if none has. When a parse fails, or
+// doesn't consume all of its input, this usually points at the problem.
+func (context *Context) Error() error {
+	if context.failure.pos < 0 {
+		return nil
+	}
+	return &ParseError{
+		Pos:      context.failure.pos,
+		Expected: slices.Clone(context.failure.expected),
+		Errors:   slices.Clone(context.failure.errs),
+	}
+}
@@ -0,0 +1,32 @@
+package speg
+
+import (
+	"testing"
+
+	"github.com/shoenig/test"
+)
+
+func TestContextError(t *testing.T) {
+	ctx := NewContext()
+	test.NoError(t, ctx.Error())
+
+	grammar := Seq(Letters(), Or(Exactly("+"), Exactly("-")), Digits())
+	test.Nil(t, grammar.Parse([]rune("abc*"), 0, ctx))
+	err := ctx.Error()
+	test.EqError(t, err, `parse error at 3: expected "+" or "-"`)
+	test.Eq(t, 3, err.(*ParseError).Pos)
+}
+
+func TestContextErrorIgnoresPredicates(t *testing.T) {
+	ctx := NewContext()
+	grammar := Seq(Not(Digit()), Letters(), Exactly(";"))
+	test.Nil(t, grammar.Parse([]rune("ab"), 0, ctx))
+	test.EqError(t, ctx.Error(), `parse error at 2: expected ";"`)
+}
+
+func TestExpecting(t *testing.T) {
+	ctx := NewContext()
+	ident := Letters().Expecting("identifier")
+	test.Nil(t, Seq(Exactly("let "), ident).Parse([]rune("let 1"), 0, ctx))
+	test.EqError(t, ctx.Error(), `parse error at 4: expected identifier`)
+}
@@ -0,0 +1,408 @@
+package speg
+
+import (
+	"fmt"
+	"maps"
+	"math"
+	"math/rand/v2"
+	"slices"
+)
+
+// A Generator produces random strings that a grammar accepts. It is meant for
+// fuzzing code that consumes parse trees:
+//
+//	g := NewGenerator(grammar, 1)
+//	s, err := g.Generate()
+//
+// A Generator walks the grammar, choosing among alternatives and repetition
+// counts at random. Since PEG operators like Not, LookingAt and ordered choice
+// can reject strings assembled that way, every candidate is parsed with the
+// grammar and only those that match in full are returned.
+type Generator struct {
+	root    Parser
+	rand    *rand.Rand
+	weights map[ID][]float64
+	heights map[ID]int
+	// captures holds the text generated for each Capture in the current
+	// candidate, for BackRef.
+	captures map[string][]rune
+	// lexical is set while generating within Lexical, where Token doesn't
+	// skip whitespace.
+	lexical bool
+
+	// MaxDepth bounds the nesting of combinators. Past it, the generator
+	// takes the shortest way out: no repetitions, no optional parts, and
+	// the alternative closest to a leaf.
+	MaxDepth int
+	// MaxRepeat bounds the number of repetitions generated by Star and Left.
+	MaxRepeat int
+	// Attempts bounds the number of candidates Generate tries.
+	Attempts int
+}
+
+// NewGenerator returns a Generator for the grammar root, with a random
+// number generator seeded with seed.
+func NewGenerator(root Parser, seed uint64) *Generator {
+	g := &Generator{
+		root:      root,
+		rand:      rand.New(rand.NewPCG(seed, seed)),
+		weights:   make(map[ID][]float64),
+		MaxDepth:  16,
+		MaxRepeat: 3,
+		Attempts:  100,
+	}
+	g.heights = minHeights(root)
+	return g
+}
+
+// Weight sets the relative weights of the alternatives of or, which must
+// be a parser returned by Or. By default the alternatives are equally likely.
+// A weight of zero means the alternative is only chosen when the maximum depth
+// is exceeded and it is the shortest way out.
+func (g *Generator) Weight(or Parser, weights ...float64) {
+	g.weights[or.ID()] = weights
+}
+
+// Generate returns a random string that the grammar matches in full. It
+// fails if none of the candidates it generated were accepted.
+func (g *Generator) Generate() (string, error) {
+	for attempt := 0; attempt < g.Attempts; attempt++ {
+		g.captures = make(map[string][]rune)
+		candidate, ok := g.generate(g.root, 0)
+		if !ok {
+			continue
+		}
+		tree := g.root.Parse(candidate, 0, NewContext())
+		if tree != nil && len(tree.Match) == len(candidate) {
+			return string(candidate), nil
+		}
+	}
+	return "", fmt.Errorf("no acceptable input after %d attempts", g.Attempts)
+}
+
+// A Seeder accepts seed inputs. *testing.F is a Seeder.
+type Seeder interface {
+	Add(args ...any)
+}
+
+// AddSeeds generates n strings and adds each one to the seed corpus of f:
+//
+//	func FuzzConsumer(f *testing.F) {
+//		if err := NewGenerator(grammar, 1).AddSeeds(f, 20); err != nil {
+//			f.Fatal(err)
+//		}
+//		f.Fuzz(func(t *testing.T, input string) { ... })
+//	}
+func (g *Generator) AddSeeds(f Seeder, n int) error {
+	for k := 0; k < n; k++ {
+		s, err := g.Generate()
+		if err != nil {
+			return err
+		}
+		f.Add(s)
+	}
+	return nil
+}
+
+func (g *Generator) generate(p Parser, depth int) ([]rune, bool) {
+	exhausted := depth >= g.MaxDepth
+	switch pp := p.(type) {
+	case Matcher:
+		return g.generateMatch(pp)
+	case SequenceParser:
+		var result []rune
+		for _, sub := range pp.subParsers {
+			s, ok := g.generate(sub, depth+1)
+			if !ok {
+				return nil, false
+			}
+			result = append(result, s...)
+		}
+		return result, true
+	case OrParser:
+		k := g.choose(pp, exhausted)
+		if k < 0 {
+			return nil, false
+		}
+		return g.generate(pp.subParsers[k], depth+1)
+	case StarParser:
+		return g.repeat(pp.parser, depth, g.count(exhausted))
+	case OptionalParser:
+		if exhausted || g.rand.IntN(2) == 0 {
+			return nil, true
+		}
+		return g.generate(pp.parser, depth+1)
+	case LeftRecursiveParser:
+		base, ok := g.generate(pp.base, depth+1)
+		if !ok {
+			return nil, false
+		}
+		rest, ok := g.repeat(pp.continuation, depth, g.count(exhausted))
+		return append(base, rest...), ok
+	case RightRecursiveParser:
+		rest, ok := g.repeat(pp.lead, depth, g.count(exhausted))
+		if !ok {
+			return nil, false
+		}
+		base, ok := g.generate(pp.base, depth+1)
+		return append(rest, base...), ok
+	case OperatorParser:
+		return g.generateOperators(pp, depth)
+	case RepeatParser:
+		n := pp.min + g.count(exhausted)
+		if pp.max >= 0 {
+			n = min(n, pp.max)
+		}
+		return g.repeat(pp.parser, depth, n)
+	case SeparatedParser:
+		n := pp.min + g.count(exhausted)
+		var result []rune
+		for k := 0; k < n; k++ {
+			if k > 0 {
+				sep, ok := g.generate(pp.sep, depth+1)
+				if !ok {
+					return nil, false
+				}
+				result = append(result, sep...)
+			}
+			item, ok := g.generate(pp.item, depth+1)
+			if !ok {
+				return nil, false
+			}
+			result = append(result, item...)
+		}
+		if pp.trailing && n > 0 && g.rand.IntN(2) == 0 {
+			sep, ok := g.generate(pp.sep, depth+1)
+			return append(result, sep...), ok
+		}
+		return result, true
+	case BetweenParser:
+		return g.generate(Seq(pp.open, pp.parser, pp.close), depth)
+	case RegexParser:
+		return pp.re.Random(g.rand), true
+	case LiteralsParser:
+		if pp.words.Len() == 0 {
+			return nil, false
+		}
+		return []rune(pp.words.Word(g.rand.IntN(pp.words.Len()))), true
+	case NotParser, LookingAtParser:
+		// These match the empty string. Whether they succeed is determined
+		// when the candidate is checked.
+		return nil, true
+	case TokenParser:
+		var space []rune
+		if !g.lexical && g.rand.IntN(2) == 0 {
+			space = randomSpace(g.rand, 0)
+		}
+		s, ok := g.generate(pp.parser, depth+1)
+		return append(space, s...), ok
+	case OmitParser:
+		return g.generate(pp.parser, depth+1)
+	case TaggedParser:
+		return g.generate(pp.parser, depth+1)
+	case CaseParser:
+		return g.generate(pp.parser, depth+1)
+	case StateParser:
+		return g.generate(pp.parser, depth+1)
+	case PredicateParser:
+		return g.generate(pp.parser, depth+1)
+	case CaptureParser:
+		s, ok := g.generate(pp.parser, depth+1)
+		if ok {
+			g.captures[pp.name] = s
+		}
+		return s, ok
+	case BackRefParser:
+		s, ok := g.captures[pp.name]
+		return slices.Clone(s), ok
+	case ScopeParser:
+		outer := maps.Clone(g.captures)
+		s, ok := g.generate(pp.parser, depth+1)
+		g.captures = outer
+		return s, ok
+	case SkipParser:
+		outer := g.lexical
+		g.lexical = pp.lexical
+		s, ok := g.generate(pp.parser, depth+1)
+		g.lexical = outer
+		return s, ok
+	case IndirectParser:
+		return g.generate(**pp.parser, depth)
+	}
+	return nil, false
+}
+
+// generateOperators produces an operand, possibly combined with others by
+// randomly chosen operators.
+func (g *Generator) generateOperators(p OperatorParser, depth int) ([]rune, bool) {
+	result, ok := g.generate(p.operand, depth+1)
+	if !ok || depth >= g.MaxDepth || len(p.operators) == 0 {
+		return result, ok
+	}
+	for n := g.rand.IntN(g.MaxRepeat + 1); n > 0; n-- {
+		op := p.operators[g.rand.IntN(len(p.operators))]
+		opText, ok := g.generate(op.parser, depth+1)
+		if !ok {
+			return nil, false
+		}
+		switch op.kind {
+		case prefixOperator:
+			result = append(opText, result...)
+		case postfixOperator:
+			result = append(result, opText...)
+		case infixOperator:
+			rhs, ok := g.generate(p.operand, depth+1)
+			if !ok {
+				return nil, false
+			}
+			result = append(append(result, opText...), rhs...)
+		}
+	}
+	return result, true
+}
+
+// generateMatch produces input for m. Matchers without a GeneratingFunc are
+// handled by guessing: random printable strings are tried until m matches a
+// prefix of one.
+func (g *Generator) generateMatch(m Matcher) ([]rune, bool) {
+	if m.generate != nil {
+		return m.generate(g.rand), true
+	}
+	for attempt := 0; attempt < 1000; attempt++ {
+		guess := make([]rune, 1+g.rand.IntN(8))
+		for k := range guess {
+			guess[k] = rune(' ' + g.rand.IntN('~'-' '+1))
+		}
+		if length := m.matchingFunc(guess); length >= 0 {
+			return guess[:length], true
+		}
+	}
+	return nil, false
+}
+
+func (g *Generator) repeat(p Parser, depth int, n int) ([]rune, bool) {
+	var result []rune
+	for ; n > 0; n-- {
+		s, ok := g.generate(p, depth+1)
+		if !ok {
+			return nil, false
+		}
+		result = append(result, s...)
+	}
+	return result, true
+}
+
+func (g *Generator) count(exhausted bool) int {
+	if exhausted {
+		return 0
+	}
+	return g.rand.IntN(g.MaxRepeat + 1)
+}
+
+// choose returns the index of the alternative of p to generate, or -1 if
+// there is none.
+func (g *Generator) choose(p OrParser, exhausted bool) int {
+	if len(p.subParsers) == 0 {
+		return -1
+	}
+	if exhausted {
+		best := -1
+		for k, sub := range p.subParsers {
+			if h := g.heights[sub.ID()]; h < math.MaxInt && (best < 0 || h < g.heights[p.subParsers[best].ID()]) {
+				best = k
+			}
+		}
+		return best
+	}
+	weights := g.weights[p.id]
+	total := 0.0
+	for k := range p.subParsers {
+		total += weight(weights, k)
+	}
+	if total <= 0 {
+		return g.rand.IntN(len(p.subParsers))
+	}
+	x := g.rand.Float64() * total
+	for k := range p.subParsers {
+		x -= weight(weights, k)
+		if x < 0 {
+			return k
+		}
+	}
+	return len(p.subParsers) - 1
+}
+
+func weight(weights []float64, k int) float64 {
+	if weights == nil {
+		return 1
+	}
+	if k < len(weights) {
+		return weights[k]
+	}
+	return 0
+}
+
+// minHeights computes, for each parser reachable from root, the least
+// nesting depth needed to generate input for it without further choices.
+// Parsers that can't terminate, like a rule that only refers to itself,
+// have height math.MaxInt.
+func minHeights(root Parser) map[ID]int {
+	var parsers []Parser
+	walk(root, func(p Parser) {
+		parsers = append(parsers, p)
+	})
+	heights := make(map[ID]int)
+	for _, p := range parsers {
+		heights[p.ID()] = math.MaxInt
+	}
+	height := func(p Parser) int {
+		subs := subParsers(p)
+		switch p.(type) {
+		case Matcher, StarParser, OptionalParser, NotParser, LookingAtParser:
+			return 0
+		case OrParser:
+			best := math.MaxInt
+			for _, sub := range subs {
+				best = min(best, heights[sub.ID()])
+			}
+			return saturatingInc(best)
+		case LeftRecursiveParser, OperatorParser:
+			return saturatingInc(heights[subs[0].ID()])
+		case RepeatParser:
+			if p.(RepeatParser).min == 0 {
+				return 0
+			}
+			return saturatingInc(heights[subs[0].ID()])
+		case SeparatedParser:
+			if p.(SeparatedParser).min == 0 {
+				return 0
+			}
+			return saturatingInc(heights[subs[0].ID()])
+		case RightRecursiveParser:
+			return saturatingInc(heights[subs[1].ID()])
+		default:
+			worst := 0
+			for _, sub := range subs {
+				worst = max(worst, heights[sub.ID()])
+			}
+			return saturatingInc(worst)
+		}
+	}
+	for changed := true; changed; {
+		changed = false
+		for _, p := range parsers {
+			if h := height(p); h < heights[p.ID()] {
+				heights[p.ID()] = h
+				changed = true
+			}
+		}
+	}
+	return heights
+}
+
+func saturatingInc(n int) int {
+	if n == math.MaxInt {
+		return n
+	}
+	return n + 1
+}
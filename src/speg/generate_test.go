@@ -0,0 +1,102 @@
+package speg
+
+import (
+	"math/rand/v2"
+	"testing"
+
+	"github.com/shoenig/test"
+)
+
+func exprGrammar() Parser {
+	varname := Token(Letters()).Tagged("var")
+	number := Token(Digits()).Tagged("num")
+	lparen := Token(Exactly("("))
+	rparen := Token(Exactly(")"))
+	addOp := Token(Or(Exactly("+"), Exactly("-")))
+	multOp := Token(Or(Exactly("*"), Exactly("/")))
+	var expr Parser
+	factor := Or(
+		varname,
+		number,
+		Seq(lparen.Omit(), Indirect(&expr), rparen.Omit()).Tagged("expr"),
+	)
+	term := Left(factor, Seq(multOp, factor)).Tagged("prod")
+	expr = Left(term, Seq(addOp, term)).Tagged("sum")
+	return expr
+}
+
+func TestGenerator(t *testing.T) {
+	grammar := exprGrammar()
+	g := NewGenerator(grammar, 42)
+	g.MaxDepth = 8
+	for k := 0; k < 50; k++ {
+		s, err := g.Generate()
+		test.NoError(t, err)
+		tree := grammar.Parse([]rune(s), 0, NewContext())
+		test.NotNil(t, tree)
+		test.Eq(t, len([]rune(s)), len(tree.Match))
+	}
+}
+
+func TestGeneratorRespectsNot(t *testing.T) {
+	// Identifiers that aren't the keyword "if".
+	ident := Seq(Not(Seq(Exactly("if"), Not(Letter()))), Letters())
+	g := NewGenerator(ident, 7)
+	for k := 0; k < 50; k++ {
+		s, err := g.Generate()
+		test.NoError(t, err)
+		test.NotEq(t, "if", s)
+	}
+}
+
+func TestGeneratorWeights(t *testing.T) {
+	choice := Or(Exactly("a"), Exactly("b"))
+	g := NewGenerator(choice, 1)
+	g.Weight(choice, 0, 1)
+	for k := 0; k < 20; k++ {
+		s, err := g.Generate()
+		test.NoError(t, err)
+		test.Eq(t, "b", s)
+	}
+}
+
+func TestGeneratorCustomMatcher(t *testing.T) {
+	vowel := NewMatcher(func(input []rune) int {
+		if len(input) > 0 && (input[0] == 'a' || input[0] == 'e' || input[0] == 'o') {
+			return 1
+		}
+		return -1
+	})
+	s, err := NewGenerator(vowel, 3).Generate()
+	test.NoError(t, err)
+	test.Eq(t, 1, len(s))
+
+	s, err = NewGenerator(vowel.WithGenerator(func(r *rand.Rand) []rune { return []rune("o") }), 3).Generate()
+	test.NoError(t, err)
+	test.Eq(t, "o", s)
+}
+
+func TestGeneratorChecksPredicates(t *testing.T) {
+	s, err := NewGenerator(Seq(Exactly("a"), Not(Any())), 1).Generate()
+	test.NoError(t, err)
+	test.Eq(t, "a", s)
+}
+
+func TestGeneratorFailsOnImpossibleGrammar(t *testing.T) {
+	_, err := NewGenerator(Seq(Not(Exactly("a")), Exactly("a")), 1).Generate()
+	test.Error(t, err)
+}
+
+func FuzzExprGrammar(f *testing.F) {
+	grammar := exprGrammar()
+	if err := NewGenerator(grammar, 1).AddSeeds(f, 10); err != nil {
+		f.Fatal(err)
+	}
+	f.Fuzz(func(t *testing.T, input string) {
+		runes := []rune(input)
+		tree := grammar.Parse(runes, 0, NewContext())
+		if tree != nil && len(tree.Match) > len(runes) {
+			t.Errorf("match %q is longer than input %q", tree.Matched(), input)
+		}
+	})
+}
@@ -0,0 +1,85 @@
+package speg
+
+// subParsers returns the parsers that p delegates to, in order. Parsers that
+// don't delegate, like Matcher, have none.
+func subParsers(p Parser) []Parser {
+	switch pp := p.(type) {
+	case SequenceParser:
+		return pp.subParsers
+	case OrParser:
+		return pp.subParsers
+	case StarParser:
+		return []Parser{pp.parser}
+	case OptionalParser:
+		return []Parser{pp.parser}
+	case NotParser:
+		return []Parser{pp.parser}
+	case LookingAtParser:
+		return []Parser{pp.parser}
+	case OmitParser:
+		return []Parser{pp.parser}
+	case TaggedParser:
+		return []Parser{pp.parser}
+	case CaseParser:
+		return []Parser{pp.parser}
+	case StateParser:
+		return []Parser{pp.parser}
+	case PredicateParser:
+		return []Parser{pp.parser}
+	case CaptureParser:
+		return []Parser{pp.parser}
+	case ScopeParser:
+		return []Parser{pp.parser}
+	case TokenParser:
+		return []Parser{pp.parser}
+	case SkipParser:
+		if pp.skip == nil {
+			return []Parser{pp.parser}
+		}
+		return []Parser{pp.skip, pp.parser}
+	case LeftRecursiveParser:
+		return []Parser{pp.base, pp.continuation}
+	case RightRecursiveParser:
+		return []Parser{pp.lead, pp.base}
+	case RepeatParser:
+		return []Parser{pp.parser}
+	case SeparatedParser:
+		return []Parser{pp.item, pp.sep}
+	case BetweenParser:
+		return []Parser{pp.open, pp.parser, pp.close}
+	case OperatorParser:
+		result := []Parser{pp.operand}
+		for _, op := range pp.operators {
+			result = append(result, op.parser)
+		}
+		return result
+	case IndirectParser:
+		return []Parser{**pp.parser}
+	}
+	return nil
+}
+
+// walk calls visit once for every parser reachable from root, parents before
+// children. Indirect proxies are not visited themselves; their targets are.
+func walk(root Parser, visit func(Parser)) {
+	seen := make(map[ID]bool)
+	var visitAll func(p Parser)
+	visitAll = func(p Parser) {
+		for {
+			d, ok := p.(IndirectParser)
+			if !ok {
+				break
+			}
+			p = **d.parser
+		}
+		if seen[p.ID()] {
+			return
+		}
+		seen[p.ID()] = true
+		visit(p)
+		for _, sub := range subParsers(p) {
+			visitAll(sub)
+		}
+	}
+	visitAll(root)
+}
@@ -0,0 +1,235 @@
+package speg
+
+import (
+	"fmt"
+	"github.com/google/uuid"
+)
+
+type indentKind int
+
+const (
+	indentBlock indentKind = iota
+	dedentBlock
+	sameIndent
+	lineBreak
+	indentToken
+	dedentToken
+)
+
+func (k indentKind) String() string {
+	return [...]string{"Indent", "Dedent", "SameIndent", "LineBreak", "IndentToken", "DedentToken"}[k]
+}
+
+// An IndentParser tracks the indentation of blocks of lines, as in Python or
+// YAML. The widths of the enclosing blocks are kept in the state of the parse,
+// which is undone when a parser fails or backtracks, and is part of the key
+// under which results are memoized, so a parser reached with different
+// indentation is parsed again.
+//
+// There are two ways to use them. Indent, SameIndent and Dedent examine the
+// indentation at the start of a line directly:
+//
+//	block := Seq(Indent(), stmt, Star(Seq(newline, SameIndent(), stmt)), newline, Dedent())
+//
+// Alternatively, LineBreak works like the Python tokenizer: it matches the end
+// of a line and the indentation of the next one, and compares the two,
+// producing virtual INDENT and DEDENT tokens that are matched, as empty
+// strings, by IndentToken and DedentToken:
+//
+//	block := Seq(LineBreak(), IndentToken(), Plus(stmt), DedentToken())
+//	stmt := Or(Seq(simple, LineBreak()), compound)
+//
+// In either case, the grammar is responsible for blank lines, except that
+// LineBreak skips lines that contain only spaces and tabs. A tab advances the
+// width to the next multiple of 8.
+type IndentParser struct {
+	id   ID
+	kind indentKind
+}
+
+// Indent matches the indentation at the start of a line if it is wider than
+// that of the enclosing block, and begins a new block with that width.
+func Indent() IndentParser {
+	return IndentParser{id: uuid.New(), kind: indentBlock}
+}
+
+// Dedent matches the empty string at the start of a line that is indented
+// less than the enclosing block, or at the end of the input, and ends the
+// block. Dedent fails outside of any block.
+func Dedent() IndentParser {
+	return IndentParser{id: uuid.New(), kind: dedentBlock}
+}
+
+// SameIndent matches the indentation at the start of a line if it is the same
+// as that of the enclosing block.
+func SameIndent() IndentParser {
+	return IndentParser{id: uuid.New(), kind: sameIndent}
+}
+
+// LineBreak matches a line break, any lines after it that are blank, and the
+// indentation of the next line. If the indentation is wider than that of the
+// enclosing block, LineBreak begins a new block and produces an INDENT token.
+// If it's narrower, LineBreak ends blocks until it reaches one with the same
+// indentation, producing a DEDENT token for each; it fails if there is none.
+// At the end of the input, LineBreak matches the empty string and ends every
+// block. LineBreak fails if tokens from an earlier LineBreak haven't been
+// matched.
+func LineBreak() IndentParser {
+	return IndentParser{id: uuid.New(), kind: lineBreak}
+}
+
+// IndentToken matches the empty string where LineBreak produced an INDENT token.
+func IndentToken() IndentParser {
+	return IndentParser{id: uuid.New(), kind: indentToken}
+}
+
+// DedentToken matches the empty string where LineBreak produced a DEDENT token.
+func DedentToken() IndentParser {
+	return IndentParser{id: uuid.New(), kind: dedentToken}
+}
+
+func (p IndentParser) Omit() Parser {
+	return Omit(p)
+}
+
+func (p IndentParser) ID() uuid.UUID {
+	return p.id
+}
+
+func (p IndentParser) Tagged(tag string) TaggedParser {
+	return Tagged(p, tag)
+}
+
+func (p IndentParser) Parse(input []rune, start int, ctx *Context) *Tree {
+	s := ctx.mark()
+	width, length := indentation(input[start:])
+	switch p.kind {
+	case indentBlock:
+		if start+length == len(input) || width <= s.indent() {
+			ctx.expect(start, "indented line")
+			return nil
+		}
+		ctx.reset(s.push(width))
+		return indentTree(input, start, length)
+	case dedentBlock:
+		if s.depth() == 0 || (start+length < len(input) && width >= s.indent()) {
+			ctx.expect(start, "dedented line")
+			return nil
+		}
+		ctx.reset(s.pop())
+		return indentTree(input, start, 0)
+	case sameIndent:
+		if width != s.indent() {
+			ctx.expect(start, fmt.Sprintf("line indented by %d", s.indent()))
+			return nil
+		}
+		return indentTree(input, start, length)
+	case lineBreak:
+		return p.parseLineBreak(input, start, ctx)
+	case indentToken:
+		if s == nil || s.pending <= 0 {
+			ctx.expect(start, "INDENT")
+			return nil
+		}
+		ctx.reset(s.withPending(s.pending - 1))
+		return indentTree(input, start, 0)
+	case dedentToken:
+		if s == nil || s.pending >= 0 {
+			ctx.expect(start, "DEDENT")
+			return nil
+		}
+		ctx.reset(s.withPending(s.pending + 1))
+		return indentTree(input, start, 0)
+	}
+	return nil
+}
+
+func (p IndentParser) parseLineBreak(input []rune, start int, ctx *Context) *Tree {
+	s := ctx.mark()
+	switch {
+	case s != nil && s.pending > 0:
+		ctx.expect(start, "INDENT")
+		return nil
+	case s != nil && s.pending < 0:
+		ctx.expect(start, "DEDENT")
+		return nil
+	}
+	if start == len(input) {
+		ctx.reset(s.withIndents(nil).withPending(-s.depth()))
+		return indentTree(input, start, 0)
+	}
+	pos := start
+	for {
+		n := newline(input[pos:])
+		if n == 0 {
+			if pos == start {
+				ctx.expect(start, "line break")
+				return nil
+			}
+			break
+		}
+		pos += n
+		if _, length := indentation(input[pos:]); newline(input[pos+length:]) > 0 {
+			// A blank line.
+			pos += length
+			continue
+		}
+		break
+	}
+	width, length := indentation(input[pos:])
+	end := pos + length
+	switch {
+	case end == len(input):
+		ctx.reset(s.withIndents(nil).withPending(-s.depth()))
+	case width > s.indent():
+		ctx.reset(s.push(width).withPending(1))
+	case width < s.indent():
+		next, dedents := s, 0
+		for next.depth() > 0 && width < next.indent() {
+			next = next.pop()
+			dedents++
+		}
+		if width != next.indent() {
+			ctx.expect(end, "indentation matching an enclosing block")
+			return nil
+		}
+		ctx.reset(next.withPending(-dedents))
+	}
+	return indentTree(input, start, end-start)
+}
+
+func indentTree(input []rune, start, length int) *Tree {
+	return &Tree{
+		Start: start,
+		Match: input[start : start+length],
+	}
+}
+
+// indentation returns the width of the spaces and tabs at the start of
+// input, and the number of runes they take up.
+func indentation(input []rune) (width, length int) {
+	for _, r := range input {
+		switch r {
+		case ' ':
+			width++
+		case '\t':
+			width += 8 - width%8
+		default:
+			return width, length
+		}
+		length++
+	}
+	return width, length
+}
+
+// newline returns the length of the line break at the start of input, or 0
+// if there is none.
+func newline(input []rune) int {
+	switch {
+	case len(input) > 0 && input[0] == '\n':
+		return 1
+	case len(input) > 1 && input[0] == '\r' && input[1] == '\n':
+		return 2
+	}
+	return 0
+}
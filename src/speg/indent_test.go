@@ -0,0 +1,109 @@
+package speg
+
+import (
+	"github.com/shoenig/test"
+	"testing"
+)
+
+// blockGrammar returns a grammar for nested if statements that uses Indent,
+// SameIndent and Dedent directly.
+func blockGrammar() Parser {
+	nl := Exactly("\n").Omit()
+	name := Letters().Tagged("name")
+	var stmt Parser
+	block := Seq(Indent().Omit(), Indirect(&stmt), Star(Seq(SameIndent().Omit(), Indirect(&stmt))), Dedent().Omit()).Tagged("block")
+	stmt = Or(
+		Seq(Keyword("if").Omit(), Exactly(" ").Omit(), name, Exactly(":").Omit(), nl, block).Tagged("if"),
+		Seq(name, nl),
+	)
+	return Seq(Star(Seq(SameIndent().Omit(), stmt)), Not(Any()).Omit())
+}
+
+// tokenGrammar is like blockGrammar, but uses LineBreak and the virtual
+// tokens it produces.
+func tokenGrammar() Parser {
+	name := Letters().Tagged("name")
+	var stmt Parser
+	stmt = Or(
+		Seq(Keyword("if").Omit(), Exactly(" ").Omit(), name, Exactly(":").Omit(), LineBreak().Omit(),
+			IndentToken().Omit(), Plus(Indirect(&stmt)).Tagged("block"), DedentToken().Omit()).Tagged("if"),
+		Seq(name, LineBreak().Omit()),
+	)
+	return Seq(Star(stmt), Not(Any()).Omit())
+}
+
+func TestIndent(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"flat", "a\nb\n", `(((((name "a"))) (((name "b")))))`},
+		{"nested", "if a:\n  b\n  if c:\n    d\n  e\nf\n",
+			`((((if (name "a") (block ((name "b")) (((if (name "c") (block ((name "d")) ""))) (((name "e"))))))) (((name "f")))))`},
+		{"dedent two levels", "if a:\n  if b:\n    c\nd\n",
+			`((((if (name "a") (block (if (name "b") (block ((name "c")) "")) ""))) (((name "d")))))`},
+		{"dedent at end", "if a:\n\tif b:\n\t\tc\n",
+			`((((if (name "a") (block (if (name "b") (block ((name "c")) "")) "")))))`},
+		{"inconsistent dedent", "if a:\n    b\n  c\n", `<nil>`},
+		{"missing indent", "if a:\nb\n", `<nil>`},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			test.Eq(t, tc.expected, blockGrammar().Parse([]rune(tc.input), 0, NewContext()).String())
+		})
+	}
+}
+
+func TestLineBreak(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"flat", "a\nb", `((((name "a")) ((name "b"))))`},
+		{"nested", "if a:\n  b\n  if c:\n    d\n\n  e\nf",
+			`(((if (name "a") (block ((name "b")) (if (name "c") (block ((name "d")))) ((name "e")))) ((name "f"))))`},
+		{"blank lines", "if a:\n\n  \n  b\n\nc\n",
+			`(((if (name "a") (block ((name "b")))) ((name "c"))))`},
+		{"dedent at end", "if a:\n  if b:\n    c\n",
+			`(((if (name "a") (block (if (name "b") (block ((name "c"))))))))`},
+		{"crlf", "if a:\r\n  b\r\n", `(((if (name "a") (block ((name "b"))))))`},
+		{"unexpected indent", "a\n  b\n", `<nil>`},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			test.Eq(t, tc.expected, tokenGrammar().Parse([]rune(tc.input), 0, NewContext()).String())
+		})
+	}
+}
+
+func TestLineBreakInconsistentDedent(t *testing.T) {
+	ctx := NewContext()
+	test.Nil(t, tokenGrammar().Parse([]rune("if a:\n    b\n  c\n"), 0, ctx))
+	test.EqError(t, ctx.Error(), "parse error at 14: expected indentation matching an enclosing block")
+}
+
+func TestIndentBacktracking(t *testing.T) {
+	nl := Exactly("\n").Omit()
+	block := Seq(Indent().Omit(), Letters(), nl, Dedent().Omit()).Tagged("block")
+	// The first alternative matches block, which changes the indentation,
+	// then fails. The second must start again from the original state, and
+	// gets block's result from the cache along with the state it left.
+	p := Seq(
+		Or(Seq(block, Exactly("!")), Seq(block, SameIndent().Omit(), Exactly("x"))),
+		Not(Any()).Omit(),
+	)
+	test.Eq(t, `(((block "a") "x"))`, p.Parse([]rune("  a\nx"), 0, NewContext()).String())
+}
+
+func TestIndentMemo(t *testing.T) {
+	p := Seq(SameIndent().Omit(), Letters())
+	ctx := NewContext()
+	test.Nil(t, p.Parse([]rune("  a"), 0, ctx))
+
+	// The same parser at the same position, reached with different
+	// indentation, is parsed again rather than taken from the cache.
+	ctx.reset(ctx.mark().push(2))
+	test.Eq(t, `("a")`, p.Parse([]rune("  a"), 0, ctx).String())
+}
@@ -0,0 +1,132 @@
+package speg
+
+import (
+	"math/rand/v2"
+	"sparse/src/charclass"
+	"sparse/src/trie"
+	"strconv"
+)
+
+// Keywords describes the words of a language: which runes may start an
+// identifier, which may continue one, and so which runes mark the end of a
+// word. Keywords built from it only match whole words, so Keyword("if")
+// doesn't match the start of "iffy".
+type Keywords struct {
+	start charclass.Class
+	word  charclass.Class
+}
+
+// NewKeywords returns Keywords for identifiers that begin with a rune in start
+// and continue with runes in word.
+func NewKeywords(start, word charclass.Class) Keywords {
+	return Keywords{start: start, word: word}
+}
+
+// DefaultKeywords are the conventions of most programming languages: an
+// identifier is a letter or underscore followed by letters, digits and
+// underscores.
+var DefaultKeywords = NewKeywords(
+	charclass.MustParse(`[\p{L}_]`),
+	charclass.MustParse(`[\p{L}\p{Nd}_]`),
+)
+
+// atBoundary reports whether a word may end just before input.
+func (k Keywords) atBoundary(input []rune) bool {
+	return len(input) == 0 || !k.word.Contains(input[0])
+}
+
+// Keyword matches s when it is not followed by a word rune. In a context
+// that folds case, it matches s in any case.
+func (k Keywords) Keyword(s string) Matcher {
+	return k.OneOf(s).Expecting(strconv.Quote(s))
+}
+
+// OneOf matches any one of words, when it is not followed by a word rune.
+// The words are kept in a trie, so large sets of keywords are matched in a
+// single pass over the input. If more than one word matches, the longest one
+// wins.
+func (k Keywords) OneOf(words ...string) Matcher {
+	t := trie.New(words...)
+	result := NewMatcher(k.matchWord(t))
+	result.folded = k.matchWord(trie.NewFolded(words...))
+	result.skips = true
+	if len(words) == 1 {
+		result.literal = words[0]
+	}
+	if t.Len() > 0 {
+		result.generate = func(r *rand.Rand) []rune {
+			return []rune(t.Word(r.IntN(t.Len())))
+		}
+	}
+	result.expected = "keyword"
+	return result
+}
+
+// matchWord returns a MatchingFunc for the longest word of t that is
+// followed by a word boundary.
+func (k Keywords) matchWord(t *trie.Trie) MatchingFunc {
+	return func(input []rune) int {
+		matches := t.Prefixes(input)
+		for i := len(matches) - 1; i >= 0; i-- {
+			if length := matches[i].Length; length > 0 && k.atBoundary(input[length:]) {
+				return length
+			}
+		}
+		return -1
+	}
+}
+
+// Identifier matches an identifier, provided it isn't one of exclude. The
+// excluded words are typically the reserved words of the language. In a
+// context that folds case, the excluded words are excluded in any case.
+func (k Keywords) Identifier(exclude ...string) Matcher {
+	reserved := trie.New(exclude...)
+	result := NewMatcher(k.matchIdentifier(reserved))
+	result.folded = k.matchIdentifier(trie.NewFolded(exclude...))
+	result.skips = true
+	if !k.start.IsEmpty() && !k.word.IsEmpty() {
+		// If no word it tries is allowed, it gives up and returns a reserved
+		// one, which the Generator rejects along with its candidate.
+		result.generate = func(r *rand.Rand) []rune {
+			var word []rune
+			for attempt := 0; attempt < 1000; attempt++ {
+				word = []rune{k.start.Random(r)}
+				for n := r.IntN(6); n > 0; n-- {
+					word = append(word, k.word.Random(r))
+				}
+				if !reserved.Contains(word) {
+					break
+				}
+			}
+			return word
+		}
+	}
+	result.expected = "identifier"
+	return result
+}
+
+// matchIdentifier returns a MatchingFunc for identifiers that aren't in
+// reserved.
+func (k Keywords) matchIdentifier(reserved *trie.Trie) MatchingFunc {
+	return func(input []rune) int {
+		if len(input) == 0 || !k.start.Contains(input[0]) {
+			return -1
+		}
+		length := 1 + k.word.Span(input[1:])
+		if reserved.Contains(input[:length]) {
+			return -1
+		}
+		return length
+	}
+}
+
+// Keyword matches s as a whole word, according to DefaultKeywords.
+func Keyword(s string) Matcher {
+	return DefaultKeywords.Keyword(s)
+}
+
+// Identifier matches an identifier other than one of exclude, according to
+// DefaultKeywords.
+func Identifier(exclude ...string) Matcher {
+	return DefaultKeywords.Identifier(exclude...)
+}
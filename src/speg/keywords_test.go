@@ -0,0 +1,61 @@
+package speg
+
+import (
+	"github.com/shoenig/test"
+	"sparse/src/charclass"
+	"testing"
+)
+
+func TestKeywords(t *testing.T) {
+	reserved := []string{"if", "in", "int", "interface", "else"}
+	shell := NewKeywords(charclass.MustParse("[a-z]"), charclass.MustParse("[a-z-]"))
+	tests := []struct {
+		name     string
+		parser   Parser
+		input    string
+		expected string
+	}{
+		{"keyword", Keyword("if"), "if (x)", `"if"`},
+		{"keyword at end", Keyword("if"), "if", `"if"`},
+		{"keyword prefix of word", Keyword("if"), "iffy", `<nil>`},
+		{"keyword before digit", Keyword("if"), "if2", `<nil>`},
+		{"one of longest", DefaultKeywords.OneOf(reserved...), "interface{}", `"interface"`},
+		{"one of shorter", DefaultKeywords.OneOf(reserved...), "int x", `"int"`},
+		{"one of none", DefaultKeywords.OneOf(reserved...), "inter", `<nil>`},
+		{"identifier", Identifier(reserved...), "iffy", `"iffy"`},
+		{"identifier reserved", Identifier(reserved...), "int x", `<nil>`},
+		{"identifier unicode", Identifier(reserved...), "größe_2 = 1", `"größe_2"`},
+		{"identifier digit", Identifier(reserved...), "2x", `<nil>`},
+		{"custom word runes", shell.Keyword("if"), "if-then", `<nil>`},
+		{"custom identifier", shell.Identifier(), "if-then", `"if-then"`},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			test.Eq(t, tc.expected, tc.parser.Parse([]rune(tc.input), 0, NewContext()).String())
+		})
+	}
+}
+
+func TestKeywordsGenerate(t *testing.T) {
+	grammar := Seq(Or(Keyword("let"), Keyword("var")), Exactly(" "), Identifier("let", "var"))
+	g := NewGenerator(grammar, 1)
+	for k := 0; k < 20; k++ {
+		_, err := g.Generate()
+		test.NoError(t, err)
+	}
+}
+
+func TestIdentifierGenerateAllReserved(t *testing.T) {
+	a := NewKeywords(charclass.MustParse("[a]"), charclass.MustParse("[a]"))
+	identifier := a.Identifier("a", "aa", "aaa", "aaaa", "aaaaa", "aaaaaa")
+	g := NewGenerator(identifier, 1)
+	g.Attempts = 5
+	_, err := g.Generate()
+	test.EqError(t, err, "no acceptable input after 5 attempts")
+}
+
+func TestKeywordExpectation(t *testing.T) {
+	ctx := NewContext()
+	test.Nil(t, Or(Keyword("else"), Identifier("if")).Parse([]rune("if x"), 0, ctx))
+	test.EqError(t, ctx.Error(), `parse error at 0: expected "else" or identifier`)
+}
@@ -22,46 +22,51 @@ func (l LeftRecursiveParser) Flatten() TokenParser {
 }
 
 func (l LeftRecursiveParser) Parse(input []rune, start int, ctx *Context) *Tree {
-	base := l.base.Parse(input, start, ctx)
+	base := ctx.parse(l.base, input, start)
 	if base == nil {
 		return nil
 	}
 	pos := start + len(base.Match)
 
-	cont := l.continuation.Parse(input, pos, ctx)
+	mark := ctx.mark()
+	cont := ctx.parse(l.continuation, input, pos)
 	if cont == nil || len(cont.Match) == 0 {
+		ctx.reset(mark)
 		return base
 	}
-	var children []*Tree
-	if ctx.withChildren {
-		children = append(children, base)
-		children = append(children, cont.Children...)
-	}
 	pos += len(cont.Match)
-	lhs := &Tree{
-		Start:    start,
-		Match:    input[start:pos],
-		Children: children,
-		Tag:      l.tag,
-	}
+	lhs := l.node(input, start, pos, base, cont, ctx)
 	for {
-		cont := l.continuation.Parse(input, pos, ctx)
+		mark := ctx.mark()
+		cont := ctx.parse(l.continuation, input, pos)
 		if cont == nil || len(cont.Match) == 0 {
 			// TODO: add tag?
+			ctx.reset(mark)
 			return lhs
 		}
 		pos += len(cont.Match)
-		var children []*Tree
-		if ctx.withChildren {
-			children = append(children, lhs)
-			children = append(children, cont.Children...)
-		}
-		lhs = &Tree{
-			Start:    start,
-			Match:    input[start:pos],
-			Children: children,
-			Tag:      l.tag,
-		}
+		lhs = l.node(input, start, pos, lhs, cont, ctx)
+	}
+}
+
+// node builds the tree for lhs followed by a match of the continuation. Its
+// children are lhs followed by the children of cont.
+func (l LeftRecursiveParser) node(input []rune, start, end int, lhs, cont *Tree, ctx *Context) *Tree {
+	var children, nodes []*Tree
+	if ctx.withChildren {
+		children = append(children, lhs)
+		children = append(children, cont.Children...)
+	}
+	if ctx.lossless {
+		nodes = append(nodes, lhs)
+		nodes = append(nodes, nodesOf(cont)...)
+	}
+	return &Tree{
+		Start:    start,
+		Match:    input[start:end],
+		Children: children,
+		Nodes:    nodes,
+		Tag:      l.tag,
 	}
 }
 
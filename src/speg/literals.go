@@ -0,0 +1,108 @@
+package speg
+
+import (
+	"github.com/google/uuid"
+	"sparse/src/trie"
+	"strconv"
+)
+
+// A LiteralsParser matches the longest of a set of literal strings. Build
+// one with Literals or LiteralsIgnoreCase.
+type LiteralsParser struct {
+	id    ID
+	words *trie.Trie
+	// folded holds the same words as words, and is used in a context that
+	// folds case.
+	folded *trie.Trie
+}
+
+// Literals returns a parser that matches the longest of words that is a
+// prefix of the input. Unlike an Or of Exactly parsers, the result doesn't
+// depend on the order of words, and the input is scanned once no matter how
+// many words there are. The result is tagged with the word that matched, so
+//
+//	Literals("<", "<=", "<<").Parse([]rune("<=1"), 0, ctx)
+//
+// returns a tree tagged "<=". In a context that folds case (see FoldCase),
+// Literals behaves like LiteralsIgnoreCase.
+func Literals(words ...string) LiteralsParser {
+	return LiteralsParser{
+		id:     uuid.New(),
+		words:  trie.New(words...),
+		folded: trie.NewFolded(words...),
+	}
+}
+
+// LiteralsIgnoreCase is like Literals, but matches without regard to case,
+// using Unicode simple case folding. The result is tagged with the word as it
+// was given to LiteralsIgnoreCase, not as it appears in the input, so the
+// tag can be used to identify the word.
+func LiteralsIgnoreCase(words ...string) LiteralsParser {
+	folded := trie.NewFolded(words...)
+	return LiteralsParser{
+		id:     uuid.New(),
+		words:  folded,
+		folded: folded,
+	}
+}
+
+func (p LiteralsParser) Omit() Parser {
+	return Omit(p)
+}
+
+func (p LiteralsParser) Star() Parser {
+	return Star(p)
+}
+
+func (p LiteralsParser) ID() uuid.UUID {
+	return p.id
+}
+
+func (p LiteralsParser) Tagged(tag string) TaggedParser {
+	return Tagged(p, tag)
+}
+
+func (p LiteralsParser) Parse(input []rune, start int, ctx *Context) *Tree {
+	cached, ok := ctx.getCachedValue(p.id, start)
+	if ok {
+		if cached == nil {
+			p.expect(ctx.skipTrivia(input, start), ctx)
+		}
+		return cached
+	}
+	words := p.words
+	if ctx.foldCase {
+		words = p.folded
+	}
+	pos := ctx.skipTrivia(input, start)
+	m, ok := words.Longest(input[pos:])
+	if !ok {
+		p.expect(pos, ctx)
+		ctx.setCachedValue(p.id, start, nil)
+		return nil
+	}
+	result := &Tree{
+		Start: start,
+		Match: input[start : pos+m.Length],
+		Tag:   words.Word(m.Word),
+	}
+	if pos > start {
+		result.Leading = input[start:pos]
+	}
+	ctx.setCachedValue(p.id, start, result)
+	return result
+}
+
+// maxExpectedLiterals is the largest set of literals that is listed word by
+// word in error messages. Larger sets are described as "literal".
+const maxExpectedLiterals = 8
+
+func (p LiteralsParser) expect(pos int, ctx *Context) {
+	if p.words.Len() > maxExpectedLiterals {
+		ctx.expect(pos, "literal")
+		return
+	}
+	for _, w := range p.words.Words() {
+		ctx.expect(pos, strconv.Quote(w))
+	}
+}
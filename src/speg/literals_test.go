@@ -0,0 +1,41 @@
+package speg
+
+import (
+	"github.com/shoenig/test"
+	"testing"
+)
+
+func TestLiterals(t *testing.T) {
+	ops := []string{"<", "<=", "<<", "<<=", "="}
+	tests := []struct {
+		name     string
+		parser   Parser
+		input    string
+		expected string
+	}{
+		{"longest", Literals(ops...), "<<=1", `(<<= "<<=")`},
+		{"shorter", Literals(ops...), "<<1", `(<< "<<")`},
+		{"shortest", Literals(ops...), "<1", `(< "<")`},
+		{"none", Literals(ops...), ">", `<nil>`},
+		{"order doesn't matter", Literals("=", "==", "==="), "===", `(=== "===")`},
+		{"ignore case", LiteralsIgnoreCase("select", "from", "where"), "FROM t", `(from "FROM")`},
+		{"ignore case unicode", LiteralsIgnoreCase("Straße"), "STRAßE", `(Straße "STRAßE")`},
+		{"ignore case none", LiteralsIgnoreCase("select"), "SELEC", `<nil>`},
+		{"in sequence", Seq(Literals("+", "++"), Literals("x")), "++x", `((++ "++") (x "x"))`},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			test.Eq(t, tc.expected, tc.parser.Parse([]rune(tc.input), 0, NewContext()).String())
+		})
+	}
+}
+
+func TestLiteralsExpectation(t *testing.T) {
+	ctx := NewContext()
+	test.Nil(t, Literals("+", "-").Parse([]rune("*"), 0, ctx))
+	test.EqError(t, ctx.Error(), `parse error at 0: expected "+" or "-"`)
+
+	ctx = NewContext()
+	test.Nil(t, Literals("a", "b", "c", "d", "e", "f", "g", "h", "i").Parse([]rune("*"), 0, ctx))
+	test.EqError(t, ctx.Error(), `parse error at 0: expected literal`)
+}
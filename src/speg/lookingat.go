@@ -8,7 +8,9 @@ type LookingAtParser struct {
 }
 
 func (p LookingAtParser) Parse(input []rune, start int, ctx *Context) *Tree {
-	x := p.parser.Parse(input, start, ctx.WithoutChildren())
+	mark := ctx.mark()
+	x := ctx.WithoutChildren().quietly().parse(p.parser, input, start)
+	ctx.reset(mark)
 	if x == nil {
 		return nil
 	}
@@ -0,0 +1,159 @@
+package speg
+
+// Lossless returns a new Context that shares this context's cache and builds
+// concrete syntax trees, from which the input can be reproduced exactly, for
+// tools like formatters that need every character:
+//
+//   - Every tree that has subtrees lists all of them in Nodes, including
+//     omitted ones, separators and the like, which Children leaves out.
+//     The Nodes of a tree cover its Match, in order, without gaps.
+//   - Trees without Nodes are leaves. The whitespace that Token skips is
+//     attached to the first leaf of its result as Leading trivia, and
+//     included in that leaf's Match. So is the trivia skipped within
+//     Skipping, comments included.
+//   - Omit and Token keep the subtrees of the trees they produce.
+//
+// When the parse is started with Context.Parse, trivia that follows a leaf on
+// the same line, up to and including the line break, is moved to the
+// Trailing trivia of that leaf, and the rest stays with the next leaf. So if
+// "1" and "y" are tokens in the input "x = 1  \n    y = 2", the leaf for "1"
+// has Trailing trivia "  \n", and the leaf for "y" has Leading trivia "    ".
+// To keep whitespace at the end of the input, end the grammar with
+// Token(Not(Any())).
+//
+// Concatenating the Match of each of the Leaves of the result reproduces the
+// input it matched.
+func (context *Context) Lossless() *Context {
+	result := *context
+	result.lossless = true
+	result.withChildren = true
+	return &result
+}
+
+// addChild adds tree, the result of parser, to the subtrees of a tree under
+// construction: to children, unless children aren't wanted or parser is
+// omitted, and to nodes in a lossless parse. Parser may be nil if tree
+// doesn't come directly from a parser.
+func (context *Context) addChild(children, nodes *[]*Tree, parser Parser, tree *Tree) {
+	if _, omitted := parser.(OmitParser); context.withChildren && !omitted {
+		*children = append(*children, tree)
+	}
+	if context.lossless {
+		*nodes = append(*nodes, tree)
+	}
+}
+
+// nodesOf returns the subtrees of t that cover its Match: its Nodes, or t
+// itself if it's a leaf.
+func nodesOf(t *Tree) []*Tree {
+	if len(t.Nodes) > 0 {
+		return t.Nodes
+	}
+	return []*Tree{t}
+}
+
+// withLeading returns a copy of t whose first leaf is extended backward over
+// n runes of leading trivia. t is not modified, since it may be cached.
+func withLeading(t *Tree, input []rune, n int) *Tree {
+	result := *t
+	result.Start -= n
+	result.Match = input[result.Start : t.Start+len(t.Match)]
+	if len(t.Nodes) == 0 {
+		result.Leading = input[result.Start : t.Start+len(t.Leading)]
+		return &result
+	}
+	first := withLeading(t.Nodes[0], input, n)
+	result.Nodes = append([]*Tree{first}, t.Nodes[1:]...)
+	result.Children = replaceTree(t.Children, t.Nodes[0], first)
+	return &result
+}
+
+// replaceTree returns trees with old replaced by new. It copies trees if
+// there's anything to replace.
+func replaceTree(trees []*Tree, old, new *Tree) []*Tree {
+	for k, t := range trees {
+		if t == old {
+			result := append([]*Tree(nil), trees...)
+			result[k] = new
+			return result
+		}
+	}
+	return trees
+}
+
+// attachTrailing moves the trivia after each leaf of root, up to the end of
+// its line, from the Leading trivia of the next leaf to the Trailing trivia of
+// that one. It returns a new tree, leaving root, which may be cached, alone.
+func attachTrailing(root *Tree, input []rune) *Tree {
+	leaves := root.Leaves()
+	type bounds struct{ start, end, leading, trailing int }
+	newBounds := make(map[*Tree]bounds, len(leaves))
+	for _, leaf := range leaves {
+		newBounds[leaf] = bounds{leaf.Start, leaf.Start + len(leaf.Match), len(leaf.Leading), len(leaf.Trailing)}
+	}
+	var prev *Tree
+	// empty holds the empty leaves since prev, which move along with the end
+	// of prev.
+	var empty []*Tree
+	for _, leaf := range leaves {
+		b := newBounds[leaf]
+		if b.leading > 0 && prev != nil {
+			n := b.leading
+			for k, r := range leaf.Leading {
+				if r == '\n' {
+					n = k + 1
+					break
+				}
+			}
+			p := newBounds[prev]
+			p.end += n
+			p.trailing += n
+			newBounds[prev] = p
+			b.start += n
+			b.leading -= n
+			newBounds[leaf] = b
+			for _, e := range empty {
+				newBounds[e] = bounds{start: p.end, end: p.end}
+			}
+		}
+		switch {
+		case len(leaf.Match) > len(leaf.Leading):
+			prev = leaf
+			empty = nil
+		case len(leaf.Match) == 0:
+			empty = append(empty, leaf)
+		}
+	}
+
+	rebuilt := make(map[*Tree]*Tree)
+	var rebuild func(t *Tree) *Tree
+	rebuild = func(t *Tree) *Tree {
+		if r, ok := rebuilt[t]; ok {
+			return r
+		}
+		result := *t
+		if b, ok := newBounds[t]; ok && len(t.Nodes) == 0 {
+			result.Start = b.start
+			result.Match = input[b.start:b.end]
+			result.Leading = input[b.start : b.start+b.leading]
+			result.Trailing = input[b.end-b.trailing : b.end]
+		} else if len(t.Nodes) > 0 {
+			result.Nodes = make([]*Tree, len(t.Nodes))
+			for k, node := range t.Nodes {
+				result.Nodes[k] = rebuild(node)
+			}
+			first, last := result.Nodes[0], result.Nodes[len(result.Nodes)-1]
+			result.Start = first.Start
+			result.Match = input[first.Start : last.Start+len(last.Match)]
+			if t.Children != nil {
+				result.Children = make([]*Tree, len(t.Children))
+				for k, child := range t.Children {
+					result.Children[k] = rebuild(child)
+				}
+			}
+		}
+		rebuilt[t] = &result
+		return &result
+	}
+	return rebuild(root)
+}
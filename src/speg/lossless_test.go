@@ -0,0 +1,71 @@
+package speg
+
+import (
+	"fmt"
+	"github.com/shoenig/test"
+	"strings"
+	"testing"
+)
+
+func letGrammar() Parser {
+	name := Token(Letters()).Tagged("name")
+	num := Token(Digits()).Tagged("num")
+	expr := Operators(num).Infix(Token(Exactly("+")).Omit(), 1, AssocLeft, "sum")
+	stmt := Seq(Token(Keyword("let")).Omit(), name, Token(Exactly("=")).Omit(), expr, Token(Exactly(";")).Omit()).Tagged("let")
+	return Seq(Star(stmt), Token(Not(Any())).Omit())
+}
+
+func TestLossless(t *testing.T) {
+	input := []rune("let x = 1 + 2;  \n\n  let y=3;\n")
+	grammar := letGrammar()
+	tree := NewContext().Lossless().Parse(grammar, input, 0)
+	test.NotNil(t, tree)
+
+	// The leaves reproduce the input.
+	var b strings.Builder
+	var leaves []string
+	for _, leaf := range tree.Leaves() {
+		b.WriteString(string(leaf.Match))
+		if len(leaf.Match) > 0 {
+			leaves = append(leaves, fmt.Sprintf("%q%q%q", string(leaf.Leading), leaf.Text(), string(leaf.Trailing)))
+		}
+	}
+	test.Eq(t, string(input), b.String())
+
+	// Trivia up to the end of the line trails a token; the rest leads the
+	// next one.
+	test.Eq(t, []string{
+		`"""let"" "`, `"""x"" "`, `"""="" "`, `"""1"" "`, `"""+"" "`, `"""2"""`, `""";""  \n"`,
+		`"\n  ""let"" "`, `"""y"""`, `"""="""`, `"""3"""`, `""";""\n"`,
+	}, leaves)
+
+	// Children are the same as in an ordinary parse, and print the same
+	// since String leaves out trivia.
+	test.Eq(t, grammar.Parse(input, 0, NewContext()).String(), tree.String())
+}
+
+func TestLosslessNodes(t *testing.T) {
+	list := Between(Exactly("["), SepEndBy(Token(Digits()), Token(Exactly(","))), Token(Exactly("]")))
+	input := []rune("[1, 2 ,]")
+	tree := NewContext().Lossless().Parse(list, input, 0)
+	test.Eq(t, `((("1") ("2")))`, tree.String())
+	// The brackets and commas are nodes, though not children.
+	var nodes []string
+	for _, node := range tree.Nodes[1].Nodes {
+		nodes = append(nodes, string(node.Match))
+	}
+	// The space after "2" is its trailing trivia.
+	test.Eq(t, []string{"1", ", ", "2 ", ","}, nodes)
+	test.Eq(t, "[", string(tree.Nodes[0].Match))
+	test.Eq(t, "]", string(tree.Nodes[2].Match))
+}
+
+func TestLosslessDoesNotChangeCache(t *testing.T) {
+	grammar := letGrammar()
+	input := []rune("let x = 1;")
+	ctx := NewContext()
+	plain := grammar.Parse(input, 0, ctx).String()
+	test.NotNil(t, ctx.Lossless().Parse(grammar, input, 0))
+	test.Eq(t, plain, grammar.Parse(input, 0, ctx).String())
+	test.Nil(t, grammar.Parse(input, 0, ctx).Nodes)
+}
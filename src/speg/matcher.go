@@ -2,6 +2,9 @@ package speg
 
 import (
 	"github.com/google/uuid"
+	"math/rand/v2"
+	"sparse/src/trie"
+	"strconv"
 	"unicode"
 )
 
@@ -9,45 +12,91 @@ import (
 // If it succeeds, it returns the length of the match. If it fails, it returns -1.
 type MatchingFunc = func(input []rune) int
 
+// A GeneratingFunc produces a random string that its Matcher would match in full.
+// It is used by Generator.
+type GeneratingFunc = func(r *rand.Rand) []rune
+
 // A Matcher is a parser that employs a MatchingFunc to scan input.
 type Matcher struct {
 	id           ID
 	matchingFunc MatchingFunc
 	tag          string
+	generate     GeneratingFunc
+	expected     string
+	// folded, if not nil, is used instead of matchingFunc in a context that
+	// folds case. Only matchers for literal text have one.
+	folded MatchingFunc
+	// skips is set for matchers that skip trivia within Skipping.
+	skips bool
+	// literal is the text matched by a matcher for a single literal, like
+	// Exactly or Keyword, which Unparser prints where it was omitted.
+	literal string
 }
 
 func (m Matcher) Star() Matcher {
+	var generate GeneratingFunc
+	if m.generate != nil {
+		generate = func(r *rand.Rand) []rune {
+			var result []rune
+			for n := r.IntN(4); n > 0; n-- {
+				result = append(result, m.generate(r)...)
+			}
+			return result
+		}
+	}
+	var folded MatchingFunc
+	if m.folded != nil {
+		folded = star(m.folded)
+	}
 	return Matcher{
-		id: uuid.New(),
-		matchingFunc: func(input []rune) int {
-			result := 0
-			for {
-				length := m.matchingFunc(input[result:])
-				if length <= 0 {
-					return result
-				}
-				result += length
+		id:           uuid.New(),
+		matchingFunc: star(m.matchingFunc),
+		generate:     generate,
+		folded:       folded,
+	}
+}
+
+func star(f MatchingFunc) MatchingFunc {
+	return func(input []rune) int {
+		result := 0
+		for {
+			length := f(input[result:])
+			if length <= 0 {
+				return result
 			}
-		},
+			result += length
+		}
 	}
 }
 
 func (m Matcher) Parse(input []rune, start int, ctx *Context) *Tree {
 	cachedResult, isCached := ctx.getCachedValue(m.id, start)
 	if isCached {
+		if cachedResult == nil {
+			ctx.expect(m.skipTrivia(input, start, ctx), m.expectation())
+		}
 		return cachedResult
 	}
 
-	length := m.matchingFunc(input[start:])
+	match := m.matchingFunc
+	if ctx.foldCase && m.folded != nil {
+		match = m.folded
+	}
+	pos := m.skipTrivia(input, start, ctx)
+	length := match(input[pos:])
 	if length == -1 {
+		ctx.expect(pos, m.expectation())
 		ctx.setCachedValue(m.id, start, nil)
 		return nil
 	}
 	result := &Tree{
 		Start: start,
-		Match: input[start : start+length],
+		Match: input[start : pos+length],
 		Tag:   m.tag,
 	}
+	if pos > start {
+		result.Leading = input[start:pos]
+	}
 	ctx.setCachedValue(m.id, start, result)
 	return result
 }
@@ -57,11 +106,43 @@ func (m Matcher) ID() uuid.UUID {
 }
 
 func (m Matcher) Tagged(tag string) Parser {
-	return Matcher{
-		id:           uuid.New(),
-		matchingFunc: m.matchingFunc,
-		tag:          tag,
+	m.id = uuid.New()
+	m.tag = tag
+	return m
+}
+
+// skipTrivia returns the position of the text m is to match, after any
+// trivia at start that it skips.
+func (m Matcher) skipTrivia(input []rune, start int, ctx *Context) int {
+	if !m.skips {
+		return start
 	}
+	return ctx.skipTrivia(input, start)
+}
+
+// Expecting returns a copy of m that is described as expected when it fails
+// to match. See Context.Error.
+func (m Matcher) Expecting(expected string) Matcher {
+	m.id = uuid.New()
+	m.expected = expected
+	return m
+}
+
+// expectation describes what m matches, for error messages.
+func (m Matcher) expectation() string {
+	if m.expected != "" {
+		return m.expected
+	}
+	return m.tag
+}
+
+// WithGenerator returns a copy of m that uses generate to produce sample input
+// for Generator. Without one, a Generator has to guess at input for matchers
+// created with NewMatcher.
+func (m Matcher) WithGenerator(generate GeneratingFunc) Matcher {
+	m.id = uuid.New()
+	m.generate = generate
+	return m
 }
 
 func (m Matcher) Omit() Parser {
@@ -84,23 +165,32 @@ func Any() Matcher {
 		}
 		return 1
 	})
+	result.generate = func(r *rand.Rand) []rune {
+		return []rune{rune(' ' + r.IntN('~'-' '+1))}
+	}
+	result.expected = "any character"
 	return result
 }
 
 // Letter matches any single unicode letter. It fails if the first
 // rune in the input is not a letter.
 func Letter() Matcher {
-	return NewMatcher(func(input []rune) int {
+	result := NewMatcher(func(input []rune) int {
 		if len(input) == 0 || !unicode.IsLetter(input[0]) {
 			return -1
 		}
 		return 1
 	})
+	result.generate = func(r *rand.Rand) []rune {
+		return []rune{randomLetter(r)}
+	}
+	result.expected = "letter"
+	return result
 }
 
 // Letters matches one or more unicode letter runes.
 func Letters() Matcher {
-	return NewMatcher(func(input []rune) int {
+	result := NewMatcher(func(input []rune) int {
 		if len(input) == 0 || !unicode.IsLetter(input[0]) {
 			return -1
 		}
@@ -111,20 +201,34 @@ func Letters() Matcher {
 		}
 		return len(input)
 	})
+	result.generate = func(r *rand.Rand) []rune {
+		letters := make([]rune, 1+r.IntN(6))
+		for k := range letters {
+			letters[k] = randomLetter(r)
+		}
+		return letters
+	}
+	result.expected = "letters"
+	return result
 }
 
 // Digit matches any single unicode digit.
 func Digit() Matcher {
-	return NewMatcher(func(input []rune) int {
+	result := NewMatcher(func(input []rune) int {
 		if len(input) == 0 || !unicode.IsDigit(input[0]) {
 			return -1
 		}
 		return 1
 	})
+	result.generate = func(r *rand.Rand) []rune {
+		return []rune{rune('0' + r.IntN(10))}
+	}
+	result.expected = "digit"
+	return result
 }
 
 func Digits() Matcher {
-	return NewMatcher(func(input []rune) int {
+	result := NewMatcher(func(input []rune) int {
 		if len(input) == 0 || !unicode.IsDigit(input[0]) {
 			return -1
 		}
@@ -135,21 +239,81 @@ func Digits() Matcher {
 		}
 		return len(input)
 	})
+	result.generate = func(r *rand.Rand) []rune {
+		digits := make([]rune, 1+r.IntN(6))
+		for k := range digits {
+			digits[k] = rune('0' + r.IntN(10))
+		}
+		return digits
+	}
+	result.expected = "digits"
+	return result
 }
 
+// Exactly matches s. In a context that folds case (see FoldCase), it matches s
+// without regard to case.
 func Exactly(s string) Matcher {
-	return NewMatcher(func(input []rune) int {
-		for pos, r := range s {
-			if pos >= len(input) || input[pos] != r {
+	target := []rune(s)
+	result := NewMatcher(matchRunes(target, false))
+	result.folded = matchRunes(target, true)
+	result.skips = true
+	result.literal = s
+	result.generate = func(r *rand.Rand) []rune {
+		return []rune(s)
+	}
+	result.expected = strconv.Quote(s)
+	return result
+}
+
+// IgnoreCase matches s without regard to case, using Unicode simple case
+// folding, so IgnoreCase("select") matches "SELECT" and IgnoreCase("σίσυφος")
+// matches "ΣΊΣΥΦΟΣ". Since simple folding maps each rune to a single rune,
+// the match is always as long as s.
+func IgnoreCase(s string) Matcher {
+	target := []rune(s)
+	result := NewMatcher(matchRunes(target, true))
+	result.folded = result.matchingFunc
+	result.skips = true
+	result.literal = s
+	result.generate = func(r *rand.Rand) []rune {
+		runes := make([]rune, len(target))
+		for k, t := range target {
+			runes[k] = randomCase(r, t)
+		}
+		return runes
+	}
+	result.expected = strconv.Quote(s)
+	return result
+}
+
+// matchRunes returns a MatchingFunc that matches target, ignoring case if
+// fold is set.
+func matchRunes(target []rune, fold bool) MatchingFunc {
+	return func(input []rune) int {
+		if len(input) < len(target) {
+			return -1
+		}
+		for k, t := range target {
+			if input[k] != t && (!fold || trie.Fold(input[k]) != trie.Fold(t)) {
 				return -1
 			}
 		}
-		return len(s)
-	})
+		return len(target)
+	}
+}
+
+// randomCase returns a rune chosen at random from those equal to r ignoring
+// case.
+func randomCase(rnd *rand.Rand, r rune) rune {
+	runes := []rune{r}
+	for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+		runes = append(runes, f)
+	}
+	return runes[rnd.IntN(len(runes))]
 }
 
 func WhiteSpace() Matcher {
-	return NewMatcher(func(input []rune) int {
+	result := NewMatcher(func(input []rune) int {
 		if len(input) == 0 || !unicode.IsSpace(input[0]) {
 			return -1
 		}
@@ -160,4 +324,29 @@ func WhiteSpace() Matcher {
 		}
 		return len(input)
 	})
+	result.generate = func(r *rand.Rand) []rune {
+		return randomSpace(r, 1)
+	}
+	result.expected = "whitespace"
+	return result
+}
+
+// randomLetter returns a random letter, usually but not always ASCII.
+func randomLetter(r *rand.Rand) rune {
+	if r.IntN(8) == 0 {
+		return []rune("éßπжλ")[r.IntN(5)]
+	}
+	if r.IntN(2) == 0 {
+		return rune('A' + r.IntN(26))
+	}
+	return rune('a' + r.IntN(26))
+}
+
+// randomSpace returns at least min random whitespace runes.
+func randomSpace(r *rand.Rand, min int) []rune {
+	space := make([]rune, min+r.IntN(3))
+	for k := range space {
+		space[k] = []rune(" \t\n")[r.IntN(3)]
+	}
+	return space
 }
@@ -12,7 +12,7 @@ func (n NotParser) Omit() Parser {
 }
 
 func (n NotParser) Parse(input []rune, start int, ctx *Context) *Tree {
-	x := n.parser.Parse(input, start, ctx)
+	x := ctx.quietly().parse(n.parser, input, start)
 	if x == nil {
 		return &Tree{
 			Start:    start,
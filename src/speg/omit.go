@@ -9,7 +9,7 @@ type OmitParser struct {
 }
 
 func (o OmitParser) Parse(input []rune, start int, ctx *Context) *Tree {
-	result := o.parser.Parse(input, start, ctx.WithoutChildren())
+	result := ctx.WithoutChildren().parse(o.parser, input, start)
 	if result == nil {
 		return nil
 	}
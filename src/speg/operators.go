@@ -0,0 +1,226 @@
+package speg
+
+import (
+	"github.com/google/uuid"
+	"math"
+)
+
+// Assoc is the associativity of an infix operator.
+type Assoc int
+
+const (
+	// AssocLeft groups a+b+c as (a+b)+c.
+	AssocLeft Assoc = iota
+	// AssocRight groups a^b^c as a^(b^c).
+	AssocRight
+	// AssocNone does not group at all: a<b<c matches only a<b.
+	AssocNone
+)
+
+type operatorKind int
+
+const (
+	prefixOperator operatorKind = iota
+	postfixOperator
+	infixOperator
+)
+
+type operator struct {
+	kind       operatorKind
+	parser     Parser
+	precedence int
+	assoc      Assoc
+	tag        string
+}
+
+// An OperatorParser parses expressions built from operands and prefix,
+// postfix and infix operators by precedence climbing. Build one with
+// Operators and add operators with Prefix, Postfix and Infix.
+//
+// The trees it produces have the same shape as trees built by layering
+// Left parsers, one level per precedence: an infix expression has three
+// children (left operand, operator and right operand), a prefix expression
+// has the operator followed by the operand, and a postfix expression has the
+// operand followed by the operator. Each is tagged with the tag given for
+// its operator. An operator parser that is omitted (see Omit) is not included
+// in the children.
+//
+// Operators are tried in the order they were added, so when one operator is a
+// prefix of another, add the longer one first.
+type OperatorParser struct {
+	id        uuid.UUID
+	operand   Parser
+	operators []operator
+}
+
+// Operators returns a parser for expressions whose operands are matched by
+// operand. It has no operators until some are added:
+//
+//	expr := Operators(factor).
+//		Infix(addOp, 1, AssocLeft, "sum").
+//		Infix(multOp, 2, AssocLeft, "prod").
+//		Prefix(Token(Exactly("-")), 3, "neg").
+//		Infix(Token(Exactly("^")), 4, AssocRight, "pow")
+//
+// Higher precedences bind more tightly.
+func Operators(operand Parser) OperatorParser {
+	return OperatorParser{
+		id:      uuid.New(),
+		operand: operand,
+	}
+}
+
+func (o OperatorParser) with(op operator) OperatorParser {
+	operators := make([]operator, len(o.operators), len(o.operators)+1)
+	copy(operators, o.operators)
+	return OperatorParser{
+		id:        uuid.New(),
+		operand:   o.operand,
+		operators: append(operators, op),
+	}
+}
+
+// Prefix returns a new OperatorParser that additionally accepts the prefix
+// operator op. Its operand extends over operators with precedence at least
+// precedence, so -a^b is -(a^b) if ^ has higher precedence than -, but -a+b is
+// (-a)+b if + has lower precedence.
+func (o OperatorParser) Prefix(op Parser, precedence int, tag string) OperatorParser {
+	return o.with(operator{kind: prefixOperator, parser: op, precedence: precedence, tag: tag})
+}
+
+// Postfix returns a new OperatorParser that additionally accepts the postfix
+// operator op.
+func (o OperatorParser) Postfix(op Parser, precedence int, tag string) OperatorParser {
+	return o.with(operator{kind: postfixOperator, parser: op, precedence: precedence, tag: tag})
+}
+
+// Infix returns a new OperatorParser that additionally accepts the infix
+// operator op with the given precedence and associativity.
+func (o OperatorParser) Infix(op Parser, precedence int, assoc Assoc, tag string) OperatorParser {
+	return o.with(operator{kind: infixOperator, parser: op, precedence: precedence, assoc: assoc, tag: tag})
+}
+
+func (o OperatorParser) Omit() Parser {
+	return Omit(o)
+}
+
+func (o OperatorParser) Star() Parser {
+	return Star(o)
+}
+
+func (o OperatorParser) Flatten() TokenParser {
+	return Token(o)
+}
+
+func (o OperatorParser) ID() uuid.UUID {
+	return o.id
+}
+
+func (o OperatorParser) Tagged(tag string) TaggedParser {
+	return Tagged(o, tag)
+}
+
+func (o OperatorParser) Parse(input []rune, start int, ctx *Context) *Tree {
+	result, ok := ctx.getCachedValue(o.id, start)
+	if ok {
+		return result
+	}
+	result = o.parseExpr(input, start, math.MinInt, ctx)
+	ctx.setCachedValue(o.id, start, result)
+	return result
+}
+
+// parseExpr parses the longest expression starting at start whose operators
+// all have precedence at least minPrecedence.
+func (o OperatorParser) parseExpr(input []rune, start int, minPrecedence int, ctx *Context) *Tree {
+	lhs := o.parsePrefix(input, start, ctx)
+	if lhs == nil {
+		return nil
+	}
+	pos := start + len(lhs.Match)
+	// A non-associative operator may not be followed immediately by another
+	// operator of the same precedence.
+	var nonAssoc *operator
+	for {
+		mark := ctx.mark()
+		op, opTree := o.match(input, pos, minPrecedence, postfixOperator, infixOperator, ctx)
+		if op == nil || (nonAssoc != nil && op.kind == infixOperator && op.precedence == nonAssoc.precedence) {
+			ctx.reset(mark)
+			return lhs
+		}
+		end := pos + len(opTree.Match)
+		if op.kind == postfixOperator {
+			lhs = o.node(input, start, end, op, opTree, ctx, lhs, opTree)
+			pos = end
+			continue
+		}
+		next := op.precedence + 1
+		if op.assoc == AssocRight {
+			next = op.precedence
+		}
+		rhs := o.parseExpr(input, end, next, ctx)
+		if rhs == nil {
+			ctx.reset(mark)
+			return lhs
+		}
+		pos = end + len(rhs.Match)
+		lhs = o.node(input, start, pos, op, opTree, ctx, lhs, opTree, rhs)
+		nonAssoc = nil
+		if op.assoc == AssocNone {
+			nonAssoc = op
+		}
+	}
+}
+
+// parsePrefix parses an operand, preceded by any number of prefix operators.
+// Prefix operators are unambiguous wherever an operand may appear, so they
+// are accepted regardless of their precedence.
+func (o OperatorParser) parsePrefix(input []rune, start int, ctx *Context) *Tree {
+	mark := ctx.mark()
+	op, opTree := o.match(input, start, math.MinInt, prefixOperator, prefixOperator, ctx)
+	if op == nil {
+		return ctx.parse(o.operand, input, start)
+	}
+	end := start + len(opTree.Match)
+	operand := o.parseExpr(input, end, op.precedence, ctx)
+	if operand == nil {
+		ctx.reset(mark)
+		return ctx.parse(o.operand, input, start)
+	}
+	return o.node(input, start, end+len(operand.Match), op, opTree, ctx, opTree, operand)
+}
+
+// match tries each operator of one of the two kinds with precedence at
+// least minPrecedence, and returns the first that matches at pos.
+func (o OperatorParser) match(input []rune, pos int, minPrecedence int, kind1, kind2 operatorKind, ctx *Context) (*operator, *Tree) {
+	for k := range o.operators {
+		op := &o.operators[k]
+		if (op.kind != kind1 && op.kind != kind2) || op.precedence < minPrecedence {
+			continue
+		}
+		if tree := ctx.parse(op.parser, input, pos); tree != nil {
+			return op, tree
+		}
+	}
+	return nil, nil
+}
+
+// node builds the tree for an application of op, whose own tree is opTree,
+// and whose operator and operands are parts, in order.
+func (o OperatorParser) node(input []rune, start, end int, op *operator, opTree *Tree, ctx *Context, parts ...*Tree) *Tree {
+	var children, nodes []*Tree
+	for _, part := range parts {
+		var parser Parser
+		if part == opTree {
+			parser = op.parser
+		}
+		ctx.addChild(&children, &nodes, parser, part)
+	}
+	return &Tree{
+		Start:    start,
+		Match:    input[start:end],
+		Children: children,
+		Nodes:    nodes,
+		Tag:      op.tag,
+	}
+}
@@ -0,0 +1,65 @@
+package speg
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/shoenig/test"
+)
+
+func TestOperators(t *testing.T) {
+	varname := Token(Letters()).Tagged("var")
+	number := Token(Digits()).Tagged("num")
+	lparen := Token(Exactly("("))
+	rparen := Token(Exactly(")"))
+	var expr Parser
+	factor := Or(
+		varname,
+		number,
+		Seq(lparen.Omit(), Indirect(&expr), rparen.Omit()).Tagged("expr"),
+	)
+	expr = Operators(factor).
+		Infix(Token(Or(Exactly("+"), Exactly("-"))), 1, AssocLeft, "sum").
+		Infix(Token(Or(Exactly("*"), Exactly("/"))), 2, AssocLeft, "prod").
+		Infix(Token(Exactly("<")), 0, AssocNone, "less").
+		Prefix(Token(Exactly("-")), 3, "neg").
+		Infix(Token(Exactly("^")), 4, AssocRight, "pow").
+		Postfix(Token(Exactly("!")), 5, "fact").
+		Infix(Token(Exactly("=")).Omit(), -1, AssocRight, "assign")
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"base", "x", `(var "x")`},
+		{"add", "x + y", `(sum (var "x") ("+") (var "y"))`},
+		{"left associative", "x+y-z", `(sum (sum (var "x") ("+") (var "y")) ("-") (var "z"))`},
+		{"precedence", "x+y*z", `(sum (var "x") ("+") (prod (var "y") ("*") (var "z")))`},
+		{"parens", "x*(3+2)", `(prod (var "x") ("*") (expr (sum (num "3") ("+") (num "2"))))`},
+		{"right associative", "a^b^c", `(pow (var "a") ("^") (pow (var "b") ("^") (var "c")))`},
+		{"prefix binds looser than pow", "-a^b", `(neg ("-") (pow (var "a") ("^") (var "b")))`},
+		{"prefix binds tighter than sum", "-a+b", `(sum (neg ("-") (var "a")) ("+") (var "b"))`},
+		{"prefix after infix", "a*-b", `(prod (var "a") ("*") (neg ("-") (var "b")))`},
+		{"double prefix", "--a", `(neg ("-") (neg ("-") (var "a")))`},
+		{"postfix", "a!+b", `(sum (fact (var "a") ("!")) ("+") (var "b"))`},
+		{"postfix twice", "a!!", `(fact (fact (var "a") ("!")) ("!"))`},
+		{"non associative", "a<b<c", `(less (var "a") ("<") (var "b"))`},
+		{"omitted operator", "a = b = c+1", `(assign (var "a") (assign (var "b") (sum (var "c") ("+") (num "1"))))`},
+		{"dangling operator", "a+", `(var "a")`},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			test.Eq(t, tc.expected, expr.Parse([]rune(tc.input), 0, NewContext()).String())
+		})
+	}
+}
+
+func TestOperatorsManyLevels(t *testing.T) {
+	ops := Operators(Token(Digits()).Tagged("num"))
+	for level := 0; level < 40; level++ {
+		ops = ops.Infix(Token(Exactly(fmt.Sprintf("<%d>", level))), level, AssocLeft, fmt.Sprintf("l%d", level))
+	}
+	tree := ops.Parse([]rune("1 <39> 2 <0> 3 <39> 4"), 0, NewContext())
+	test.Eq(t, `(l0 (l39 (num "1") ("<39>") (num "2")) ("<0>") (l39 (num "3") ("<39>") (num "4")))`, tree.String())
+}
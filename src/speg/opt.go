@@ -28,7 +28,10 @@ func (o OptionalParser) Parse(input []rune, start int, context *Context) *Tree {
 		return myResult
 	}
 
-	tree := o.parser.Parse(input, start, context)
+	tree := context.parse(o.parser, input, start)
+	if context.coverage != nil {
+		context.coverage.chose(o.id, boolIndex(tree != nil))
+	}
 	if tree == nil {
 		tree = &Tree{
 			Start: start,
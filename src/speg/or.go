@@ -31,9 +31,13 @@ func (p OrParser) Parse(input []rune, start int, context *Context) *Tree {
 		return result
 	}
 
-	for _, parser := range p.subParsers {
-		try := parser.Parse(input, start, context)
+	for k, parser := range p.subParsers {
+		try := context.parse(parser, input, start)
 		if try != nil {
+			if context.coverage != nil {
+				context.coverage.chose(p.id, k)
+			}
+			context.forget(p.id, start)
 			return try
 		}
 	}
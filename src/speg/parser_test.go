@@ -483,3 +483,12 @@ func TestLeft(t *testing.T) {
 // 	}
 // }
 //
+
+func TestStarMemoWithChildren(t *testing.T) {
+	// The first alternative parses s within Token, without children, and
+	// fails. The second must not get the childless result from the cache.
+	s := Star(Seq(Letter()))
+	grammar := Or(Seq(Token(s), Exactly("!")), s)
+	tree := grammar.Parse([]rune("ab"), 0, NewContext())
+	test.Eq(t, `(("a") ("b"))`, tree.String())
+}
@@ -0,0 +1,426 @@
+package speg
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// A Pattern matches trees. Patterns are written like the S-expressions that
+// Tree.String prints, with metavariables and wildcards:
+//
+//   - "text", a quoted string, matches an untagged leaf with that text.
+//   - (tag p...) matches a tree tagged tag whose children match p..., in
+//     order. A tagged leaf is taken to have a single untagged leaf for its
+//     text as its child, as it is printed, so (num "0") matches it.
+//   - (p...), without a tag, matches an untagged tree, and (* p...) a tree
+//     with any tag.
+//   - _ matches any tree.
+//   - $name matches any tree, and binds name to it. If $name appears more
+//     than once, the trees it matches must be the same.
+//   - ... matches any number of children, and $name... binds name to them,
+//     as the children of an untagged tree.
+//
+// A tag is any word, that is, any run of runes other than spaces, parentheses
+// and quotes.
+type Pattern struct {
+	root *patternNode
+	text string
+}
+
+// A Bindings maps the metavariables of a Pattern to the trees they matched.
+type Bindings map[string]*Tree
+
+type patternKind int
+
+const (
+	textPattern patternKind = iota
+	treePattern
+	anyPattern
+	variablePattern
+	restPattern
+)
+
+type patternNode struct {
+	kind patternKind
+	// text is the text of a textPattern, or the name of a variable.
+	text string
+	// tag is the tag of a treePattern, and anyTag is set for (* ...).
+	tag      string
+	anyTag   bool
+	children []*patternNode
+}
+
+// CompilePattern parses a Pattern.
+func CompilePattern(s string) (*Pattern, error) {
+	p := &patternParser{input: []rune(s)}
+	root, err := p.node()
+	if err == nil {
+		p.space()
+		if p.pos < len(p.input) {
+			err = p.errorf("unexpected %q", p.input[p.pos])
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if root.kind == restPattern {
+		return nil, fmt.Errorf("pattern %q: ... outside of a tree", s)
+	}
+	return &Pattern{root: root, text: s}, nil
+}
+
+// MustCompilePattern is like CompilePattern, but panics if s is invalid.
+func MustCompilePattern(s string) *Pattern {
+	p, err := CompilePattern(s)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+func (p *Pattern) String() string {
+	return p.text
+}
+
+// Match reports whether t matches p, and if so, what its metavariables
+// matched.
+func (p *Pattern) Match(t *Tree) (Bindings, bool) {
+	b := Bindings{}
+	if !match(p.root, t, b) {
+		return nil, false
+	}
+	return b, true
+}
+
+func match(p *patternNode, t *Tree, b Bindings) bool {
+	if t == nil {
+		return false
+	}
+	switch p.kind {
+	case anyPattern:
+		return true
+	case variablePattern:
+		if bound, ok := b[p.text]; ok {
+			return sameTree(bound, t)
+		}
+		b[p.text] = t
+		return true
+	case textPattern:
+		return t.Tag == "" && t.Children == nil && t.Text() == p.text
+	case treePattern:
+		if !p.anyTag && t.Tag != p.tag {
+			return false
+		}
+		children := t.Children
+		if children == nil {
+			if t.Tag == "" {
+				// An untagged leaf is printed as text, not a tree.
+				return false
+			}
+			children = []*Tree{textLeaf(t)}
+		}
+		return matchChildren(p.children, children, b)
+	}
+	return false
+}
+
+// matchChildren matches patterns against trees, backtracking over the
+// number of trees each ... matches.
+func matchChildren(patterns []*patternNode, trees []*Tree, b Bindings) bool {
+	if len(patterns) == 0 {
+		return len(trees) == 0
+	}
+	p := patterns[0]
+	if p.kind != restPattern {
+		if len(trees) == 0 {
+			return false
+		}
+		saved := maps.Clone(b)
+		if match(p, trees[0], b) && matchChildren(patterns[1:], trees[1:], b) {
+			return true
+		}
+		restore(b, saved)
+		return false
+	}
+	for n := 0; n <= len(trees); n++ {
+		saved := maps.Clone(b)
+		if p.text != "" {
+			rest := &Tree{Children: trees[:n:n]}
+			if bound, ok := b[p.text]; ok && !sameTree(bound, rest) {
+				continue
+			}
+			b[p.text] = rest
+		}
+		if matchChildren(patterns[1:], trees[n:], b) {
+			return true
+		}
+		restore(b, saved)
+	}
+	return false
+}
+
+func restore(b, saved Bindings) {
+	clear(b)
+	maps.Copy(b, saved)
+}
+
+// textLeaf returns an untagged leaf for the text of t.
+func textLeaf(t *Tree) *Tree {
+	return &Tree{
+		Start: t.Start + len(t.Leading),
+		Match: t.Match[len(t.Leading) : len(t.Match)-len(t.Trailing)],
+	}
+}
+
+// sameTree reports whether a and b have the same tags, text and shape,
+// wherever they are in the input.
+func sameTree(a, b *Tree) bool {
+	if a.Tag != b.Tag || len(a.Children) != len(b.Children) || (a.Children == nil) != (b.Children == nil) {
+		return false
+	}
+	if a.Children == nil {
+		return a.Text() == b.Text()
+	}
+	for k := range a.Children {
+		if !sameTree(a.Children[k], b.Children[k]) {
+			return false
+		}
+	}
+	return true
+}
+
+// A patternParser parses the text of a Pattern.
+type patternParser struct {
+	input []rune
+	pos   int
+}
+
+func (p *patternParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("pattern %q at %d: %s", string(p.input), p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *patternParser) space() {
+	for p.pos < len(p.input) && unicode.IsSpace(p.input[p.pos]) {
+		p.pos++
+	}
+}
+
+// word returns the word at the current position.
+func (p *patternParser) word() string {
+	start := p.pos
+	for p.pos < len(p.input) && !unicode.IsSpace(p.input[p.pos]) && !strings.ContainsRune(`()"`, p.input[p.pos]) {
+		p.pos++
+	}
+	return string(p.input[start:p.pos])
+}
+
+func (p *patternParser) node() (*patternNode, error) {
+	p.space()
+	if p.pos == len(p.input) {
+		return nil, p.errorf("unexpected end")
+	}
+	switch p.input[p.pos] {
+	case '"':
+		start := p.pos
+		for p.pos++; p.pos < len(p.input) && p.input[p.pos] != '"'; p.pos++ {
+			if p.input[p.pos] == '\\' {
+				p.pos++
+			}
+		}
+		if p.pos >= len(p.input) {
+			return nil, p.errorf("unterminated string")
+		}
+		p.pos++
+		text, err := strconv.Unquote(string(p.input[start:p.pos]))
+		if err != nil {
+			return nil, p.errorf("bad string: %v", err)
+		}
+		return &patternNode{kind: textPattern, text: text}, nil
+	case '(':
+		p.pos++
+		result := &patternNode{kind: treePattern}
+		p.space()
+		if p.pos < len(p.input) && !strings.ContainsRune(`()"$`, p.input[p.pos]) {
+			start := p.pos
+			switch tag := p.word(); tag {
+			case "_", "...":
+				// Not a tag, but the first child.
+				p.pos = start
+			case "*":
+				result.anyTag = true
+			default:
+				result.tag = tag
+			}
+		}
+		for {
+			p.space()
+			if p.pos == len(p.input) {
+				return nil, p.errorf("missing )")
+			}
+			if p.input[p.pos] == ')' {
+				p.pos++
+				return result, nil
+			}
+			child, err := p.node()
+			if err != nil {
+				return nil, err
+			}
+			result.children = append(result.children, child)
+		}
+	case ')':
+		return nil, p.errorf("unexpected )")
+	}
+	word := p.word()
+	switch {
+	case word == "_":
+		return &patternNode{kind: anyPattern}, nil
+	case word == "...":
+		return &patternNode{kind: restPattern}, nil
+	case strings.HasPrefix(word, "$") && strings.HasSuffix(word, "...") && len(word) > 4:
+		return &patternNode{kind: restPattern, text: word[1 : len(word)-3]}, nil
+	case strings.HasPrefix(word, "$") && len(word) > 1:
+		return &patternNode{kind: variablePattern, text: word[1:]}, nil
+	}
+	return nil, p.errorf("unexpected %q", word)
+}
+
+// A RewriteRule replaces trees that match a pattern with a template, written
+// like a pattern but without wildcards, in which each metavariable stands for
+// what it matched. See NewRewriteRule.
+//
+// The trees built from a template don't match the input, so their Match is
+// made from the Match of their children, in order, separated by a space where
+// a child has no Leading trivia. So the Text of a rewritten tree is the text
+// of its leaves, though it may differ in whitespace, and leaves out any text
+// that was omitted from the children.
+type RewriteRule struct {
+	pattern  *Pattern
+	template *patternNode
+}
+
+// NewRewriteRule returns a rule that replaces trees that match pattern with
+// template. For example, the rule
+//
+//	NewRewriteRule(`(sum $a ("+") (num "0"))`, `$a`)
+//
+// drops additions of zero. Every metavariable in template must appear in
+// pattern, and $name... splices in the trees that name matched.
+func NewRewriteRule(pattern, template string) (RewriteRule, error) {
+	p, err := CompilePattern(pattern)
+	if err != nil {
+		return RewriteRule{}, err
+	}
+	t, err := CompilePattern(template)
+	if err != nil {
+		return RewriteRule{}, err
+	}
+	bound := make(map[string]bool)
+	collectVariables(p.root, bound)
+	if err := checkTemplate(t.root, bound); err != nil {
+		return RewriteRule{}, fmt.Errorf("template %q: %w", template, err)
+	}
+	return RewriteRule{pattern: p, template: t.root}, nil
+}
+
+// MustRewriteRule is like NewRewriteRule, but panics if the rule is invalid.
+func MustRewriteRule(pattern, template string) RewriteRule {
+	r, err := NewRewriteRule(pattern, template)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+func collectVariables(p *patternNode, vars map[string]bool) {
+	if (p.kind == variablePattern || p.kind == restPattern) && p.text != "" {
+		vars[p.text] = true
+	}
+	for _, child := range p.children {
+		collectVariables(child, vars)
+	}
+}
+
+func checkTemplate(t *patternNode, bound map[string]bool) error {
+	switch {
+	case t.kind == anyPattern || t.kind == restPattern && t.text == "":
+		return errors.New("wildcard in template")
+	case t.anyTag:
+		return errors.New("* tag in template")
+	case (t.kind == variablePattern || t.kind == restPattern) && !bound[t.text]:
+		return fmt.Errorf("$%s isn't in the pattern", t.text)
+	}
+	for _, child := range t.children {
+		if err := checkTemplate(child, bound); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Apply returns the instantiated template if t matches the rule's pattern,
+// or nil if it doesn't.
+func (r RewriteRule) Apply(t *Tree) *Tree {
+	b, ok := r.pattern.Match(t)
+	if !ok {
+		return nil
+	}
+	return instantiate(r.template, b, t)[0]
+}
+
+// instantiate builds the trees for template, using the trees in b for its
+// metavariables. Trees built from templates start at the position of
+// replaced, and have the text of their literals, or of their children, as
+// Match.
+func instantiate(template *patternNode, b Bindings, replaced *Tree) []*Tree {
+	switch template.kind {
+	case variablePattern:
+		return []*Tree{b[template.text]}
+	case restPattern:
+		return b[template.text].Children
+	case textPattern:
+		return []*Tree{{Start: replaced.Start, Match: []rune(template.text)}}
+	}
+	if len(template.children) == 1 && template.children[0].kind == textPattern && template.tag != "" {
+		// A tagged leaf.
+		return []*Tree{{Start: replaced.Start, Match: []rune(template.children[0].text), Tag: template.tag}}
+	}
+	children := []*Tree{}
+	for _, child := range template.children {
+		children = append(children, instantiate(child, b, replaced)...)
+	}
+	result := &Tree{Start: replaced.Start, Tag: template.tag, Children: children}
+	result.join()
+	return []*Tree{result}
+}
+
+// maxRewritePasses bounds the passes RewriteAll makes over a tree, in case
+// the rules never stop changing it.
+const maxRewritePasses = 1000
+
+// RewriteAll applies rules to t from the bottom up, replacing each tree that
+// matches the pattern of a rule with its template. The first rule that
+// matches wins. It repeats until no rule matches, and returns an error if
+// that doesn't happen within a thousand passes, say because a rule undoes
+// another. Like Rewrite, it doesn't modify t.
+func RewriteAll(t *Tree, rules ...RewriteRule) (*Tree, error) {
+	for range maxRewritePasses {
+		changed := false
+		t = Rewrite(t, func(c *Cursor, t *Tree) *Tree {
+			for _, r := range rules {
+				if result := r.Apply(t); result != nil {
+					changed = true
+					return result
+				}
+			}
+			return t
+		})
+		if !changed {
+			return t, nil
+		}
+	}
+	return t, errors.New("rewrite rules didn't reach a fixed point")
+}
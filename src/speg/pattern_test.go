@@ -0,0 +1,160 @@
+package speg
+
+import (
+	"github.com/shoenig/test"
+	"testing"
+)
+
+// plusGrammar matches sums and products like "a + 0 * (b + c)".
+func plusGrammar() Parser {
+	var sum Parser
+	atom := Or(
+		Token(Digits()).Tagged("num"),
+		Token(Identifier()).Tagged("var"),
+		Between(Token(Exactly("(")), Indirect(&sum), Token(Exactly(")"))).Tagged("group"),
+	)
+	product := Left(atom, Seq(Token(Exactly("*")), atom)).Tagged("product")
+	sum = Left(product, Seq(Token(Exactly("+")), product)).Tagged("sum")
+	return sum
+}
+
+func parsePlus(t *testing.T, input string) *Tree {
+	tree := plusGrammar().Parse([]rune(input), 0, NewContext())
+	test.NotNil(t, tree)
+	return tree
+}
+
+func TestPatternMatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		pattern  string
+		input    string
+		expected map[string]string
+	}{
+		{"tagged leaf", `(num "0")`, "0", map[string]string{}},
+		{"wrong text", `(num "1")`, "0", nil},
+		{"wrong tag", `(var "0")`, "0", nil},
+		{"any tag", `(* "x")`, "x", map[string]string{}},
+		{"leaf variable", `(num $n)`, "12", map[string]string{"n": `"12"`}},
+		{"variable", `(sum $a ("+") $b)`, "x + 1", map[string]string{"a": `(var "x")`, "b": `(num "1")`}},
+		{"wildcard", `(sum _ ("+") (num _))`, "x + 1", map[string]string{}},
+		{"repeated variable", `(sum $a ("+") $a)`, "x + x", map[string]string{"a": `(var "x")`}},
+		{"repeated variable mismatch", `(sum $a ("+") $a)`, "x + y", nil},
+		{"rest", `(sum $first ... $last)`, "a + b + c", map[string]string{"first": `(sum (var "a") ("+") (var "b"))`, "last": `(var "c")`}},
+		{"rest variable", `(sum (var "a") $rest...)`, "a + b", map[string]string{"rest": `(("+") (var "b"))`}},
+		{"too few children", `(sum $a $b $c $d)`, "a + b + c", nil},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			b, ok := MustCompilePattern(tc.pattern).Match(parsePlus(t, tc.input))
+			if tc.expected == nil {
+				test.False(t, ok)
+				return
+			}
+			test.True(t, ok)
+			got := map[string]string{}
+			for name, tree := range b {
+				got[name] = tree.String()
+			}
+			test.Eq(t, tc.expected, got)
+		})
+	}
+}
+
+func TestCompilePatternErrors(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		expected string
+	}{
+		{`(sum $a`, `pattern "(sum $a" at 7: missing )`},
+		{`(num "0)`, `pattern "(num \"0)" at 8: unterminated string`},
+		{`$a )`, `pattern "$a )" at 3: unexpected ')'`},
+		{`...`, `pattern "...": ... outside of a tree`},
+		{`(num x)`, `pattern "(num x)" at 6: unexpected "x"`},
+		{``, `pattern "" at 0: unexpected end`},
+	}
+	for _, tc := range tests {
+		t.Run(tc.pattern, func(t *testing.T) {
+			_, err := CompilePattern(tc.pattern)
+			test.EqError(t, err, tc.expected)
+		})
+	}
+}
+
+func TestNewRewriteRuleErrors(t *testing.T) {
+	_, err := NewRewriteRule(`(sum $a _)`, `$b`)
+	test.EqError(t, err, `template "$b": $b isn't in the pattern`)
+	_, err = NewRewriteRule(`(sum $a _)`, `(sum $a _)`)
+	test.EqError(t, err, `template "(sum $a _)": wildcard in template`)
+	_, err = NewRewriteRule(`(sum $a _)`, `(* $a)`)
+	test.EqError(t, err, `template "(* $a)": * tag in template`)
+}
+
+func TestRewriteAll(t *testing.T) {
+	rules := []RewriteRule{
+		// x + 0 = x, 0 + x = x
+		MustRewriteRule(`(sum $a ("+") (num "0"))`, `$a`),
+		MustRewriteRule(`(sum (num "0") ("+") $a)`, `$a`),
+		// x * 1 = x
+		MustRewriteRule(`(product $a ("*") (num "1"))`, `$a`),
+		// (x) = x, for a variable or number
+		MustRewriteRule(`(group (var $v))`, `(var $v)`),
+		MustRewriteRule(`(group (num $n))`, `(num $n)`),
+		// x + x = 2 * x
+		MustRewriteRule(`(sum $a ("+") $a)`, `(product (num "2") ("*") $a)`),
+	}
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"no change", "a + b", `(sum (var "a") ("+") (var "b"))`},
+		{"plus zero", "a + 0", `(var "a")`},
+		{"nested", "(a * 1 + 0) + 0", `(var "a")`},
+		{"to a fixed point", "0 + (b * 1) + (b + 0)", `(product (num "2") ("*") (var "b"))`},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tree := parsePlus(t, tc.input)
+			before := tree.String()
+			result, err := RewriteAll(tree, rules...)
+			test.NoError(t, err)
+			test.Eq(t, tc.expected, result.String())
+			test.Eq(t, before, tree.String())
+		})
+	}
+}
+
+func TestRewriteAllLoops(t *testing.T) {
+	// These rules undo each other forever.
+	swap := MustRewriteRule(`(sum $a ("+") $b)`, `(sum $b ("+") $a)`)
+	_, err := RewriteAll(parsePlus(t, "a + b"), swap)
+	test.EqError(t, err, "rewrite rules didn't reach a fixed point")
+}
+
+func TestRewriteRuleText(t *testing.T) {
+	tests := []struct {
+		name     string
+		rule     RewriteRule
+		input    string
+		expected string
+		text     string
+	}{
+		{"swap", MustRewriteRule(`(sum $a $op $b)`, `(sum $b $op $a)`), "x + y", `(sum (var "y") ("+") (var "x"))`, "y + x"},
+		{"literals", MustRewriteRule(`(var "x")`, `(sum (var "x") ("+") (num "1"))`), "x", `(sum (var "x") ("+") (num "1"))`, "x + 1"},
+		{"inside", MustRewriteRule(`(var "y")`, `(product (num "2") ("*") (var "z"))`), "x + y", `(sum (var "x") ("+") (product (num "2") ("*") (var "z")))`, "x + 2 * z"},
+		{"in place", MustRewriteRule(`(num $n)`, `(var $n)`), "(1 + 2)", `(group (sum (var "1") ("+") (var "2")))`, "1 + 2"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			result := Rewrite(parsePlus(t, tc.input), func(c *Cursor, t *Tree) *Tree {
+				if r := tc.rule.Apply(t); r != nil {
+					return r
+				}
+				return t
+			})
+			test.Eq(t, tc.expected, result.String())
+			test.Eq(t, tc.text, result.Text())
+		})
+	}
+}
@@ -0,0 +1,364 @@
+package speg
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// ParserStats aggregates what a Profiler observed about one parser.
+type ParserStats struct {
+	// Name describes the parser. See Profiler.Name.
+	Name string
+	// Calls is the number of times the parser was invoked.
+	Calls int
+	// Successes is the number of invocations that matched.
+	Successes int
+	// MemoHits and MemoMisses count lookups in the packrat cache.
+	MemoHits   int
+	MemoMisses int
+	// Backtracked is the number of runes matched by sub-parsers during
+	// invocations that ultimately failed, i.e., work that was thrown away.
+	Backtracked int
+	// Total is the time spent in the parser, including its sub-parsers.
+	// Recursive invocations are only counted once.
+	Total time.Duration
+	// Self is the time spent in the parser, excluding its sub-parsers.
+	Self time.Duration
+	// Trees is the number of result Trees the parser allocated, excluding
+	// results found in the cache or passed through from a sub-parser.
+	Trees int
+}
+
+// A Profiler is a Tracer that aggregates per-parser statistics. Use it like this:
+//
+//	profiler := NewProfiler()
+//	tree := NewContext().WithTracer(profiler).Parse(grammar, input, 0)
+//	profiler.WriteTable(os.Stdout)
+//
+// A Profiler may be used for several parses in sequence, but not concurrently.
+type Profiler struct {
+	stats   map[ID]*ParserStats
+	names   map[ID]string
+	depth   map[ID]int
+	stack   []profileFrame
+	samples map[string]*profileSample
+	now     func() time.Time
+}
+
+type profileFrame struct {
+	id        ID
+	start     int
+	began     time.Time
+	inside    time.Duration
+	farthest  int
+	hit       bool
+	lastChild *Tree
+}
+
+// A profileSample accumulates the cost of one distinct stack of parsers.
+type profileSample struct {
+	stack []ID
+	calls int64
+	self  int64
+	trees int64
+}
+
+// NewProfiler returns an empty Profiler.
+func NewProfiler() *Profiler {
+	return &Profiler{
+		stats:   make(map[ID]*ParserStats),
+		names:   make(map[ID]string),
+		depth:   make(map[ID]int),
+		samples: make(map[string]*profileSample),
+		now:     time.Now,
+	}
+}
+
+// Name sets the name reported for parser. By default, a parser is
+// described by its type, its tag (if any), and a prefix of its ID.
+func (p *Profiler) Name(parser Parser, name string) {
+	p.names[parser.ID()] = name
+	if s, ok := p.stats[parser.ID()]; ok {
+		s.Name = name
+	}
+}
+
+func (p *Profiler) statsFor(id ID) *ParserStats {
+	s, ok := p.stats[id]
+	if !ok {
+		s = &ParserStats{Name: p.names[id]}
+		if s.Name == "" {
+			s.Name = id.String()[:8]
+		}
+		p.stats[id] = s
+	}
+	return s
+}
+
+func (p *Profiler) Enter(parser Parser, start int) {
+	id := parser.ID()
+	s := p.statsFor(id)
+	if _, named := p.names[id]; !named {
+		p.names[id] = describe(parser)
+		s.Name = p.names[id]
+	}
+	s.Calls++
+	p.depth[id]++
+	p.stack = append(p.stack, profileFrame{
+		id:       id,
+		start:    start,
+		began:    p.now(),
+		farthest: start,
+	})
+}
+
+func (p *Profiler) Exit(parser Parser, start int, result *Tree) {
+	if len(p.stack) == 0 {
+		return
+	}
+	frame := p.stack[len(p.stack)-1]
+	p.stack = p.stack[:len(p.stack)-1]
+	elapsed := p.now().Sub(frame.began)
+	self := elapsed - frame.inside
+
+	s := p.statsFor(frame.id)
+	p.depth[frame.id]--
+	if p.depth[frame.id] == 0 {
+		s.Total += elapsed
+	}
+	s.Self += self
+
+	allocated := false
+	if result != nil {
+		s.Successes++
+		if !frame.hit && result != frame.lastChild {
+			allocated = true
+			s.Trees++
+		}
+	} else {
+		s.Backtracked += frame.farthest - frame.start
+	}
+
+	sample := p.sample(frame)
+	sample.calls++
+	sample.self += int64(self)
+	if allocated {
+		sample.trees++
+	}
+
+	if len(p.stack) > 0 {
+		parent := &p.stack[len(p.stack)-1]
+		parent.inside += elapsed
+		parent.lastChild = result
+		if result != nil && start+len(result.Match) > parent.farthest {
+			parent.farthest = start + len(result.Match)
+		}
+	}
+}
+
+func (p *Profiler) Memo(id ID, start int, hit bool) {
+	s := p.statsFor(id)
+	if !hit {
+		s.MemoMisses++
+		return
+	}
+	s.MemoHits++
+	if len(p.stack) > 0 {
+		top := &p.stack[len(p.stack)-1]
+		if top.id == id && top.start == start {
+			top.hit = true
+		}
+	}
+}
+
+// sample returns the sample for the current stack of parsers plus frame.
+func (p *Profiler) sample(frame profileFrame) *profileSample {
+	var key strings.Builder
+	stack := make([]ID, 0, len(p.stack)+1)
+	for _, f := range p.stack {
+		stack = append(stack, f.id)
+		key.Write(f.id[:])
+	}
+	stack = append(stack, frame.id)
+	key.Write(frame.id[:])
+	s, ok := p.samples[key.String()]
+	if !ok {
+		s = &profileSample{stack: stack}
+		p.samples[key.String()] = s
+	}
+	return s
+}
+
+// Stats returns the statistics gathered so far, one entry per parser,
+// ordered by decreasing self time.
+func (p *Profiler) Stats() []ParserStats {
+	result := make([]ParserStats, 0, len(p.stats))
+	for _, s := range p.stats {
+		result = append(result, *s)
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		if result[i].Self != result[j].Self {
+			return result[i].Self > result[j].Self
+		}
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// WriteTable writes the statistics as an aligned, human-readable table.
+func (p *Profiler) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "calls\tmatched\tmemo hits\tmemo misses\tbacktracked\ttotal\tself\ttrees\tparser\t")
+	for _, s := range p.Stats() {
+		fmt.Fprintf(tw, "%d\t%d\t%d\t%d\t%d\t%v\t%v\t%d\t%s\t\n",
+			s.Calls, s.Successes, s.MemoHits, s.MemoMisses, s.Backtracked, s.Total, s.Self, s.Trees, s.Name)
+	}
+	return tw.Flush()
+}
+
+// WritePprof writes the statistics as a gzipped profile.proto message, which
+// can be examined with `go tool pprof`. Each parser appears as a function,
+// and the stacks are stacks of parser invocations. The profile has three
+// sample types: calls, self time in nanoseconds and allocated trees.
+func (p *Profiler) WritePprof(w io.Writer) error {
+	var out protoBuffer
+	strs := newStringTable()
+
+	for _, vt := range [][2]string{{"calls", "count"}, {"time", "nanoseconds"}, {"trees", "count"}} {
+		var b protoBuffer
+		b.int64Field(1, strs.index(vt[0]))
+		b.int64Field(2, strs.index(vt[1]))
+		out.bytesField(1, b.bytes)
+	}
+
+	keys := make([]string, 0, len(p.samples))
+	for k := range p.samples {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	// Each parser gets a function and a location, both numbered from 1.
+	locations := make(map[ID]uint64)
+	var order []ID
+	for _, k := range keys {
+		s := p.samples[k]
+		for _, id := range s.stack {
+			if _, ok := locations[id]; !ok {
+				locations[id] = uint64(len(locations) + 1)
+				order = append(order, id)
+			}
+		}
+	}
+
+	for _, k := range keys {
+		s := p.samples[k]
+		var b protoBuffer
+		ids := make([]uint64, len(s.stack))
+		for i, id := range s.stack {
+			// The leaf comes first.
+			ids[len(s.stack)-1-i] = locations[id]
+		}
+		b.packedField(1, ids)
+		b.packedField(2, []uint64{uint64(s.calls), uint64(s.self), uint64(s.trees)})
+		out.bytesField(2, b.bytes)
+	}
+
+	for _, id := range order {
+		var line protoBuffer
+		line.uint64Field(1, locations[id])
+		var loc protoBuffer
+		loc.uint64Field(1, locations[id])
+		loc.bytesField(4, line.bytes)
+		out.bytesField(4, loc.bytes)
+	}
+
+	for _, id := range order {
+		name := p.statsFor(id).Name
+		var fn protoBuffer
+		fn.uint64Field(1, locations[id])
+		fn.int64Field(2, strs.index(name))
+		fn.int64Field(3, strs.index(name))
+		out.bytesField(5, fn.bytes)
+	}
+
+	var period protoBuffer
+	period.int64Field(1, strs.index("calls"))
+	period.int64Field(2, strs.index("count"))
+	out.bytesField(11, period.bytes)
+	out.int64Field(12, 1)
+
+	for _, s := range strs.strings {
+		out.bytesField(6, []byte(s))
+	}
+
+	gz := gzip.NewWriter(w)
+	if _, err := gz.Write(out.bytes); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+type stringTable struct {
+	strings []string
+	indexes map[string]int64
+}
+
+func newStringTable() *stringTable {
+	return &stringTable{
+		strings: []string{""},
+		indexes: map[string]int64{"": 0},
+	}
+}
+
+func (t *stringTable) index(s string) int64 {
+	if k, ok := t.indexes[s]; ok {
+		return k
+	}
+	t.indexes[s] = int64(len(t.strings))
+	t.strings = append(t.strings, s)
+	return t.indexes[s]
+}
+
+// protoBuffer is just enough of a protocol buffer encoder to write profiles.
+type protoBuffer struct {
+	bytes []byte
+}
+
+func (b *protoBuffer) varint(v uint64) {
+	for v >= 0x80 {
+		b.bytes = append(b.bytes, byte(v)|0x80)
+		v >>= 7
+	}
+	b.bytes = append(b.bytes, byte(v))
+}
+
+func (b *protoBuffer) uint64Field(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+	b.varint(uint64(field) << 3)
+	b.varint(v)
+}
+
+func (b *protoBuffer) int64Field(field int, v int64) {
+	b.uint64Field(field, uint64(v))
+}
+
+func (b *protoBuffer) bytesField(field int, v []byte) {
+	b.varint(uint64(field)<<3 | 2)
+	b.varint(uint64(len(v)))
+	b.bytes = append(b.bytes, v...)
+}
+
+func (b *protoBuffer) packedField(field int, vs []uint64) {
+	var packed protoBuffer
+	for _, v := range vs {
+		packed.varint(v)
+	}
+	b.bytesField(field, packed.bytes)
+}
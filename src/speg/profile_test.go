@@ -0,0 +1,68 @@
+package speg
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/shoenig/test"
+)
+
+func TestProfiler(t *testing.T) {
+	number := Token(Digits()).Tagged("num")
+	plus := Token(Exactly("+"))
+	sum := Left(number, Seq(plus, number)).Tagged("sum")
+
+	profiler := NewProfiler()
+	profiler.Name(number, "number")
+	tree := NewContext().WithTracer(profiler).Parse(sum, []rune("1 + 2 + 3"), 0)
+	test.Eq(t, `(sum (sum (num "1") ("+") (num "2")) ("+") (num "3"))`, tree.String())
+
+	stats := make(map[string]ParserStats)
+	for _, s := range profiler.Stats() {
+		stats[s.Name] = s
+	}
+	test.Eq(t, 3, stats["number"].Calls)
+	test.Eq(t, 3, stats["number"].Successes)
+	// Tagged passes its sub-parser's tree through rather than allocating one.
+	test.Eq(t, 0, stats["number"].Trees)
+	test.Eq(t, 1, stats[describe(sum)].Calls)
+
+	// The final attempt at the continuation fails without matching anything.
+	var seq ParserStats
+	for name, s := range stats {
+		if strings.HasPrefix(name, "SequenceParser") {
+			seq = s
+		}
+	}
+	test.Eq(t, 3, seq.Calls)
+	test.Eq(t, 2, seq.Successes)
+	test.Eq(t, 0, seq.Backtracked)
+
+	var table bytes.Buffer
+	test.NoError(t, profiler.WriteTable(&table))
+	test.StrContains(t, table.String(), "number")
+	test.StrContains(t, table.String(), "memo hits")
+
+	var profile bytes.Buffer
+	test.NoError(t, profiler.WritePprof(&profile))
+	gz, err := gzip.NewReader(&profile)
+	test.NoError(t, err)
+	raw, err := io.ReadAll(gz)
+	test.NoError(t, err)
+	test.True(t, bytes.Contains(raw, []byte("number")))
+}
+
+func TestProfilerBacktracking(t *testing.T) {
+	p := Or(Seq(Exactly("ab"), Exactly("c")), Exactly("abd"))
+	profiler := NewProfiler()
+	tree := NewContext().WithTracer(profiler).Parse(p, []rune("abd"), 0)
+	test.Eq(t, `"abd"`, tree.String())
+	for _, s := range profiler.Stats() {
+		if strings.HasPrefix(s.Name, "SequenceParser") {
+			test.Eq(t, 2, s.Backtracked)
+		}
+	}
+}
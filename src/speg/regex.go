@@ -0,0 +1,96 @@
+package speg
+
+import (
+	"github.com/google/uuid"
+	"sparse/src/regex"
+	"strconv"
+)
+
+// Regex returns a Matcher for the regular expression pattern, which uses the
+// syntax of package regexp. The match is anchored at the start position and
+// follows the usual leftmost-first rules, so Regex(`a|ab`) matches just the
+// "a" of "ab". Regex panics if pattern is invalid.
+//
+// Assertions like ^ and \b treat the start position as the beginning of
+// the text.
+func Regex(pattern string) Matcher {
+	re := regex.MustCompile(pattern)
+	result := NewMatcher(func(input []rune) int {
+		length, _ := re.MatchPrefix(input)
+		return length
+	})
+	result.generate = re.Random
+	result.expected = "/" + pattern + "/"
+	return result
+}
+
+type RegexParser struct {
+	id ID
+	re *regex.Regexp
+}
+
+func (p RegexParser) Omit() Parser {
+	return Omit(p)
+}
+
+func (p RegexParser) Star() Parser {
+	return Star(p)
+}
+
+func (p RegexParser) ID() uuid.UUID {
+	return p.id
+}
+
+func (p RegexParser) Tagged(tag string) TaggedParser {
+	return Tagged(p, tag)
+}
+
+func (p RegexParser) Parse(input []rune, start int, ctx *Context) *Tree {
+	cached, ok := ctx.getCachedValue(p.id, start)
+	if ok {
+		return cached
+	}
+	length, groups := p.re.MatchPrefix(input[start:])
+	if length < 0 {
+		ctx.expect(start, "/"+p.re.String()+"/")
+		ctx.setCachedValue(p.id, start, nil)
+		return nil
+	}
+	var children []*Tree
+	if ctx.withChildren {
+		names := p.re.SubexpNames()
+		for k := 1; k < len(names); k++ {
+			lo, hi := groups[2*k], groups[2*k+1]
+			if lo < 0 {
+				continue
+			}
+			tag := names[k]
+			if tag == "" {
+				tag = strconv.Itoa(k)
+			}
+			children = append(children, &Tree{
+				Start: start + lo,
+				Match: input[start+lo : start+hi],
+				Tag:   tag,
+			})
+		}
+	}
+	result := &Tree{
+		Start:    start,
+		Match:    input[start : start+length],
+		Children: children,
+	}
+	ctx.setCachedValue(p.id, start, result)
+	return result
+}
+
+// RegexGroups is like Regex, but the result has a child for each group in
+// pattern that participated in the match, in the order of their opening
+// parentheses. Each child is tagged with the name of its group, e.g.,
+// "frac" for (?P<frac>...), or its number if it has no name.
+func RegexGroups(pattern string) RegexParser {
+	return RegexParser{
+		id: uuid.New(),
+		re: regex.MustCompile(pattern),
+	}
+}
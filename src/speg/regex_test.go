@@ -0,0 +1,37 @@
+package speg
+
+import (
+	"github.com/shoenig/test"
+	"testing"
+)
+
+func TestRegex(t *testing.T) {
+	float := `[0-9]+(?P<frac>\.[0-9]+)?(?:[eE]([-+]?[0-9]+))?`
+	tests := []struct {
+		name     string
+		parser   Parser
+		input    string
+		expected string
+	}{
+		{"float", Regex(float), "3.25e-2+1", `"3.25e-2"`},
+		{"no match", Regex(float), "x", `<nil>`},
+		{"identifier", Token(Regex(`[\p{L}_][\p{L}\p{N}_]*`)).Tagged("id"), "  größe_2 = 1", `(id "größe_2")`},
+		{"groups", RegexGroups(float), "3.25e-2", `((frac ".25") (2 "-2"))`},
+		{"some groups", RegexGroups(float).Tagged("num"), "3e8", `(num (2 "8"))`},
+		{"no groups", RegexGroups(float), "3", `"3"`},
+		{"in a sequence", Seq(Regex(`[a-z]+`).Tagged("key"), Exactly("="), Regex(`[0-9]+`).Tagged("val")), "x=10", `((key "x") "=" (val "10"))`},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			test.Eq(t, tc.expected, tc.parser.Parse([]rune(tc.input), 0, NewContext()).String())
+		})
+	}
+}
+
+func TestRegexGroupPositions(t *testing.T) {
+	tree := RegexGroups(`(?P<key>\w+)=(?P<val>\w+)`).Parse([]rune("  a=bc"), 2, NewContext())
+	test.Eq(t, 2, tree.Start)
+	test.Eq(t, 2, tree.Children[0].Start)
+	test.Eq(t, 4, tree.Children[1].Start)
+	test.Eq(t, "bc", tree.Children[1].Matched())
+}
@@ -0,0 +1,82 @@
+package speg
+
+import "github.com/google/uuid"
+
+type RepeatParser struct {
+	id     uuid.UUID
+	parser Parser
+	min    int
+	max    int
+}
+
+func (r RepeatParser) Omit() Parser {
+	return Omit(r)
+}
+
+func (r RepeatParser) Flatten() TokenParser {
+	return Token(r)
+}
+
+func (r RepeatParser) ID() uuid.UUID {
+	return r.id
+}
+
+func (r RepeatParser) Tagged(tag string) TaggedParser {
+	return Tagged(r, tag)
+}
+
+// Parse matches as many repetitions of the parser as it can, up to the
+// maximum, and fails if that is fewer than the minimum. The result has one
+// child for each repetition. A repetition that matches the empty string ends
+// the loop, since it could be repeated any number of times.
+func (r RepeatParser) Parse(input []rune, start int, ctx *Context) *Tree {
+	cached, ok := ctx.getCachedValue(r.id, start)
+	if ok {
+		return cached
+	}
+
+	pos := start
+	count := 0
+	var children, nodes []*Tree
+	for r.max < 0 || count < r.max {
+		child := ctx.parse(r.parser, input, pos)
+		if child == nil {
+			break
+		}
+		pos += len(child.Match)
+		ctx.addChild(&children, &nodes, r.parser, child)
+		count++
+		if len(child.Match) == 0 {
+			count = max(count, r.min)
+			break
+		}
+	}
+	var result *Tree
+	if count >= r.min {
+		result = &Tree{
+			Start:    start,
+			Match:    input[start:pos],
+			Children: children,
+			Nodes:    nodes,
+		}
+	}
+	ctx.setCachedValue(r.id, start, result)
+	return result
+}
+
+// Repeat returns a parser that matches p at least min and at most max times.
+// If max is negative, there is no upper bound.
+func Repeat(p Parser, min, max int) RepeatParser {
+	return RepeatParser{
+		id:     uuid.New(),
+		parser: p,
+		min:    min,
+		max:    max,
+	}
+}
+
+// Plus returns a parser that matches one or more of p. It is the same as
+// Repeat(p, 1, -1).
+func Plus(p Parser) RepeatParser {
+	return Repeat(p, 1, -1)
+}
@@ -0,0 +1,39 @@
+package speg
+
+import (
+	"testing"
+
+	"github.com/shoenig/test"
+)
+
+func TestRepeat(t *testing.T) {
+	tests := []struct {
+		name     string
+		parser   Parser
+		input    string
+		expected string
+	}{
+		{"plus none", Plus(Letter().Tagged("l")), "123", `<nil>`},
+		{"plus one", Plus(Letter().Tagged("l")), "a1", `((l "a"))`},
+		{"plus several", Plus(Letter().Tagged("l")), "abc1", `((l "a") (l "b") (l "c"))`},
+		{"plus token", Plus(Token(Digits()).Tagged("n")), "1 2  3", `((n "1") (n "2") (n "3"))`},
+		{"repeat too few", Repeat(Digit().Tagged("d"), 2, 3), "1", `<nil>`},
+		{"repeat min", Repeat(Digit().Tagged("d"), 2, 3), "12", `((d "1") (d "2"))`},
+		{"repeat stops at max", Repeat(Digit().Tagged("d"), 2, 3), "12345", `((d "1") (d "2") (d "3"))`},
+		{"repeat unbounded", Repeat(Digit().Tagged("d"), 0, -1), "12345", `((d "1") (d "2") (d "3") (d "4") (d "5"))`},
+		{"repeat zero", Repeat(Digit().Tagged("d"), 0, 2), "x", `""`},
+		{"repeat omitted", Repeat(Digit().Omit(), 1, -1), "12", `"12"`},
+		{"repeat empty match", Repeat(Opt(Digit()), 3, 3), "x", `("")`},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			test.Eq(t, tc.expected, tc.parser.Parse([]rune(tc.input), 0, NewContext()).String())
+		})
+	}
+}
+
+func TestRepeatExpectation(t *testing.T) {
+	ctx := NewContext()
+	test.Nil(t, Seq(Exactly("x"), Repeat(Digit(), 2, 2)).Parse([]rune("x1a"), 0, ctx))
+	test.EqError(t, ctx.Error(), "parse error at 2: expected digit")
+}
@@ -0,0 +1,109 @@
+package speg
+
+import "github.com/google/uuid"
+
+type RightRecursiveParser struct {
+	id   uuid.UUID
+	lead Parser
+	base Parser
+	tag  string
+}
+
+func (r RightRecursiveParser) Omit() Parser {
+	return Omit(r)
+}
+
+func (r RightRecursiveParser) Star() Parser {
+	return Star(r)
+}
+
+func (r RightRecursiveParser) Flatten() TokenParser {
+	return Token(r)
+}
+
+// Parse matches lead zero or more times followed by base. It works
+// iteratively, so long chains don't recurse deeply. If base doesn't match
+// after the last lead, it backs off one lead at a time until it does.
+func (r RightRecursiveParser) Parse(input []rune, start int, ctx *Context) *Tree {
+	cached, ok := ctx.getCachedValue(r.id, start)
+	if ok {
+		return cached
+	}
+
+	var leads []*Tree
+	starts := []int{start}
+	marks := []*state{ctx.mark()}
+	pos := start
+	for {
+		lead := ctx.parse(r.lead, input, pos)
+		if lead == nil || len(lead.Match) == 0 {
+			ctx.reset(marks[len(marks)-1])
+			break
+		}
+		leads = append(leads, lead)
+		pos += len(lead.Match)
+		starts = append(starts, pos)
+		marks = append(marks, ctx.mark())
+	}
+
+	for k := len(leads); k >= 0; k-- {
+		ctx.reset(marks[k])
+		rhs := ctx.parse(r.base, input, starts[k])
+		if rhs == nil {
+			continue
+		}
+		end := starts[k] + len(rhs.Match)
+		for k--; k >= 0; k-- {
+			var children, nodes []*Tree
+			if ctx.withChildren {
+				children = append(children, leads[k].Children...)
+				children = append(children, rhs)
+			}
+			if ctx.lossless {
+				nodes = append(nodes, nodesOf(leads[k])...)
+				nodes = append(nodes, rhs)
+			}
+			rhs = &Tree{
+				Start:    starts[k],
+				Match:    input[starts[k]:end],
+				Children: children,
+				Nodes:    nodes,
+				Tag:      r.tag,
+			}
+		}
+		ctx.setCachedValue(r.id, start, rhs)
+		return rhs
+	}
+	ctx.setCachedValue(r.id, start, nil)
+	return nil
+}
+
+func (r RightRecursiveParser) ID() uuid.UUID {
+	return r.id
+}
+
+func (r RightRecursiveParser) Tagged(tag string) Parser {
+	return RightRecursiveParser{
+		id:   uuid.New(),
+		lead: r.lead,
+		base: r.base,
+		tag:  tag,
+	}
+}
+
+// Right is the mirror image of Left. It matches lead zero or more times,
+// followed by base, and builds a right-leaning tree: each node's children
+// are the children of one match of lead, followed by the tree for the rest.
+// For example,
+//
+//	Right(Seq(factor, Token(Exactly("^"))), factor).Tagged("pow")
+//
+// matches a^b^c as (pow a "^" (pow b "^" c)). As with Left, if lead doesn't
+// match, the result is the tree from base, without a tag.
+func Right(lead Parser, base Parser) RightRecursiveParser {
+	return RightRecursiveParser{
+		id:   uuid.New(),
+		lead: lead,
+		base: base,
+	}
+}
@@ -0,0 +1,40 @@
+package speg
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/shoenig/test"
+)
+
+func TestRight(t *testing.T) {
+	factor := Letters().Tagged("var")
+	pow := Seq(factor, Exactly("^").Tagged("op"))
+	tests := []struct {
+		name     string
+		parser   Parser
+		input    string
+		expected string
+	}{
+		{"base only", Right(pow, factor), "a", `(var "a")`},
+		{"untagged", Right(pow, factor), "a^b", `((var "a") (op "^") (var "b"))`},
+		{"tagged", Right(pow, factor).Tagged("pow"), "a^b", `(pow (var "a") (op "^") (var "b"))`},
+		{"right associative", Right(pow, factor).Tagged("pow"), "a^b^c", `(pow (var "a") (op "^") (pow (var "b") (op "^") (var "c")))`},
+		{"backs off a trailing operator", Right(pow, factor).Tagged("pow"), "a^b^", `(pow (var "a") (op "^") (var "b"))`},
+		{"no base", Right(pow, factor), "1", `<nil>`},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			test.Eq(t, tc.expected, tc.parser.Parse([]rune(tc.input), 0, NewContext()).String())
+		})
+	}
+}
+
+func TestRightLongChain(t *testing.T) {
+	cons := Right(Seq(Digits(), Token(Exactly("::")).Omit()), Token(Exactly("nil"))).Tagged("cons")
+	input := strings.Repeat("1::", 20000) + "nil"
+	tree := cons.Parse([]rune(input), 0, NewContext())
+	test.NotNil(t, tree)
+	test.Eq(t, len(input), len(tree.Match))
+	test.Eq(t, "cons", tree.Children[1].Tag)
+}
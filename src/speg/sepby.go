@@ -0,0 +1,118 @@
+package speg
+
+import "github.com/google/uuid"
+
+type SeparatedParser struct {
+	id       uuid.UUID
+	item     Parser
+	sep      Parser
+	min      int
+	trailing bool
+}
+
+func (s SeparatedParser) Omit() Parser {
+	return Omit(s)
+}
+
+func (s SeparatedParser) Flatten() TokenParser {
+	return Token(s)
+}
+
+func (s SeparatedParser) ID() uuid.UUID {
+	return s.id
+}
+
+func (s SeparatedParser) Tagged(tag string) TaggedParser {
+	return Tagged(s, tag)
+}
+
+// Parse matches items separated by separators. The result has one child for
+// each item; the separators are omitted.
+func (s SeparatedParser) Parse(input []rune, start int, ctx *Context) *Tree {
+	cached, ok := ctx.getCachedValue(s.id, start)
+	if ok {
+		return cached
+	}
+
+	pos := start
+	count := 0
+	var children, nodes []*Tree
+	for {
+		itemPos := pos
+		mark := ctx.mark()
+		var sep *Tree
+		if count > 0 {
+			sep = ctx.parse(s.sep, input, pos)
+			if sep == nil {
+				break
+			}
+			itemPos += len(sep.Match)
+		}
+		item := ctx.parse(s.item, input, itemPos)
+		if item == nil {
+			if count > 0 && s.trailing {
+				pos = itemPos
+				if ctx.lossless {
+					nodes = append(nodes, sep)
+				}
+			} else {
+				ctx.reset(mark)
+			}
+			break
+		}
+		if count > 0 && itemPos+len(item.Match) == pos {
+			// Neither the separator nor the item consumed anything, so
+			// continuing would loop forever.
+			ctx.reset(mark)
+			break
+		}
+		pos = itemPos + len(item.Match)
+		count++
+		if sep != nil && ctx.lossless {
+			nodes = append(nodes, sep)
+		}
+		ctx.addChild(&children, &nodes, s.item, item)
+	}
+	var result *Tree
+	if count >= s.min {
+		result = &Tree{
+			Start:    start,
+			Match:    input[start:pos],
+			Children: children,
+			Nodes:    nodes,
+		}
+	}
+	ctx.setCachedValue(s.id, start, result)
+	return result
+}
+
+// SepBy returns a parser that matches zero or more items separated by sep,
+// e.g., the arguments of a function call. The result has one child per item.
+func SepBy(item, sep Parser) SeparatedParser {
+	return SeparatedParser{
+		id:   uuid.New(),
+		item: item,
+		sep:  sep,
+	}
+}
+
+// SepBy1 is like SepBy, but requires at least one item.
+func SepBy1(item, sep Parser) SeparatedParser {
+	return SeparatedParser{
+		id:   uuid.New(),
+		item: item,
+		sep:  sep,
+		min:  1,
+	}
+}
+
+// SepEndBy is like SepBy, but also matches a separator after the last item,
+// if there is one, as in a list with an optional trailing comma.
+func SepEndBy(item, sep Parser) SeparatedParser {
+	return SeparatedParser{
+		id:       uuid.New(),
+		item:     item,
+		sep:      sep,
+		trailing: true,
+	}
+}
@@ -0,0 +1,50 @@
+package speg
+
+import (
+	"testing"
+
+	"github.com/shoenig/test"
+)
+
+func TestSepBy(t *testing.T) {
+	item := Token(Letters()).Tagged("item")
+	comma := Token(Exactly(","))
+	tests := []struct {
+		name     string
+		parser   Parser
+		input    string
+		expected string
+	}{
+		{"sepby empty", SepBy(item, comma), "", `""`},
+		{"sepby one", SepBy(item, comma), "a", `((item "a"))`},
+		{"sepby several", SepBy(item, comma), "a, b,c", `((item "a") (item "b") (item "c"))`},
+		{"sepby leaves trailing separator", SepBy(item, comma), "a,b,", `((item "a") (item "b"))`},
+		{"sepby1 empty", SepBy1(item, comma), "", `<nil>`},
+		{"sepby1 several", SepBy1(item, comma), "a,b", `((item "a") (item "b"))`},
+		{"sependby trailing separator", SepEndBy(item, comma), "a,b ,", `((item "a") (item "b"))`},
+		{"sependby no trailing separator", SepEndBy(item, comma), "a,b", `((item "a") (item "b"))`},
+		{"sependby empty", SepEndBy(item, comma), ",", `""`},
+		{"between", Between(Exactly("("), SepBy(item, comma), Exactly(")")), "(a,b)", `(((item "a") (item "b")))`},
+		{"between tagged", Between(Exactly("["), item, Exactly("]")).Tagged("list"), "[a]", `(list (item "a"))`},
+		{"between unclosed", Between(Exactly("["), item, Exactly("]")), "[a", `<nil>`},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			test.Eq(t, tc.expected, tc.parser.Parse([]rune(tc.input), 0, NewContext()).String())
+		})
+	}
+}
+
+func TestSepByMatch(t *testing.T) {
+	tree := SepEndBy(Digits(), Exactly(";")).Parse([]rune("1;2;x"), 0, NewContext())
+	test.Eq(t, "1;2;", tree.Matched())
+	tree = SepBy(Digits(), Exactly(";")).Parse([]rune("1;2;x"), 0, NewContext())
+	test.Eq(t, "1;2", tree.Matched())
+}
+
+func TestBetweenExpectation(t *testing.T) {
+	ctx := NewContext()
+	list := Between(Exactly("("), SepBy(Digits(), Exactly(",")), Exactly(")"))
+	test.Nil(t, list.Parse([]rune("(1,2"), 0, ctx))
+	test.EqError(t, ctx.Error(), `parse error at 4: expected "," or ")"`)
+}
@@ -38,29 +38,28 @@ func (p SequenceParser) Parse(input []rune, start int, context *Context) *Tree {
 	}
 
 	if err := context.pushActive(p, start); err != nil {
+		context.forget(p.id, start)
 		return nil
 	}
 	defer context.popActive()
 
 	var position = start
-	var children []*Tree
+	var children, nodes []*Tree
 
 	for _, parser := range p.subParsers {
-		result := parser.Parse(input, position, context)
+		result := context.parse(parser, input, position)
 		if result == nil {
+			context.forget(p.id, start)
 			return nil
 		}
 		position += len(result.Match)
-		
-		_, isOmitParser := parser.(OmitParser)
-		if context.withChildren && !isOmitParser {
-			children = append(children, result)
-		}
+		context.addChild(&children, &nodes, parser, result)
 	}
 	result := &Tree{
 		Match:    input[start:position],
 		Start:    start,
 		Children: children,
+		Nodes:    nodes,
 	}
 	context.setCachedValue(p.id, start, result)
 	return result
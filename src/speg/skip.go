@@ -0,0 +1,207 @@
+package speg
+
+import (
+	"github.com/google/uuid"
+	"math/rand/v2"
+)
+
+// A SkipParser sets what Token and the literal matchers skip within its
+// parser. Build one with Skipping or Lexical.
+type SkipParser struct {
+	id      ID
+	skip    Parser
+	parser  Parser
+	lexical bool
+}
+
+// Skipping returns a parser that matches what p matches, except that within
+// p, Token skips any number of matches of skip, rather than whitespace, and so
+// do the literal matchers: Exactly, IgnoreCase, Literals, Keyword and
+// Identifier. A grammar typically wraps its start rule:
+//
+//	trivia := Or(WhiteSpace(), LineComment("//"), BlockComment("/*", "*/"))
+//	grammar := Skipping(trivia, program)
+//
+// The runes skipped by a literal matcher are included in its Match, as with
+// Token, and are its Leading trivia. Skip itself is matched as if by Lexical,
+// so it can use literal matchers without recursion.
+func Skipping(skip Parser, p Parser) SkipParser {
+	return SkipParser{
+		id:     uuid.New(),
+		skip:   skip,
+		parser: p,
+	}
+}
+
+// Lexical returns a parser that matches what p matches, with skipping turned
+// off: within p, neither Token nor the literal matchers skip anything. It is
+// meant for rules that describe the insides of a token, like string literals,
+// where whitespace and comment markers are significant:
+//
+//	quote := Exactly(`"`)
+//	str := Lexical(Seq(quote, Star(Seq(Not(quote), Any())), quote))
+//
+// Within Lexical, Skipping turns skipping back on.
+func Lexical(p Parser) SkipParser {
+	return SkipParser{
+		id:      uuid.New(),
+		parser:  p,
+		lexical: true,
+	}
+}
+
+func (p SkipParser) Parse(input []rune, start int, ctx *Context) *Tree {
+	if !sameParser(ctx.skip, p.skip) || ctx.lexical != p.lexical {
+		result := *ctx
+		result.skip = p.skip
+		result.lexical = p.lexical
+		ctx = &result
+	}
+	return ctx.parse(p.parser, input, start)
+}
+
+// sameParser reports whether a and b are the same parser, or both nil.
+// Parsers are compared by ID, since some, like OrParser, can't be compared
+// with ==.
+func sameParser(a, b Parser) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return a.ID() == b.ID()
+}
+
+func (p SkipParser) ID() uuid.UUID {
+	return p.id
+}
+
+func (p SkipParser) Omit() Parser {
+	return Omit(p)
+}
+
+func (p SkipParser) Star() Parser {
+	return Star(p)
+}
+
+func (p SkipParser) Tagged(tag string) TaggedParser {
+	return Tagged(p, tag)
+}
+
+// skipTrivia returns the position after the trivia at start that the
+// context's skip parser matches. Without a skip parser it skips nothing,
+// since outside of Skipping only Token skips, and only whitespace.
+func (context *Context) skipTrivia(input []rune, start int) int {
+	if context.skip == nil || context.lexical {
+		return start
+	}
+	lexical := *context
+	lexical.lexical = true
+	ctx := lexical.quietly()
+	pos := start
+	for pos < len(input) {
+		t := ctx.parse(context.skip, input, pos)
+		if t == nil || len(t.Match) == 0 {
+			break
+		}
+		pos += len(t.Match)
+	}
+	return pos
+}
+
+// LineComment matches a comment that begins with prefix, such as "//" or "#",
+// and continues to the end of the line. The line break is not included.
+func LineComment(prefix string) Matcher {
+	start := []rune(prefix)
+	result := NewMatcher(func(input []rune) int {
+		if !hasPrefix(input, start) {
+			return -1
+		}
+		for k := len(start); k < len(input); k++ {
+			if input[k] == '\n' {
+				return k
+			}
+		}
+		return len(input)
+	})
+	result.generate = func(r *rand.Rand) []rune {
+		return append(append([]rune(nil), start...), randomComment(r)...)
+	}
+	result.expected = "comment"
+	return result
+}
+
+// BlockComment matches a comment that begins with open and ends with close,
+// such as "/*" and "*/". Block comments nest, so BlockComment("/*", "*/")
+// matches all of "/* a /* b */ c */". It fails if the comment isn't closed.
+func BlockComment(open, close string) Matcher {
+	o, c := []rune(open), []rune(close)
+	result := NewMatcher(func(input []rune) int {
+		if !hasPrefix(input, o) {
+			return -1
+		}
+		depth := 0
+		for k := 0; k < len(input); {
+			switch {
+			case hasPrefix(input[k:], o):
+				depth++
+				k += len(o)
+			case hasPrefix(input[k:], c):
+				depth--
+				k += len(c)
+				if depth == 0 {
+					return k
+				}
+			default:
+				k++
+			}
+		}
+		return -1
+	})
+	result.generate = func(r *rand.Rand) []rune {
+		comment := append([]rune(nil), o...)
+		comment = append(comment, randomComment(r)...)
+		return append(comment, c...)
+	}
+	result.expected = "comment"
+	return result
+}
+
+func hasPrefix(input, prefix []rune) bool {
+	if len(input) < len(prefix) {
+		return false
+	}
+	for k, r := range prefix {
+		if input[k] != r {
+			return false
+		}
+	}
+	return true
+}
+
+// randomComment returns the text of a random comment, made of letters and
+// spaces so that it doesn't contain comment markers.
+func randomComment(r *rand.Rand) []rune {
+	text := []rune{' '}
+	for n := r.IntN(4); n > 0; n-- {
+		for m := 1 + r.IntN(5); m > 0; m-- {
+			text = append(text, rune('a'+r.IntN(26)))
+		}
+		text = append(text, ' ')
+	}
+	return text
+}
+
+// A skipMode identifies what Token skips: whitespace, if skip is the zero ID
+// and lexical is false, nothing if lexical is true, or matches of the parser
+// with ID skip.
+type skipMode struct {
+	skip    ID
+	lexical bool
+}
+
+func (context *Context) skipID() skipMode {
+	mode := skipMode{lexical: context.lexical}
+	if context.skip != nil && !context.lexical {
+		mode.skip = context.skip.ID()
+	}
+	return mode
+}
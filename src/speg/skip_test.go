@@ -0,0 +1,151 @@
+package speg
+
+import (
+	"github.com/shoenig/test"
+	"strings"
+	"testing"
+)
+
+func TestComments(t *testing.T) {
+	tests := []struct {
+		name     string
+		parser   Parser
+		input    string
+		expected string
+	}{
+		{"line comment", LineComment("//"), "// note\nx", `"// note"`},
+		{"line comment at eof", LineComment("#"), "# note", `"# note"`},
+		{"not a line comment", LineComment("//"), "/ note", `<nil>`},
+		{"block comment", BlockComment("/*", "*/"), "/* a */ b */", `"/* a */"`},
+		{"nested block comment", BlockComment("/*", "*/"), "/* a /* b */ c */ d", `"/* a /* b */ c */"`},
+		{"unterminated block comment", BlockComment("/*", "*/"), "/* a /* b */ c", `<nil>`},
+		{"pascal comment", BlockComment("(*", "*)"), "(* x *)", `"(* x *)"`},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			test.Eq(t, tc.expected, tc.parser.Parse([]rune(tc.input), 0, NewContext()).String())
+		})
+	}
+}
+
+// callGrammar matches calls like f(a, "b c") with C-style comments between
+// the tokens. String literals are lexical, so comment markers and spaces
+// inside them are kept.
+func callGrammar() Parser {
+	return Skipping(cTrivia(), callRule())
+}
+
+func cTrivia() Parser {
+	return Or(WhiteSpace(), LineComment("//"), BlockComment("/*", "*/"))
+}
+
+func callRule() Parser {
+	str := Token(Lexical(Seq(Exactly(`"`), Star(Seq(Not(Exactly(`"`)), Any())), Exactly(`"`)))).Tagged("str")
+	arg := Or(Identifier().Tagged("id"), str)
+	return Seq(
+		Identifier().Tagged("fn"),
+		Exactly("(").Omit(),
+		SepBy(arg, Exactly(",")),
+		Exactly(")").Omit(),
+	)
+}
+
+func TestSkipping(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"no trivia", `f(a,b)`, `((fn "f") ((id "a") (id "b")))`},
+		{"whitespace", ` f ( a , b ) `, `((fn "f") ((id "a") (id "b")))`},
+		{"comments", "/* call */ f( // args\n a /* first */, /* nested /* comment */ */ b)", `((fn "f") ((id "a") (id "b")))`},
+		{"string keeps comment markers", `f(/* x */ "a /* b */ // c")`, `((fn "f") ((str "\"a /* b */ // c\"")))`},
+		{"unterminated comment", `f(a /* b)`, `<nil>`},
+	}
+	grammar := callGrammar()
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			test.Eq(t, tc.expected, grammar.Parse([]rune(tc.input), 0, NewContext()).String())
+		})
+	}
+}
+
+func TestSkippingNested(t *testing.T) {
+	or := Or(WhiteSpace(), LineComment("//"))
+	seq := Seq(Exactly("#"), Digits())
+	var list Parser
+	list = Skipping(or, Seq(Exactly("("), Star(Or(Exactly("x"), Indirect(&list))), Exactly(")")))
+	tests := []struct {
+		name     string
+		parser   Parser
+		input    string
+		expected string
+	}{
+		{"or", Skipping(or, Seq(Exactly("a"), Skipping(or, Exactly("b")))), "a // c\n b", `("a" "b")`},
+		{"seq", Skipping(seq, Seq(Exactly("a"), Skipping(seq, Exactly("b")))), "a#1#2b", `("a" "b")`},
+		{"different", Skipping(or, Seq(Exactly("a"), Skipping(seq, Exactly("b")))), "a #1b", `<nil>`},
+		{"recursive", list, "( x (x // y\n) )", `("(" ("x" ("(" ("x") ")")) ")")`},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			test.Eq(t, tc.expected, tc.parser.Parse([]rune(tc.input), 0, NewContext()).String())
+		})
+	}
+}
+
+func TestSkippingError(t *testing.T) {
+	ctx := NewContext()
+	input := []rune("f(a /* comment */ ;")
+	test.Nil(t, callGrammar().Parse(input, 0, ctx))
+	// The failure is reported after the trivia, at the semicolon.
+	test.Eq(t, strings.Index(string(input), ";"), ctx.Error().(*ParseError).Pos)
+}
+
+func TestLexicalToken(t *testing.T) {
+	// Within Lexical, even Token doesn't skip whitespace.
+	p := Lexical(Seq(Token(Exactly("a")), Token(Exactly("b"))))
+	test.Eq(t, `(("a") ("b"))`, p.Parse([]rune("ab"), 0, NewContext()).String())
+	test.Nil(t, p.Parse([]rune("a b"), 0, NewContext()))
+	// Outside of Skipping, Token skips whitespace but not comments.
+	q := Seq(Token(Exactly("a")), Token(Exactly("b")))
+	test.NotNil(t, q.Parse([]rune("a b"), 0, NewContext()))
+	test.Nil(t, q.Parse([]rune("a /**/ b"), 0, NewContext()))
+	test.NotNil(t, Skipping(BlockComment("/*", "*/"), q).Parse([]rune("a/**/b"), 0, NewContext()))
+}
+
+func TestSkippingLossless(t *testing.T) {
+	input := []rune("f( a /* first */ , b ) // done\n")
+	tree := NewContext().Lossless().Parse(Skipping(cTrivia(), Seq(callRule(), Token(Not(Any())))), input, 0)
+	test.NotNil(t, tree)
+	var b strings.Builder
+	var leaves []string
+	for _, leaf := range tree.Leaves() {
+		b.WriteString(string(leaf.Match))
+		if len(leaf.Match) > 0 {
+			leaves = append(leaves, string(leaf.Leading)+"|"+leaf.Text()+"|"+string(leaf.Trailing))
+		}
+	}
+	test.Eq(t, string(input), b.String())
+	test.Eq(t, []string{"|f|", "|(| ", "|a| /* first */ ", "|,| ", "|b| ", "|)| // done\n"}, leaves)
+}
+
+func TestSkippingCache(t *testing.T) {
+	// The same parsers match differently with and without skipping, so a
+	// shared context must not mix up their results.
+	a := Exactly("a")
+	ctx := NewContext()
+	input := []rune(" a")
+	test.Nil(t, a.Parse(input, 0, ctx))
+	test.Eq(t, `"a"`, Skipping(WhiteSpace(), a).Parse(input, 0, ctx).String())
+	test.Nil(t, Lexical(a).Parse(input, 0, ctx))
+}
+
+func TestGenerateSkipping(t *testing.T) {
+	grammar := callGrammar()
+	g := NewGenerator(grammar, 1)
+	for range 20 {
+		s, err := g.Generate()
+		test.NoError(t, err)
+		test.NotNil(t, grammar.Parse([]rune(s), 0, NewContext()))
+	}
+}
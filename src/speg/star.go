@@ -20,24 +20,30 @@ func (z StarParser) Flatten() TokenParser {
 }
 
 func (z StarParser) Parse(input []rune, start int, ctx *Context) *Tree {
+	cached, ok := ctx.getCachedValue(z.id, start)
+	if ok {
+		return cached
+	}
 	pos := start
-	var children []*Tree
-	_, isOmitParser := z.parser.(OmitParser)
+	var children, nodes []*Tree
 	for {
-		child := z.parser.Parse(input, pos, ctx)
+		mark := ctx.mark()
+		child := ctx.parse(z.parser, input, pos)
 		if child == nil || len(child.Match) == 0 || pos == len(input) {
+			// A match of the empty string isn't included, so neither is any
+			// change it made to the state.
+			ctx.reset(mark)
 			result := &Tree{
 				Start:    start,
 				Match:    input[start:pos],
 				Children: children,
+				Nodes:    nodes,
 			}
 			ctx.setCachedValue(z.id, start, result)
 			return result
 		} else {
 			pos += len(child.Match)
-			if ctx.withChildren && !isOmitParser {
-				children = append(children, child)
-			}
+			ctx.addChild(&children, &nodes, z.parser, child)
 		}
 	}
 }
@@ -0,0 +1,297 @@
+package speg
+
+import (
+	"hash/maphash"
+	"maps"
+	"math"
+	"reflect"
+	"slices"
+)
+
+// A state is the part of a parse that parsers like Indent and Update change
+// as they go. States are immutable: a parser that changes the state replaces
+// it, so undoing a change, when a parser fails or its result is discarded, is
+// a matter of putting back the earlier pointer. The nil *state is the state at
+// the beginning of a parse. States are interned by the memo, so equal states
+// are the same pointer.
+type state struct {
+	// indents holds the indentation widths of the enclosing blocks,
+	// innermost last.
+	indents []int
+	// pending counts the virtual INDENT (if positive) or DEDENT (if
+	// negative) tokens produced by LineBreak and not yet matched.
+	pending int
+	// values holds the user state. See Context.Value.
+	values map[any]any
+}
+
+// clone returns a copy of s that can be modified.
+func (s *state) clone() *state {
+	if s == nil {
+		return &state{}
+	}
+	result := *s
+	return &result
+}
+
+// indent returns the indentation width of the innermost block.
+func (s *state) indent() int {
+	if s == nil || len(s.indents) == 0 {
+		return 0
+	}
+	return s.indents[len(s.indents)-1]
+}
+
+// depth returns the number of enclosing blocks.
+func (s *state) depth() int {
+	if s == nil {
+		return 0
+	}
+	return len(s.indents)
+}
+
+// withIndents returns a copy of s with the given indentation widths.
+func (s *state) withIndents(indents []int) *state {
+	result := s.clone()
+	result.indents = indents
+	return result
+}
+
+// push returns a copy of s with a block of width added.
+func (s *state) push(width int) *state {
+	indents := s.clone().indents
+	return s.withIndents(append(indents[:len(indents):len(indents)], width))
+}
+
+// pop returns a copy of s with the innermost block removed.
+func (s *state) pop() *state {
+	return s.withIndents(s.indents[:len(s.indents)-1])
+}
+
+// withPending returns a copy of s with pending virtual tokens.
+func (s *state) withPending(pending int) *state {
+	result := s.clone()
+	result.pending = pending
+	return result
+}
+
+// withValue returns a copy of s in which key is bound to value.
+func (s *state) withValue(key, value any) *state {
+	result := s.clone()
+	result.values = make(map[any]any, len(result.values)+1)
+	if s != nil {
+		for k, v := range s.values {
+			result.values[k] = v
+		}
+	}
+	result.values[key] = value
+	return result
+}
+
+// equal reports whether s and t are the same state. Values are compared with
+// reflect.DeepEqual.
+func (s *state) equal(t *state) bool {
+	return slices.Equal(s.indents, t.indents) && s.pending == t.pending &&
+		maps.EqualFunc(s.values, t.values, func(a, b any) bool {
+			return reflect.DeepEqual(a, b)
+		})
+}
+
+// stateSeed seeds the hashes of states.
+var stateSeed = maphash.MakeSeed()
+
+// hash returns a hash of the contents of s, the same for states that are
+// equal.
+func (s *state) hash() uint64 {
+	var h maphash.Hash
+	h.SetSeed(stateSeed)
+	for _, indent := range s.indents {
+		writeInt(&h, int64(indent))
+	}
+	writeInt(&h, -1)
+	writeInt(&h, int64(s.pending))
+	hashValue(&h, reflect.ValueOf(s.values), 0)
+	return h.Sum64()
+}
+
+func writeInt(h *maphash.Hash, n int64) {
+	var b [8]byte
+	for k := range b {
+		b[k] = byte(n >> (8 * k))
+	}
+	h.Write(b[:])
+}
+
+// maxHashDepth bounds how many pointers and interfaces hashValue follows, so
+// that it stops on cyclic values.
+const maxHashDepth = 16
+
+// hashValue adds v to h, following pointers, such that values that are equal
+// according to reflect.DeepEqual hash alike. Maps are hashed without regard
+// to the order of their entries.
+func hashValue(h *maphash.Hash, v reflect.Value, depth int) {
+	if depth > maxHashDepth {
+		return
+	}
+	writeInt(h, int64(v.Kind()))
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			writeInt(h, 1)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		writeInt(h, v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		writeInt(h, int64(v.Uint()))
+	case reflect.Float32, reflect.Float64:
+		// Adding 0 turns -0 into 0, which DeepEqual takes to be equal.
+		writeInt(h, int64(math.Float64bits(v.Float()+0)))
+	case reflect.Complex64, reflect.Complex128:
+		c := v.Complex()
+		writeInt(h, int64(math.Float64bits(real(c)+0)))
+		writeInt(h, int64(math.Float64bits(imag(c)+0)))
+	case reflect.String:
+		h.WriteString(v.String())
+	case reflect.Slice, reflect.Array:
+		writeInt(h, int64(v.Len()))
+		for k := range v.Len() {
+			hashValue(h, v.Index(k), depth)
+		}
+	case reflect.Map:
+		writeInt(h, int64(v.Len()))
+		var sum uint64
+		for it := v.MapRange(); it.Next(); {
+			var entry maphash.Hash
+			entry.SetSeed(stateSeed)
+			hashValue(&entry, it.Key(), depth)
+			hashValue(&entry, it.Value(), depth)
+			sum += entry.Sum64()
+		}
+		writeInt(h, int64(sum))
+	case reflect.Pointer, reflect.Interface:
+		if !v.IsNil() {
+			if v.Kind() == reflect.Interface {
+				h.WriteString(v.Elem().Type().String())
+			}
+			hashValue(h, v.Elem(), depth+1)
+		}
+	case reflect.Struct:
+		for k := range v.NumField() {
+			hashValue(h, v.Field(k), depth)
+		}
+	}
+}
+
+// memo holds the results of parsers, and the state they were computed in,
+// for a parse. It is shared by all the contexts derived from the one returned
+// by NewContext.
+type memo struct {
+	caches map[memoKey]Cache
+	// entries holds the states in which the parsers that are still running
+	// started, so that their results can be cached under those states. A
+	// parser can be running more than once at a site, in different states,
+	// so each site has a stack, innermost last.
+	entries map[site][]*state
+	// exits holds the state left behind by each cached success that changed
+	// the state.
+	exits map[exitKey]*state
+	// failures holds, for cached failures of parsers like Where that record
+	// why they failed, a function that records it again.
+	failures map[exitKey]func(ctx *Context)
+	// state is the current state of the parse.
+	state *state
+	// states holds the interned states, by the hash of their contents, and
+	// interned is the set of them, so that equal states share caches.
+	states   map[uint64][]*state
+	interned map[*state]bool
+}
+
+// A memoKey identifies one of the caches of a parse. Results are cached
+// separately for each case mode, skip mode and state, since any of them can
+// change what a parser matches, and for lossless parses and parses without
+// children, as within Token and Omit, which build different trees.
+type memoKey struct {
+	foldCase     bool
+	lossless     bool
+	withChildren bool
+	skip         skipMode
+	state        *state
+}
+
+type site struct {
+	id  ID
+	pos int
+}
+
+type exitKey struct {
+	memoKey
+	site
+}
+
+func newMemo() *memo {
+	return &memo{
+		caches:   make(map[memoKey]Cache),
+		entries:  make(map[site][]*state),
+		exits:    make(map[exitKey]*state),
+		failures: make(map[exitKey]func(ctx *Context)),
+		states:   make(map[uint64][]*state),
+		interned: make(map[*state]bool),
+	}
+}
+
+// intern returns the state equal to s that the memo has seen before, if
+// there is one, and otherwise records s.
+func (m *memo) intern(s *state) *state {
+	if s == nil || m.interned[s] {
+		return s
+	}
+	if len(s.indents) == 0 && s.pending == 0 && len(s.values) == 0 {
+		return nil
+	}
+	hash := s.hash()
+	for _, t := range m.states[hash] {
+		if s.equal(t) {
+			return t
+		}
+	}
+	m.states[hash] = append(m.states[hash], s)
+	m.interned[s] = true
+	return s
+}
+
+// mark returns the current state, to be passed to reset when a parser
+// discards a successful result of one of its sub-parsers.
+func (context *Context) mark() *state {
+	return context.memo.state
+}
+
+// reset undoes the changes to the state made since mark was called. It is
+// also how parsers like Indent change the state.
+func (context *Context) reset(mark *state) {
+	context.memo.state = context.memo.intern(mark)
+}
+
+// Value returns the value bound to key in the user state of the parse, or
+// nil if there is none. The user state holds whatever a grammar needs to
+// remember as it goes, like the names declared by typedef in C. Like
+// context.Context, keys should be of unexported types so that they don't
+// collide.
+//
+// Changes to the user state, made with SetValue, are undone when the parser
+// that made them fails or is backtracked over, and results in the packrat
+// cache are keyed by the state in which they were computed. So a parser that
+// consults the user state can be memoized like any other.
+func (context *Context) Value(key any) any {
+	if s := context.memo.state; s != nil {
+		return s.values[key]
+	}
+	return nil
+}
+
+// SetValue binds key to value in the user state. It is usually called from
+// the function given to Update. Values should be treated as immutable: to
+// change one, bind a new value rather than modifying the old one, or the
+// change can't be undone.
+func (context *Context) SetValue(key, value any) {
+	context.reset(context.memo.state.withValue(key, value))
+}
@@ -13,7 +13,7 @@ func (t TaggedParser) Omit() Parser {
 }
 
 func (t TaggedParser) Parse(input []rune, start int, ctx *Context) *Tree {
-	tree := t.parser.Parse(input, start, ctx)
+	tree := ctx.parse(t.parser, input, start)
 	if tree == nil {
 		return nil
 	}
@@ -21,19 +21,38 @@ func (f TokenParser) ID() uuid.UUID {
 
 func (f TokenParser) Parse(input []rune, start int, ctx *Context) *Tree {
 	pos := start
-	for ; pos < len(input); pos++ {
-		if !unicode.IsSpace(input[pos]) {
-			break
+	switch {
+	case ctx.lexical:
+	case ctx.skip != nil:
+		pos = ctx.skipTrivia(input, start)
+	default:
+		for ; pos < len(input); pos++ {
+			if !unicode.IsSpace(input[pos]) {
+				break
+			}
 		}
 	}
-	t := f.parser.Parse(input, pos, ctx.WithoutChildren())
+	t := ctx.WithoutChildren().parse(f.parser, input, pos)
 	if t == nil {
 		return nil
 	}
+	end := pos + len(t.Match)
+	var nodes []*Tree
+	var leading []rune
+	if ctx.lossless {
+		if pos > start {
+			t = withLeading(t, input, pos-start)
+		}
+		nodes = []*Tree{t}
+	} else if pos > start {
+		leading = input[start:pos]
+	}
 	return &Tree{
 		Start: start,
-		Match: input[start:pos +len(t.Match)],
+		Match: input[start:end],
 		Children: []*Tree{t},
+		Leading: leading,
+		Nodes: nodes,
 		Tag: f.tag,
 	}
 }
@@ -47,9 +66,12 @@ func (f TokenParser) Tagged(tag string) TaggedParser {
 }
 
 // Token returns a parser that matches optional leading whitespace followed
-// by whatever parser matches. If it succeeds, it will have a single child
-// that contains the runes that parser matched. Moreover, the child will not
-// itself have any children.  
+// by whatever parser matches. Within Skipping, it skips the grammar's trivia
+// instead of whitespace, and within Lexical, it skips nothing. If it succeeds,
+// it will have a single child that contains the runes that parser matched.
+// Moreover, the child will not itself have any children, except in a lossless
+// parse (see Context.Lossless). The whitespace skipped is the Leading trivia
+// of the result, so its Text is just what parser matched.
 func Token(parser Parser) TokenParser {
 	return TokenParser{
 		id:     uuid.New(),
@@ -29,3 +29,27 @@ func TestTokenParser(t *testing.T) {
 	}
 }
 
+
+func TestTokenLeading(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		leading  string
+		text     string
+		children string
+	}{
+		{"no whitespace", "abc", "", "abc", `"abc"`},
+		{"spaces", "  abc", "  ", "abc", `"abc"`},
+		{"newline", "\n\tabc def", "\n\t", "abc", `"abc"`},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tree := Token(Letters()).Parse([]rune(tc.input), 0, NewContext())
+			test.NotNil(t, tree)
+			test.Eq(t, tc.leading, string(tree.Leading))
+			test.Eq(t, tc.text, tree.Text())
+			test.Eq(t, tc.children, tree.Children[0].String())
+			test.Nil(t, tree.Nodes)
+		})
+	}
+}
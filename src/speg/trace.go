@@ -0,0 +1,82 @@
+package speg
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A Tracer observes a parse as it happens. Install one with Context.WithTracer.
+//
+// Enter and Exit bracket every invocation of a parser by a combinator (and the
+// top-level invocation, if the parse is started with Context.Parse). Exit
+// receives the result, which is nil if the parser failed. Memo is called
+// whenever a parser consults the packrat cache, with hit reporting whether a
+// previous result was found.
+type Tracer interface {
+	Enter(parser Parser, start int)
+	Exit(parser Parser, start int, result *Tree)
+	Memo(id ID, start int, hit bool)
+}
+
+type multiTracer []Tracer
+
+func (m multiTracer) Enter(parser Parser, start int) {
+	for _, t := range m {
+		t.Enter(parser, start)
+	}
+}
+
+func (m multiTracer) Exit(parser Parser, start int, result *Tree) {
+	for _, t := range m {
+		t.Exit(parser, start, result)
+	}
+}
+
+func (m multiTracer) Memo(id ID, start int, hit bool) {
+	for _, t := range m {
+		t.Memo(id, start, hit)
+	}
+}
+
+// MultiTracer returns a Tracer that forwards every event to each of tracers,
+// in order.
+func MultiTracer(tracers ...Tracer) Tracer {
+	return multiTracer(tracers)
+}
+
+// describe returns a short human-readable name for parser, used in traces
+// and reports. It includes the parser's tag, if it has one, and a prefix of
+// its ID so that otherwise identical parsers can be told apart.
+func describe(parser Parser) string {
+	kind := strings.TrimPrefix(fmt.Sprintf("%T", parser), "speg.")
+	id := parser.ID().String()[:8]
+	tag := ""
+	switch p := parser.(type) {
+	case Matcher:
+		tag = p.tag
+	case TaggedParser:
+		tag = p.tag
+	case TokenParser:
+		tag = p.tag
+	case LeftRecursiveParser:
+		tag = p.tag
+	case RightRecursiveParser:
+		tag = p.tag
+	case OmitParser:
+		tag = p.tag
+	case IndentParser:
+		tag = p.kind.String()
+	case CaptureParser:
+		tag = p.name
+	case BackRefParser:
+		tag = p.name
+	case SkipParser:
+		if p.lexical {
+			tag = "lexical"
+		}
+	}
+	if tag == "" {
+		return fmt.Sprintf("%s#%s", kind, id)
+	}
+	return fmt.Sprintf("%s(%s)#%s", kind, tag, id)
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"unicode"
 )
 
 // A Tree describes the result of matching input.
@@ -18,6 +19,15 @@ type Tree struct {
 	Tag      string
 	// If Omit is true, this tree will be omitted from Children
 	Omit bool
+	// The trivia at the start of Match, such as whitespace skipped by Token,
+	// which Text leaves out. In a lossless parse (see Context.Lossless), only
+	// leaves have trivia, so Token attaches it to its first leaf instead.
+	Leading []rune
+	// In a lossless parse, the trivia at the end of Match.
+	Trailing []rune
+	// In a lossless parse, all the subtrees of this tree, in order, including
+	// the ones left out of Children. They cover Match without gaps.
+	Nodes []*Tree
 }
 
 func (t *Tree) String() string {
@@ -25,9 +35,9 @@ func (t *Tree) String() string {
 		return "<nil>"
 	}
 	if t.Children == nil && t.Tag == "" {
-		return fmt.Sprintf("%s", strconv.Quote(string(t.Match)))
+		return fmt.Sprintf("%s", strconv.Quote(t.Text()))
 	} else if t.Children == nil && t.Tag != "" {
-		return fmt.Sprintf("(%s %s)", t.Tag, strconv.Quote(string(t.Match)))
+		return fmt.Sprintf("(%s %s)", t.Tag, strconv.Quote(t.Text()))
 	}
 
 	var children []string
@@ -44,3 +54,61 @@ func (t *Tree) String() string {
 func (t *Tree) Matched() string {
 	return string(t.Match)
 }
+
+// Text returns the runes matched, without Leading or Trailing trivia.
+func (t *Tree) Text() string {
+	return string(t.Match[len(t.Leading) : len(t.Match)-len(t.Trailing)])
+}
+
+// textStart returns the position of the text of t, after the leading trivia
+// of its first leaf, and any whitespace.
+func textStart(t *Tree) int {
+	first := t.Nodes
+	if first == nil {
+		first = t.Children
+	}
+	if len(first) > 0 && first[0].Start == t.Start {
+		return textStart(first[0])
+	}
+	pos := t.Start + len(t.Leading)
+	for k := len(t.Leading); k < len(t.Match) && unicode.IsSpace(t.Match[k]); k++ {
+		pos++
+	}
+	return pos
+}
+
+// textEnd returns the end of the text of t, before the trailing trivia of
+// its last leaf, and any whitespace.
+func textEnd(t *Tree) int {
+	last := t.Nodes
+	if last == nil {
+		last = t.Children
+	}
+	end := t.Start + len(t.Match)
+	if n := len(last); n > 0 && last[n-1].Start+len(last[n-1].Match) == end {
+		return max(textEnd(last[n-1]), textStart(t))
+	}
+	for k := len(t.Match) - len(t.Trailing); k > 0 && unicode.IsSpace(t.Match[k-1]); k-- {
+		end--
+	}
+	return max(end-len(t.Trailing), textStart(t))
+}
+
+// Leaves returns the trees at the bottom of a lossless parse tree, those
+// without Nodes, in order. Concatenating their Matches reproduces the Match
+// of t.
+func (t *Tree) Leaves() []*Tree {
+	var result []*Tree
+	var visit func(t *Tree)
+	visit = func(t *Tree) {
+		if len(t.Nodes) == 0 {
+			result = append(result, t)
+			return
+		}
+		for _, node := range t.Nodes {
+			visit(node)
+		}
+	}
+	visit(t)
+	return result
+}
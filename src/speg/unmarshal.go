@@ -0,0 +1,55 @@
+package speg
+
+import "sparse/src/internal/decode"
+
+// An Unmarshaler fills itself from a parse tree. Unmarshal calls its
+// UnmarshalTree method, with a pointer receiver, instead of filling it.
+type Unmarshaler interface {
+	UnmarshalTree(t *Tree) error
+}
+
+// An UnmarshalError describes a tree that Unmarshal couldn't store in a Go
+// value, such as "x" in an int. Its Pos is the position of the tree's text
+// in the input.
+type UnmarshalError = decode.Error
+
+var treeDecoder = decode.Tree[*Tree]{
+	Tag:  func(t *Tree) string { return t.Tag },
+	Text: (*Tree).Text,
+	Children: func(t *Tree) []*Tree {
+		return t.Children
+	},
+	Pos: func(t *Tree) int {
+		return t.Start + len(t.Leading)
+	},
+}
+
+// Unmarshal stores t in the value that v points to:
+//
+//   - Strings get the text of the tree.
+//   - Numbers and bools are parsed from the text, as by strconv. Integers are
+//     read in base 10, so "010" is 10, unless the field is tagged
+//     `parse:"name,base"`, in which case they may have a base prefix, like 0x,
+//     and a leading 0 means octal, as in Go.
+//   - Pointers are allocated, and the tree stored in what they point to.
+//   - Slices get one element per child of the tree.
+//   - Each exported field of a struct is filled from the descendants of the
+//     tree that are tagged with the field's name, or with the name in its
+//     `parse:"name"` struct tag, without looking inside other tagged trees,
+//     which belong to nested structs. A slice field gets all of the matching
+//     trees, and other fields the first one. A slice field tagged
+//     `parse:"name,list"` gets the children of the first matching tree
+//     instead, for lists tagged as a whole. Options can be combined, as in
+//     `parse:"name,list,base"`. Fields without a matching tree are left
+//     alone, as are fields tagged `parse:"-"`.
+//   - Values that implement Unmarshaler or encoding.TextUnmarshaler unmarshal
+//     themselves.
+//
+// Without a name in its struct tag, a field's name matches tree tags without
+// regard to case, so a field Name is filled from a tree tagged "name".
+//
+// If text can't be converted, Unmarshal returns an *UnmarshalError with its
+// position.
+func Unmarshal(t *Tree, v any) error {
+	return treeDecoder.Unmarshal(t, v)
+}
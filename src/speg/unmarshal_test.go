@@ -0,0 +1,164 @@
+package speg
+
+import (
+	"errors"
+	"github.com/shoenig/test"
+	"strconv"
+	"testing"
+)
+
+type point struct {
+	X, Y float64
+}
+
+type color struct {
+	R, G, B uint8
+}
+
+func (c *color) UnmarshalTree(t *Tree) error {
+	n, err := strconv.ParseUint(t.Text()[1:], 16, 24)
+	if err != nil {
+		return errors.New("bad color")
+	}
+	c.R, c.G, c.B = uint8(n>>16), uint8(n>>8), uint8(n)
+	return nil
+}
+
+type shape struct {
+	Name   string  `parse:"name"`
+	Points []point `parse:"point"`
+	Closed bool
+	Color  *color `parse:"color"`
+	Layer  int    `parse:",base"`
+	Note   string `parse:"-"`
+}
+
+// shapeGrammar matches shapes like
+//
+//	polygon "tri" closed=true layer=0x10 (0, 0) (1, 2.5) #ff8000
+func shapeGrammar() Parser {
+	number := Token(Regex(`-?[0-9][0-9a-fA-Fx.]*`))
+	pt := Seq(Token(Exactly("(")), number.Tagged("x"), Token(Exactly(",")), number.Tagged("y"), Token(Exactly(")"))).Tagged("point")
+	return Seq(
+		Token(Exactly("polygon")),
+		Between(Token(Exactly(`"`)), Regex(`[^"]*`).Tagged("name"), Exactly(`"`)),
+		Opt(Seq(Token(Exactly("closed=")), Regex(`[a-z]+`).Tagged("closed"))),
+		Opt(Seq(Token(Exactly("layer=")), Regex(`[0-9a-zA-Z]+`).Tagged("layer"))),
+		Star(pt),
+		Opt(Token(Regex(`#[0-9a-z]+`)).Tagged("color")),
+	)
+}
+
+func TestUnmarshal(t *testing.T) {
+	input := []rune(`polygon "tri" closed=true layer=0x10 (0, 0) (1, 2.5) (-3,1e2) #ff8000`)
+	tree := shapeGrammar().Parse(input, 0, NewContext())
+	test.NotNil(t, tree)
+	s := shape{Note: "kept"}
+	test.NoError(t, Unmarshal(tree, &s))
+	test.Eq(t, shape{
+		Name:   "tri",
+		Points: []point{{0, 0}, {1, 2.5}, {-3, 100}},
+		Closed: true,
+		Color:  &color{0xff, 0x80, 0},
+		Layer:  16,
+		Note:   "kept",
+	}, s)
+}
+
+func TestUnmarshalLeadingZeros(t *testing.T) {
+	number := Token(Regex(`[0-9a-fx]+`))
+	grammar := Seq(number.Tagged("dec"), number.Tagged("prefixed"), number.Tagged("u"))
+	type numbers struct {
+		Dec      int
+		Prefixed int  `parse:",base"`
+		U        uint `parse:"u"`
+	}
+	tests := []struct {
+		name     string
+		input    string
+		expected numbers
+		err      string
+	}{
+		{"decimal", "010 010 010", numbers{10, 8, 10}, ""},
+		{"not octal", "09 0x9 08", numbers{9, 9, 8}, ""},
+		{"prefix needs option", "0x10 0 0", numbers{}, `cannot unmarshal "0x10" at 0 into int: invalid syntax`},
+		{"bad octal", "0 09 0", numbers{}, `cannot unmarshal "09" at 2 into int: invalid syntax`},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tree := grammar.Parse([]rune(tc.input), 0, NewContext())
+			test.NotNil(t, tree)
+			var n numbers
+			err := Unmarshal(tree, &n)
+			if tc.err != "" {
+				test.EqError(t, err, tc.err)
+				return
+			}
+			test.NoError(t, err)
+			test.Eq(t, tc.expected, n)
+		})
+	}
+}
+
+func TestUnmarshalMissing(t *testing.T) {
+	tree := shapeGrammar().Parse([]rune(`polygon ""`), 0, NewContext())
+	var s shape
+	test.NoError(t, Unmarshal(tree, &s))
+	test.Eq(t, shape{}, s)
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"bool", `polygon "a" closed=maybe`, `cannot unmarshal "maybe" at 19 into bool: invalid syntax`},
+		{"int", `polygon "a" layer=12x`, `cannot unmarshal "12x" at 18 into int: invalid syntax`},
+		{"float", `polygon "a" (1, 2) ( 1.2.3, 0)`, `cannot unmarshal "1.2.3" at 21 into float64: invalid syntax`},
+		{"custom", `polygon "a" #xyz`, `cannot unmarshal "#xyz" at 12 into speg.color: bad color`},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tree := shapeGrammar().Parse([]rune(tc.input), 0, NewContext())
+			test.NotNil(t, tree)
+			var s shape
+			err := Unmarshal(tree, &s)
+			test.EqError(t, err, tc.expected)
+			var uerr *UnmarshalError
+			test.True(t, errors.As(err, &uerr))
+		})
+	}
+}
+
+func TestUnmarshalValues(t *testing.T) {
+	digits := Seq(Token(Digits()), Token(Digits()), Token(Digits()))
+	tree := digits.Parse([]rune("1 22 333"), 0, NewContext())
+
+	var ints []int
+	test.NoError(t, Unmarshal(tree, &ints))
+	test.Eq(t, []int{1, 22, 333}, ints)
+
+	var text string
+	test.NoError(t, Unmarshal(tree, &text))
+	test.Eq(t, "1 22 333", text)
+
+	var small []int8
+	test.EqError(t, Unmarshal(tree, &small), `cannot unmarshal "333" at 5 into int8: value out of range`)
+
+	test.Error(t, Unmarshal(tree, ints))
+	test.Error(t, Unmarshal(nil, &ints))
+	// A list tagged as a whole fills a slice field tagged with the list
+	// option.
+	call := Seq(Identifier().Tagged("fn"), Exactly("("), SepBy(Token(Digits()), Token(Exactly(","))).Tagged("args"), Exactly(")"))
+	var c struct {
+		Fn   string
+		Args []int `parse:"args,list"`
+	}
+	test.NoError(t, Unmarshal(call.Parse([]rune("max(1, 2,3)"), 0, NewContext()), &c))
+	test.Eq(t, "max", c.Fn)
+	test.Eq(t, []int{1, 2, 3}, c.Args)
+
+	var ch chan int
+	test.Error(t, Unmarshal(tree, &ch))
+}
@@ -0,0 +1,645 @@
+package speg
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// An Unparser prints parse trees back as text, so that refactoring tools can
+// parse a file, change the tree with Rewrite or RewriteAll, and write the file
+// back with a minimal diff:
+//
+//	u := NewUnparser(grammar)
+//	text, err := u.Unparse(original, rewritten, input)
+//
+// The trees that weren't changed are printed as they were in the input, and
+// so is the text between trees that are still next to each other, whitespace,
+// comments and omitted tokens included. The rest is printed according to the
+// grammar: leaves as their text, omitted literals, like the parentheses of
+// Between, as the text they match, and Separator between tokens that weren't
+// next to each other in the input. New lines in grammars with indentation
+// parsers are indented like the first indented line of the input, once for
+// each enclosing block.
+type Unparser struct {
+	root Parser
+
+	// Separator returns the text to put between two tokens, given their
+	// text, where the grammar allows whitespace between them, that is,
+	// before a Token outside of Lexical, or a literal within Skipping. The
+	// default is DefaultSeparator.
+	Separator func(before, after string) string
+}
+
+// NewUnparser returns an Unparser for trees produced by the grammar root.
+func NewUnparser(root Parser) *Unparser {
+	return &Unparser{
+		root:      root,
+		Separator: DefaultSeparator,
+	}
+}
+
+// DefaultSeparator puts a space between tokens, except after an opening
+// bracket, or before a closing bracket or a comma, semicolon or period.
+func DefaultSeparator(before, after string) string {
+	last, _ := utf8.DecodeLastRuneInString(before)
+	first, _ := utf8.DecodeRuneInString(after)
+	if strings.ContainsRune("([{", last) || strings.ContainsRune(")]},;.", first) {
+		return ""
+	}
+	return " "
+}
+
+// Unparse returns the text of edited, a tree made from original, which was
+// parsed from input by the grammar. The trees of original that are part of
+// edited are taken to be unchanged, so trees must be changed by replacing
+// them, as Rewrite does, rather than in place. Copies that Rewrite makes of
+// trees whose children changed keep the text around those children that
+// didn't.
+//
+// It fails if a changed tree couldn't have been produced by the grammar: if
+// its tags, the number of its children or the text of its leaves don't fit.
+func (u *Unparser) Unparse(original, edited *Tree, input []rune) (string, error) {
+	p := &unparser{
+		Unparser: u,
+		input:    input,
+		original: make(map[*Tree]bool),
+		layouts:  make(map[layoutKey]layoutResult),
+		unit:     indentUnit(input),
+	}
+	for _, t := range original.Preorder() {
+		p.original[t] = true
+	}
+	// The text around original, which its tokens don't include, stays around
+	// edited.
+	p.out.WriteString(string(input[:textStart(original)]))
+	if err := p.print(edited, original, u.root, unparseContext{}); err != nil {
+		return "", err
+	}
+	if end := textEnd(original); end < len(input) {
+		p.out.WriteString(string(input[end:]))
+	} else if p.newline {
+		p.out.WriteString("\n")
+	}
+	return p.out.String(), nil
+}
+
+// An unparseContext is the state of a parse that affects how a tree is
+// printed.
+type unparseContext struct {
+	lexical  bool
+	skipping bool
+	foldCase bool
+	// tagged is set if the tag of the tree has been checked by an enclosing
+	// parser, whose tag overrides those of the parsers within it.
+	tagged bool
+}
+
+// An unparseItem is part of the text of a tree: a child, printed with the
+// parser that produced it, or text.
+type unparseItem struct {
+	tree   *Tree
+	parser Parser
+	ctx    unparseContext
+	text   string
+	// spaced is set for text before which the grammar allows whitespace.
+	spaced bool
+	// indent is set for the text of an indentation parser, which depends on
+	// the enclosing blocks, and is found as the item is printed.
+	indent *IndentParser
+}
+
+type layoutKey struct {
+	id   ID
+	tree *Tree
+	ctx  unparseContext
+}
+
+type layoutResult struct {
+	items []unparseItem
+	ok    bool
+}
+
+type unparser struct {
+	*Unparser
+	input    []rune
+	original map[*Tree]bool
+	layouts  map[layoutKey]layoutResult
+	out      strings.Builder
+	// last is the text of the last token printed, or empty if what follows
+	// it is printed as it was in the input.
+	last string
+	// indents holds the indentation of the enclosing blocks, innermost last,
+	// and unit is what each adds to the one before.
+	indents []string
+	unit    string
+	// newline is set if the text of a LineBreak has yet to be printed
+	// before the next token.
+	newline bool
+}
+
+// print prints t, produced by p, whose original, if it has one, is o.
+func (u *unparser) print(t, o *Tree, p Parser, ctx unparseContext) error {
+	items, ok := u.layout(p, t, ctx)
+	if u.original[t] {
+		u.token(string(u.input[textStart(t):textEnd(t)]), !ok || u.spaced(items))
+		// Blocks begun or ended by t, rather than its children, stay so.
+		for _, item := range items {
+			if item.indent != nil {
+				u.indentation(*item.indent)
+				u.newline = u.newline || item.indent.kind == lineBreak
+			}
+		}
+		return nil
+	}
+	if !ok {
+		return fmt.Errorf("unparse: %s doesn't fit the grammar", t)
+	}
+	aligned := align(t, o)
+	var pending []unparseItem
+	flush := func() {
+		for _, item := range pending {
+			if item.indent != nil && item.indent.kind == lineBreak {
+				u.newline = true
+			}
+			u.token(item.text, item.spaced)
+		}
+		pending = nil
+	}
+	// prev is the index among the children of o of the last child printed,
+	// -1 before the first one, or -2 if the last one isn't aligned.
+	prev := -1
+	for _, item := range items {
+		if item.indent != nil {
+			item.text = u.indentation(*item.indent)
+		}
+		if item.tree == nil {
+			pending = append(pending, item)
+			continue
+		}
+		k, found := aligned[item.tree]
+		switch {
+		case !found:
+			flush()
+			prev = -2
+		case prev == -1 && k == 0:
+			// What precedes the first child in the input replaces what the
+			// grammar would put there.
+			if start, end := textStart(o), textStart(o.Children[0]); start < end {
+				u.newline = false
+				u.token(string(u.input[start:end]), u.spaced(items))
+				u.last = ""
+			}
+			pending = nil
+		case prev >= 0 && k == prev+1:
+			u.newline = false
+			u.out.WriteString(string(u.input[textEnd(o.Children[prev]):textStart(o.Children[k])]))
+			u.last = ""
+			pending = nil
+		default:
+			flush()
+		}
+		if found {
+			prev = k
+		}
+		var oc *Tree
+		if found {
+			oc = o.Children[k]
+		}
+		if err := u.print(item.tree, oc, item.parser, item.ctx); err != nil {
+			return err
+		}
+	}
+	if prev >= 0 && prev == len(o.Children)-1 {
+		if start, end := textEnd(o.Children[prev]), textEnd(o); start < end {
+			u.newline = false
+			u.token(string(u.input[start:end]), false)
+		}
+		pending = nil
+	}
+	flush()
+	return nil
+}
+
+// token prints text, after a separator if spaced is set and it follows
+// another token.
+func (u *unparser) token(text string, spaced bool) {
+	if text == "" {
+		return
+	}
+	if u.newline {
+		u.out.WriteString("\n" + u.indent())
+		u.newline = false
+		u.last = ""
+	}
+	if spaced && u.last != "" {
+		u.out.WriteString(u.Separator(u.last, text))
+	}
+	u.out.WriteString(text)
+	u.last = text
+}
+
+// indentation begins or ends the blocks that p would, and returns the text it
+// matches on a new line. The text of LineBreak depends on the INDENT and DEDENT
+// tokens that follow it, so it is printed with the next token instead.
+func (u *unparser) indentation(p IndentParser) string {
+	switch p.kind {
+	case indentBlock:
+		u.indents = append(u.indents, u.indent()+u.unit)
+		return u.indent()
+	case sameIndent:
+		return u.indent()
+	case indentToken:
+		u.indents = append(u.indents, u.indent()+u.unit)
+	case dedentBlock, dedentToken:
+		if len(u.indents) > 0 {
+			u.indents = u.indents[:len(u.indents)-1]
+		}
+	}
+	return ""
+}
+
+// indent returns the indentation of the innermost enclosing block.
+func (u *unparser) indent() string {
+	if len(u.indents) == 0 {
+		return ""
+	}
+	return u.indents[len(u.indents)-1]
+}
+
+// indentUnit returns the indentation of the first indented line of input, or
+// four spaces if there is none.
+func indentUnit(input []rune) string {
+	for _, line := range strings.Split(string(input), "\n") {
+		if trimmed := strings.TrimLeft(line, " \t"); trimmed != "" && trimmed != line {
+			return line[:len(line)-len(trimmed)]
+		}
+	}
+	return "    "
+}
+
+// spaced reports whether the grammar allows whitespace before items.
+func (u *unparser) spaced(items []unparseItem) bool {
+	for _, item := range items {
+		if item.tree == nil {
+			if item.text != "" {
+				return item.spaced
+			}
+			continue
+		}
+		children, ok := u.layout(item.parser, item.tree, item.ctx)
+		if !ok {
+			return true
+		}
+		if len(children) > 0 {
+			return u.spaced(children)
+		}
+	}
+	return false
+}
+
+// align maps the children of t to the indices of the children of o they
+// stand for. Those that are children of o themselves stand for themselves.
+// The others, between two of those, stand for the ones of o between the same
+// two with the same tag, in order, so that a copy made by Rewrite, or a
+// replacement, takes the place of the tree it replaced.
+func align(t, o *Tree) map[*Tree]int {
+	result := make(map[*Tree]int)
+	if o == nil {
+		return result
+	}
+	index := make(map[*Tree]int)
+	for k, oc := range o.Children {
+		index[oc] = k
+	}
+	next := 0
+	var between []*Tree
+	pair := func(end int) {
+		for _, c := range between {
+			for k := next; k < end; k++ {
+				if o.Children[k].Tag == c.Tag {
+					result[c] = k
+					next = k + 1
+					break
+				}
+			}
+		}
+		between = nil
+	}
+	for _, c := range t.Children {
+		if k, ok := index[c]; ok && k >= next {
+			pair(k)
+			result[c] = k
+			next = k + 1
+			continue
+		}
+		between = append(between, c)
+	}
+	pair(len(o.Children))
+	return result
+}
+
+// layout returns the parts of the text of t, if p could have produced it.
+func (u *unparser) layout(p Parser, t *Tree, ctx unparseContext) ([]unparseItem, bool) {
+	for {
+		d, ok := p.(IndirectParser)
+		if !ok {
+			break
+		}
+		p = **d.parser
+	}
+	key := layoutKey{p.ID(), t, ctx}
+	if r, ok := u.layouts[key]; ok {
+		return r.items, r.ok
+	}
+	// A grammar that can produce t from itself without consuming any of it
+	// fails rather than recursing forever.
+	u.layouts[key] = layoutResult{}
+	items, ok := u.layoutOf(p, t, ctx)
+	u.layouts[key] = layoutResult{items, ok}
+	return items, ok
+}
+
+func (u *unparser) layoutOf(p Parser, t *Tree, ctx unparseContext) ([]unparseItem, bool) {
+	inner := ctx
+	inner.tagged = false
+	switch pp := p.(type) {
+	case TaggedParser:
+		if !hasTag(t, pp.tag, ctx) {
+			return nil, false
+		}
+		ctx.tagged = true
+		return u.layout(pp.parser, t, ctx)
+	case Matcher:
+		if !hasTag(t, pp.tag, ctx) || t.Children != nil || !matchesAll(pp, t.Text(), ctx) {
+			return nil, false
+		}
+		return []unparseItem{{text: t.Text(), spaced: ctx.skipping && pp.skips && !ctx.lexical}}, true
+	case LiteralsParser:
+		if !hasTag(t, "", ctx) || t.Children != nil || !matchesAll(pp, t.Text(), ctx) {
+			return nil, false
+		}
+		return []unparseItem{{text: t.Text(), spaced: ctx.skipping && !ctx.lexical}}, true
+	case RegexParser:
+		if !hasTag(t, "", ctx) || t.Children != nil || !matchesAll(pp, t.Text(), ctx) {
+			return nil, false
+		}
+		return []unparseItem{{text: t.Text()}}, true
+	case BackRefParser:
+		if !hasTag(t, "", ctx) || t.Children != nil {
+			return nil, false
+		}
+		return []unparseItem{{text: t.Text()}}, true
+	case TokenParser:
+		text := t.Text()
+		switch {
+		case !hasTag(t, pp.tag, ctx) || len(t.Children) > 1:
+			return nil, false
+		case len(t.Children) == 1:
+			text = t.Children[0].Text()
+		}
+		if !matchesAll(pp.parser, text, ctx) {
+			return nil, false
+		}
+		return []unparseItem{{text: text, spaced: !ctx.lexical}}, true
+	case NotParser, LookingAtParser:
+		if !hasTag(t, "", ctx) || len(t.Match) > 0 {
+			return nil, false
+		}
+		return nil, true
+	case SequenceParser:
+		if !hasTag(t, "", ctx) {
+			return nil, false
+		}
+		return u.layoutChildren(pp.subParsers, t.Children, inner)
+	case OrParser:
+		for _, alt := range pp.subParsers {
+			if items, ok := u.layout(alt, t, ctx); ok {
+				return items, true
+			}
+		}
+		return nil, false
+	case OptionalParser:
+		if len(t.Match) == 0 && t.Children == nil {
+			return nil, hasTag(t, "", ctx)
+		}
+		return u.layout(pp.parser, t, ctx)
+	case StarParser:
+		if !hasTag(t, "", ctx) {
+			return nil, false
+		}
+		return u.layoutRepeat(pp.parser, t.Children, inner)
+	case RepeatParser:
+		if !hasTag(t, "", ctx) || len(t.Children) < pp.min || pp.max >= 0 && len(t.Children) > pp.max {
+			return nil, false
+		}
+		return u.layoutRepeat(pp.parser, t.Children, inner)
+	case SeparatedParser:
+		if !hasTag(t, "", ctx) || len(t.Children) < pp.min {
+			return nil, false
+		}
+		var items []unparseItem
+		for k, c := range t.Children {
+			if k > 0 {
+				sep, ok := u.fixed(pp.sep, inner)
+				if !ok {
+					return nil, false
+				}
+				items = append(items, sep...)
+			}
+			if _, ok := u.layout(pp.item, c, inner); !ok {
+				return nil, false
+			}
+			items = append(items, unparseItem{tree: c, parser: pp.item, ctx: inner})
+		}
+		return items, true
+	case BetweenParser:
+		if !hasTag(t, "", ctx) || len(t.Children) != 1 {
+			return nil, false
+		}
+		open, ok := u.fixed(pp.open, inner)
+		if !ok {
+			return nil, false
+		}
+		close, ok := u.fixed(pp.close, inner)
+		if !ok {
+			return nil, false
+		}
+		if _, ok := u.layout(pp.parser, t.Children[0], inner); !ok {
+			return nil, false
+		}
+		items := append(open, unparseItem{tree: t.Children[0], parser: pp.parser, ctx: inner})
+		return append(items, close...), true
+	case LeftRecursiveParser:
+		// A tree for an application of the continuation has the left hand
+		// side and the children of the continuation as its children, which
+		// are laid out as those of a tree of the continuation.
+		if hasTag(t, pp.tag, ctx) && len(t.Children) > 1 {
+			if _, ok := u.layout(pp, t.Children[0], inner); ok {
+				rest, ok := u.layout(pp.continuation, &Tree{Children: t.Children[1:]}, inner)
+				if ok {
+					lhs := unparseItem{tree: t.Children[0], parser: pp, ctx: inner}
+					return append([]unparseItem{lhs}, rest...), true
+				}
+			}
+		}
+		return u.layout(pp.base, t, ctx)
+	case RightRecursiveParser:
+		if n := len(t.Children); hasTag(t, pp.tag, ctx) && n > 1 {
+			if _, ok := u.layout(pp, t.Children[n-1], inner); ok {
+				lead, ok := u.layout(pp.lead, &Tree{Children: t.Children[:n-1]}, inner)
+				if ok {
+					rhs := unparseItem{tree: t.Children[n-1], parser: pp, ctx: inner}
+					return append(lead, rhs), true
+				}
+			}
+		}
+		return u.layout(pp.base, t, ctx)
+	case OperatorParser:
+		for _, op := range pp.operators {
+			if items, ok := u.layoutOperator(pp, op, t, ctx); ok {
+				return items, true
+			}
+		}
+		return u.layout(pp.operand, t, ctx)
+	case CaseParser:
+		ctx.foldCase = pp.fold
+		return u.layout(pp.parser, t, ctx)
+	case SkipParser:
+		ctx.lexical = pp.lexical
+		ctx.skipping = !pp.lexical && (pp.skip != nil || ctx.skipping)
+		return u.layout(pp.parser, t, ctx)
+	case StateParser:
+		return u.layout(pp.parser, t, ctx)
+	case PredicateParser:
+		return u.layout(pp.parser, t, ctx)
+	case CaptureParser:
+		return u.layout(pp.parser, t, ctx)
+	case ScopeParser:
+		return u.layout(pp.parser, t, ctx)
+	case IndentParser:
+		if !hasTag(t, "", ctx) || t.Children != nil {
+			return nil, false
+		}
+		return []unparseItem{{indent: &pp}}, true
+	}
+	return nil, false
+}
+
+// layoutChildren lays out children as the results of parsers, in order,
+// omitted ones excepted.
+func (u *unparser) layoutChildren(parsers []Parser, children []*Tree, ctx unparseContext) ([]unparseItem, bool) {
+	var items []unparseItem
+	for _, sub := range parsers {
+		if _, omitted := sub.(OmitParser); omitted {
+			fixed, ok := u.fixed(sub, ctx)
+			if !ok {
+				return nil, false
+			}
+			items = append(items, fixed...)
+			continue
+		}
+		if len(children) == 0 {
+			return nil, false
+		}
+		if _, ok := u.layout(sub, children[0], ctx); !ok {
+			return nil, false
+		}
+		items = append(items, unparseItem{tree: children[0], parser: sub, ctx: ctx})
+		children = children[1:]
+	}
+	return items, len(children) == 0
+}
+
+func (u *unparser) layoutRepeat(p Parser, children []*Tree, ctx unparseContext) ([]unparseItem, bool) {
+	var items []unparseItem
+	for _, c := range children {
+		if _, ok := u.layout(p, c, ctx); !ok {
+			return nil, false
+		}
+		items = append(items, unparseItem{tree: c, parser: p, ctx: ctx})
+	}
+	return items, true
+}
+
+// layoutOperator lays out t as an application of op.
+func (u *unparser) layoutOperator(p OperatorParser, op operator, t *Tree, ctx unparseContext) ([]unparseItem, bool) {
+	if !hasTag(t, op.tag, ctx) {
+		return nil, false
+	}
+	var parsers []Parser
+	switch op.kind {
+	case prefixOperator:
+		parsers = []Parser{op.parser, p}
+	case postfixOperator:
+		parsers = []Parser{p, op.parser}
+	case infixOperator:
+		parsers = []Parser{p, op.parser, p}
+	}
+	ctx.tagged = false
+	return u.layoutChildren(parsers, t.Children, ctx)
+}
+
+// fixed returns the text that p always matches, if it does.
+func (u *unparser) fixed(p Parser, ctx unparseContext) ([]unparseItem, bool) {
+	switch pp := p.(type) {
+	case IndirectParser:
+		return u.fixed(**pp.parser, ctx)
+	case Matcher:
+		return []unparseItem{{text: pp.literal, spaced: ctx.skipping && pp.skips && !ctx.lexical}}, pp.literal != ""
+	case LiteralsParser:
+		if pp.words.Len() != 1 {
+			return nil, false
+		}
+		return []unparseItem{{text: pp.words.Word(0), spaced: ctx.skipping && !ctx.lexical}}, true
+	case TokenParser:
+		items, ok := u.fixed(pp.parser, ctx)
+		if ok && len(items) > 0 {
+			items[0].spaced = !ctx.lexical
+		}
+		return items, ok
+	case SequenceParser:
+		var items []unparseItem
+		for _, sub := range pp.subParsers {
+			fixed, ok := u.fixed(sub, ctx)
+			if !ok {
+				return nil, false
+			}
+			items = append(items, fixed...)
+		}
+		return items, true
+	case BetweenParser:
+		return u.fixed(Seq(pp.open, pp.parser, pp.close), ctx)
+	case OptionalParser, StarParser, NotParser, LookingAtParser:
+		return nil, true
+	case OmitParser:
+		return u.fixed(pp.parser, ctx)
+	case TaggedParser:
+		return u.fixed(pp.parser, ctx)
+	case CaseParser:
+		return u.fixed(pp.parser, ctx)
+	case SkipParser:
+		ctx.lexical = pp.lexical
+		ctx.skipping = !pp.lexical && (pp.skip != nil || ctx.skipping)
+		return u.fixed(pp.parser, ctx)
+	case IndentParser:
+		return []unparseItem{{indent: &pp}}, true
+	}
+	return nil, false
+}
+
+// hasTag reports whether t has the tag a parser would give it, unless an
+// enclosing parser has already checked it.
+func hasTag(t *Tree, tag string, ctx unparseContext) bool {
+	return ctx.tagged || t.Tag == tag
+}
+
+// matchesAll reports whether p matches all of text.
+func matchesAll(p Parser, text string, ctx unparseContext) bool {
+	input := []rune(text)
+	c := NewContext()
+	c.foldCase = ctx.foldCase
+	c.lexical = true
+	tree := p.Parse(input, 0, c)
+	return tree != nil && len(tree.Match) == len(input)
+}
@@ -0,0 +1,248 @@
+package speg
+
+import (
+	"github.com/shoenig/test"
+	"strings"
+	"testing"
+)
+
+// listGrammar matches lists of numbers like "[1, 2, 3]".
+func listGrammar() Parser {
+	return Between(
+		Token(Exactly("[")),
+		SepBy(Token(Digits()).Tagged("num"), Token(Exactly(","))),
+		Token(Exactly("]")),
+	).Tagged("list")
+}
+
+func TestUnparse(t *testing.T) {
+	swap := MustRewriteRule(`(sum $a ("+") $b)`, `(sum $b ("+") $a)`)
+	dropZero := MustRewriteRule(`(sum $a ("+") (num "0"))`, `$a`)
+	tests := []struct {
+		name     string
+		grammar  Parser
+		input    string
+		rewrite  func(c *Cursor, t *Tree) *Tree
+		expected string
+	}{
+		{
+			name:     "unchanged",
+			grammar:  configGrammar(),
+			input:    "a = 1\n\nb   =  2\n[s]\nc = 3",
+			rewrite:  func(c *Cursor, t *Tree) *Tree { return t },
+			expected: "a = 1\n\nb   =  2\n[s]\nc = 3",
+		},
+		{
+			name:    "replace leaf",
+			grammar: configGrammar(),
+			input:   "a = 1\n\nb   =  2\n[s]\nc = 3",
+			rewrite: func(c *Cursor, t *Tree) *Tree {
+				if t.Tag == "value" && t.Text() == "2" {
+					return &Tree{Tag: "value", Match: []rune("42")}
+				}
+				return t
+			},
+			expected: "a = 1\n\nb   =  42\n[s]\nc = 3",
+		},
+		{
+			name:    "delete",
+			grammar: listGrammar(),
+			input:   "[1,  2,  3]",
+			rewrite: func(c *Cursor, t *Tree) *Tree {
+				if t.Tag == "num" && t.Text() == "2" {
+					return nil
+				}
+				return t
+			},
+			expected: "[1, 3]",
+		},
+		{
+			name:    "insert",
+			grammar: listGrammar(),
+			input:   "[1,2]",
+			rewrite: func(c *Cursor, t *Tree) *Tree {
+				if t.Tag == "list" {
+					items := t.Children[0]
+					children := append(items.Children[:len(items.Children):len(items.Children)], &Tree{Tag: "num", Match: []rune("3")})
+					return Wrap("list", Wrap("", children...))
+				}
+				return t
+			},
+			expected: "[1,2, 3]",
+		},
+		{
+			name:     "rewrite rule",
+			grammar:  plusGrammar(),
+			input:    "(x+0) *  y + z",
+			rewrite:  func(c *Cursor, t *Tree) *Tree { return applyOnce(t, dropZero) },
+			expected: "(x) *  y + z",
+		},
+		{
+			name:     "new tree",
+			grammar:  plusGrammar(),
+			input:    "1+2",
+			rewrite:  func(c *Cursor, t *Tree) *Tree { return applyOnce(t, swap) },
+			expected: "2 + 1",
+		},
+		{
+			name:     "indented block",
+			grammar:  blockGrammar(),
+			input:    "if a:\n  b\n  if c:\n    d\n  e\nf\n",
+			rewrite:  rename("d", "x"),
+			expected: "if a:\n  b\n  if c:\n    x\n  e\nf\n",
+		},
+		{
+			name:     "indentation tokens",
+			grammar:  tokenGrammar(),
+			input:    "if a:\n  b\n  if c:\n    d\n\n  e\nf\n",
+			rewrite:  rename("d", "x"),
+			expected: "if a:\n  b\n  if c:\n    x\n\n  e\nf\n",
+		},
+		{
+			name:    "new indented line",
+			grammar: blockGrammar(),
+			input:   "if a:\n\tb\nc\n",
+			rewrite: func(c *Cursor, t *Tree) *Tree {
+				if t.Tag == "block" {
+					stmt := Wrap("", Wrap("", &Tree{Tag: "name", Match: []rune("x")}))
+					return Wrap("block", t.Children[0], Wrap("", stmt))
+				}
+				return t
+			},
+			expected: "if a:\n\tb\n\tx\nc\n",
+		},
+		{
+			name:    "new block",
+			grammar: tokenGrammar(),
+			input:   "if a:\n  b\nc\n",
+			rewrite: func(c *Cursor, t *Tree) *Tree {
+				if t.Tag == "block" {
+					added := tokenGrammar().Parse([]rune("if x:\n y\n"), 0, NewContext()).Children[0].Children[0]
+					return Wrap("block", append(t.Children[:len(t.Children):len(t.Children)], added)...)
+				}
+				return t
+			},
+			expected: "if a:\n  b\n  if x:\n    y\nc\n",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			input := []rune(tc.input)
+			original := tc.grammar.Parse(input, 0, NewContext())
+			test.NotNil(t, original)
+			edited := Rewrite(original, tc.rewrite)
+			got, err := NewUnparser(tc.grammar).Unparse(original, edited, input)
+			test.NoError(t, err)
+			test.Eq(t, tc.expected, got)
+
+			reparsed := tc.grammar.Parse([]rune(got), 0, NewContext())
+			test.NotNil(t, reparsed)
+			test.Eq(t, edited.String(), reparsed.String())
+		})
+	}
+}
+
+// rename returns a rewrite that renames the leaves tagged name from old to
+// name.
+func rename(old, name string) func(c *Cursor, t *Tree) *Tree {
+	return func(c *Cursor, t *Tree) *Tree {
+		if t.Tag == "name" && t.Text() == old {
+			return &Tree{Tag: "name", Match: []rune(name)}
+		}
+		return t
+	}
+}
+
+func applyOnce(t *Tree, rule RewriteRule) *Tree {
+	if result := rule.Apply(t); result != nil {
+		return result
+	}
+	return t
+}
+
+type unparseSetting struct {
+	Name  string `grammar:"'set' @"`
+	Value string `grammar:"'=' @string"`
+}
+
+func TestUnparseOmitted(t *testing.T) {
+	grammar, err := GrammarFor[unparseSetting]()
+	test.NoError(t, err)
+	input := []rune(`set  x = "a"`)
+	original := grammar.Parse(input, 0, NewContext())
+	test.NotNil(t, original)
+	u := NewUnparser(grammar)
+
+	edited := Rewrite(original, func(c *Cursor, t *Tree) *Tree {
+		if t.Tag == "Value" {
+			return &Tree{Tag: "Value", Match: []rune("b c")}
+		}
+		return t
+	})
+	got, err := u.Unparse(original, edited, input)
+	test.NoError(t, err)
+	test.Eq(t, `set  x = "b c"`, got)
+
+	// A tree from elsewhere keeps the text of the tree it replaces around
+	// its children, and the rest comes from the grammar.
+	other := grammar.Parse([]rune(`set y="q"`), 0, NewContext())
+	got, err = u.Unparse(original, other, input)
+	test.NoError(t, err)
+	test.Eq(t, `set  y = "q"`, got)
+}
+
+func TestUnparseSeparator(t *testing.T) {
+	input := []rune("a = 1")
+	grammar := configGrammar()
+	original := grammar.Parse(input, 0, NewContext())
+	added := grammar.Parse([]rune("b=2"), 0, NewContext()).Children[0].Children[0]
+	edited := Rewrite(original, func(c *Cursor, t *Tree) *Tree {
+		if t.Tag == "config" {
+			entries := t.Children[0]
+			return Wrap("config", Wrap("", entries.Children[0], added), t.Children[1])
+		}
+		return t
+	})
+	u := NewUnparser(grammar)
+	got, err := u.Unparse(original, edited, input)
+	test.NoError(t, err)
+	test.Eq(t, "a = 1 b = 2", got)
+
+	u.Separator = func(before, after string) string {
+		if strings.ContainsAny(before, "0123456789") {
+			return "\n"
+		}
+		return DefaultSeparator(before, after)
+	}
+	got, err = u.Unparse(original, edited, input)
+	test.NoError(t, err)
+	test.Eq(t, "a = 1\nb = 2", got)
+}
+
+func TestUnparseMismatch(t *testing.T) {
+	input := []rune("1 + 2")
+	original := plusGrammar().Parse(input, 0, NewContext())
+	edited := Rewrite(original, func(c *Cursor, t *Tree) *Tree {
+		if t.Tag == "num" && t.Text() == "2" {
+			return &Tree{Tag: "num", Match: []rune("two")}
+		}
+		return t
+	})
+	_, err := NewUnparser(plusGrammar()).Unparse(original, edited, input)
+	test.EqError(t, err, `unparse: (sum (num "1") ("+") (num "two")) doesn't fit the grammar`)
+}
+
+func TestDefaultSeparator(t *testing.T) {
+	tests := []struct {
+		before, after, expected string
+	}{
+		{"a", "b", " "},
+		{"(", "a", ""},
+		{"a", ")", ""},
+		{"a", ",", ""},
+		{",", "a", " "},
+	}
+	for _, tc := range tests {
+		test.Eq(t, tc.expected, DefaultSeparator(tc.before, tc.after))
+	}
+}
@@ -0,0 +1,77 @@
+package speg
+
+import "github.com/google/uuid"
+
+// A StateParser matches what its parser matches, and then consults or
+// updates the user state. Build one with Update or Guard.
+type StateParser struct {
+	id     ID
+	parser Parser
+	f      func(ctx *Context, tree *Tree) bool
+}
+
+// Update returns a parser that matches what p matches and then calls update
+// with the result, which may change the user state with ctx.SetValue. The
+// change is undone if the match is later backtracked over. For example, to
+// remember the names declared by C typedefs:
+//
+//	typedef := Seq(Keyword("typedef"), typeSpec, Update(identifier, func(ctx *Context, t *Tree) {
+//		ctx.SetValue(typedefName(string(t.Match)), true)
+//	}))
+func Update(p Parser, update func(ctx *Context, tree *Tree)) StateParser {
+	return StateParser{
+		id:     uuid.New(),
+		parser: p,
+		f: func(ctx *Context, tree *Tree) bool {
+			update(ctx, tree)
+			return true
+		},
+	}
+}
+
+// Guard returns a parser that matches what p matches, provided accept, given
+// the result and a context from which the user state can be read, returns
+// true:
+//
+//	typeName := Guard(identifier, func(ctx *Context, t *Tree) bool {
+//		return ctx.Value(typedefName(string(t.Match))) != nil
+//	})
+//
+// Accept may also change the user state; the change is undone if it returns
+// false.
+func Guard(p Parser, accept func(ctx *Context, tree *Tree) bool) StateParser {
+	return StateParser{
+		id:     uuid.New(),
+		parser: p,
+		f:      accept,
+	}
+}
+
+func (p StateParser) Parse(input []rune, start int, ctx *Context) *Tree {
+	cached, ok := ctx.getCachedValue(p.id, start)
+	if ok {
+		return cached
+	}
+	tree := ctx.parse(p.parser, input, start)
+	if tree != nil && !p.f(ctx, tree) {
+		tree = nil
+	}
+	ctx.setCachedValue(p.id, start, tree)
+	return tree
+}
+
+func (p StateParser) ID() uuid.UUID {
+	return p.id
+}
+
+func (p StateParser) Omit() Parser {
+	return Omit(p)
+}
+
+func (p StateParser) Star() Parser {
+	return Star(p)
+}
+
+func (p StateParser) Tagged(tag string) TaggedParser {
+	return Tagged(p, tag)
+}
@@ -0,0 +1,131 @@
+package speg
+
+import (
+	"github.com/shoenig/test"
+	"testing"
+)
+
+type typedefName string
+
+// cGrammar returns a grammar for a tiny subset of C in which "T * x;" is a
+// declaration if T was declared by typedef, and a multiplication otherwise.
+func cGrammar() Parser {
+	ident := Token(Identifier("typedef", "int"))
+	semi := Token(Exactly(";")).Omit()
+	star := Token(Exactly("*")).Omit()
+	typedef := Seq(Keyword("typedef").Omit(), Token(Keyword("int")).Omit(), Update(ident, func(ctx *Context, t *Tree) {
+		ctx.SetValue(typedefName(t.Children[0].Match), true)
+	}), semi).Tagged("typedef")
+	typeName := Guard(ident, func(ctx *Context, t *Tree) bool {
+		return ctx.Value(typedefName(t.Children[0].Match)) != nil
+	})
+	decl := Seq(typeName, star, ident, semi).Tagged("decl")
+	mult := Seq(ident, star, ident, semi).Tagged("mult")
+	return Seq(Star(Token(Or(typedef, decl, mult))), Token(Not(Any())).Omit())
+}
+
+func TestUpdate(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"multiplication", "a * b;", `((((mult "a * b;"))))`},
+		{"declaration", "typedef int a; a * b;", `((((typedef "typedef int a;")) ((decl "a * b;"))))`},
+		{"other name", "typedef int t; a * b;", `((((typedef "typedef int t;")) ((mult "a * b;"))))`},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			test.Eq(t, tc.expected, cGrammar().Parse([]rune(tc.input), 0, NewContext()).String())
+		})
+	}
+}
+
+type counterKey struct{}
+
+func TestUpdateBacktracking(t *testing.T) {
+	count := func(ctx *Context) int {
+		n, _ := ctx.Value(counterKey{}).(int)
+		return n
+	}
+	inc := Update(Exactly("x"), func(ctx *Context, _ *Tree) {
+		ctx.SetValue(counterKey{}, count(ctx)+1)
+	})
+	twice := Guard(Exactly(""), func(ctx *Context, _ *Tree) bool {
+		return count(ctx) == 2
+	})
+
+	// The first alternative increments the counter three times and then
+	// fails, so its changes are undone before the second is tried.
+	p := Or(Seq(inc, inc, inc, Exactly("!")), Seq(inc, inc, twice))
+	ctx := NewContext()
+	test.NotNil(t, p.Parse([]rune("xxx"), 0, ctx))
+	test.Eq(t, 2, count(ctx))
+
+	// A parser that reads the state is parsed again when it's reached in a
+	// different state, rather than taken from the cache.
+	ctx = NewContext()
+	test.Nil(t, twice.Parse([]rune("x"), 0, ctx))
+	ctx.SetValue(counterKey{}, 2)
+	test.NotNil(t, twice.Parse([]rune("x"), 0, ctx))
+}
+
+func TestUpdateCachedState(t *testing.T) {
+	inc := Update(Exactly("x"), func(ctx *Context, _ *Tree) {
+		n, _ := ctx.Value(counterKey{}).(int)
+		ctx.SetValue(counterKey{}, n+1)
+	})
+	p := Or(Seq(inc, Exactly("!")), Seq(inc, Exactly("?")))
+	ctx := NewContext()
+	test.NotNil(t, p.Parse([]rune("x?"), 0, ctx))
+	// The second use of inc comes from the cache, along with the state
+	// change it made.
+	test.Eq(t, 1, ctx.Value(counterKey{}))
+}
+
+func TestMemoReentrant(t *testing.T) {
+	// A parser running twice at the same position, in different states,
+	// files each result under the state it started in.
+	ctx := NewContext()
+	id := Exactly("x").ID()
+	outer := &Tree{Match: []rune("outer")}
+	inner := &Tree{Match: []rune("inner")}
+	_, ok := ctx.getCachedValue(id, 0)
+	test.False(t, ok)
+	ctx.SetValue(counterKey{}, 1)
+	_, ok = ctx.getCachedValue(id, 0)
+	test.False(t, ok)
+	ctx.SetValue(counterKey{}, 2)
+	ctx.setCachedValue(id, 0, inner)
+	ctx.setCachedValue(id, 0, outer)
+
+	ctx.reset(nil)
+	got, ok := ctx.getCachedValue(id, 0)
+	test.True(t, ok)
+	test.Eq(t, outer, got)
+	test.Eq(t, 2, ctx.Value(counterKey{}))
+}
+
+func TestStateInterned(t *testing.T) {
+	calls := 0
+	p := Guard(Exactly("x"), func(ctx *Context, _ *Tree) bool {
+		calls++
+		return true
+	})
+	ctx := NewContext()
+	ctx.SetValue(counterKey{}, 1)
+	one := ctx.mark()
+	test.NotNil(t, p.Parse([]rune("x"), 0, ctx))
+
+	// Getting back to an equal state gets back the same state, and the
+	// results cached in it.
+	ctx.SetValue(counterKey{}, 2)
+	ctx.SetValue(counterKey{}, 1)
+	test.True(t, one == ctx.mark())
+	test.NotNil(t, p.Parse([]rune("x"), 0, ctx))
+	test.Eq(t, 1, calls)
+
+	ctx.reset(nil)
+	ctx.SetValue(counterKey{}, 1)
+	test.True(t, one == ctx.mark())
+}
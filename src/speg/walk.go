@@ -0,0 +1,193 @@
+package speg
+
+import (
+	"iter"
+	"sparse/src/internal/traverse"
+)
+
+// A Cursor describes a tree during a traversal by Walk, Preorder, Postorder
+// or Rewrite: Tree, Parent, Path and Index tell where it is, and
+// SkipChildren, in a Preorder loop, skips its children. It is only valid
+// until the traversal moves on.
+type Cursor = traverse.Cursor[*Tree]
+
+// An Action tells Walk how to go on after visiting a tree.
+type Action = traverse.Action
+
+const (
+	// Continue goes on to the children of the tree, and then the rest.
+	Continue = traverse.Continue
+	// SkipChildren goes on without visiting the children of the tree.
+	SkipChildren = traverse.SkipChildren
+	// Stop ends the traversal.
+	Stop = traverse.Stop
+)
+
+func children(t *Tree) []*Tree {
+	return t.Children
+}
+
+// Walk visits t and its descendants among the Children, depth first. It
+// calls pre, if it isn't nil, before visiting the children of each tree, and
+// post, if it isn't nil, after. Post is called even if pre skipped the
+// children. It returns false if pre or post returned Stop.
+func Walk(t *Tree, pre, post func(c *Cursor) Action) bool {
+	return traverse.Walk(t, children, pre, post)
+}
+
+// Preorder returns an iterator over t and its descendants, each before its
+// children:
+//
+//	for c, tree := range t.Preorder() {
+//		if tree.Tag == "string" {
+//			c.SkipChildren()
+//		}
+//		...
+//	}
+func (t *Tree) Preorder() iter.Seq2[*Cursor, *Tree] {
+	return traverse.Preorder(t, children)
+}
+
+// Postorder returns an iterator over t and its descendants, each after its
+// children.
+func (t *Tree) Postorder() iter.Seq2[*Cursor, *Tree] {
+	return traverse.Postorder(t, children)
+}
+
+// Rewrite returns t rebuilt from the bottom up by f. For each tree, f gets a
+// cursor at the original tree, and the tree with its children already
+// rewritten, and returns its replacement: the tree itself, a new tree, say
+// one made with Wrap, or nil to delete it.
+//
+// Trees whose children changed are copied, so t isn't modified. The Match
+// of a copy is fitted to its new children, provided they match the same
+// input as t, in order: it is extended to cover new children, and shrinks
+// when a child at either end is deleted, along with the Leading or Trailing
+// trivia at that end. Otherwise, as when a child was built by a RewriteRule,
+// its Match is made from theirs, as with Wrap. Its Nodes are dropped, since
+// they no longer agree with its Children.
+func Rewrite(t *Tree, f func(c *Cursor, t *Tree) *Tree) *Tree {
+	return traverse.Rewrite(t, children, rebuild, f)
+}
+
+func rebuild(t *Tree, children []*Tree) *Tree {
+	result := *t
+	result.Children = children
+	result.Nodes = nil
+	if !inOrder(children) || !sameInput(append([]*Tree{t}, children...)) {
+		result.join()
+		return &result
+	}
+	result.Match = traverse.Fit(t.Match, matchesOf(t.Children), matchesOf(children))
+	for _, ref := range append([]*Tree{t}, children...) {
+		if _, ok := traverse.Cover(result.Match, ref.Match); ok && len(ref.Match) > 0 {
+			result.Start = ref.Start + cap(ref.Match) - cap(result.Match)
+			break
+		}
+	}
+	if result.Start != t.Start {
+		result.Leading = nil
+	}
+	if result.Start+len(result.Match) != t.Start+len(t.Match) {
+		result.Trailing = nil
+	}
+	return &result
+}
+
+func matchesOf(trees []*Tree) [][]rune {
+	result := make([][]rune, len(trees))
+	for k, t := range trees {
+		result[k] = t.Match
+	}
+	return result
+}
+
+// cover extends the Match of t to cover that of other, if they match the
+// same input.
+func (t *Tree) cover(other *Tree) {
+	match, ok := traverse.Cover(t.Match, other.Match)
+	if !ok {
+		return
+	}
+	t.Start -= cap(match) - cap(t.Match)
+	t.Match = match
+}
+
+// sameInput reports whether trees match the same input. Empty trees, which
+// could be anywhere, are left out.
+func sameInput(trees []*Tree) bool {
+	var first *Tree
+	for _, t := range trees {
+		if len(t.Match) == 0 {
+			continue
+		}
+		if first == nil {
+			first = t
+		} else if _, ok := traverse.Cover(first.Match, t.Match); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// inOrder reports whether trees match the same input, each after the one
+// before.
+func inOrder(trees []*Tree) bool {
+	if !sameInput(trees) {
+		return false
+	}
+	end := -1
+	for _, t := range trees {
+		if len(t.Match) == 0 {
+			continue
+		}
+		if t.Start < end {
+			return false
+		}
+		end = t.Start + len(t.Match)
+	}
+	return true
+}
+
+// join gives t a Match of its own, for children that aren't in order in the
+// same input: the Match of each child in turn, with a space before each but
+// the first that has no Leading trivia. The Leading trivia of the first child
+// and the Trailing trivia of the last are those of t.
+func (t *Tree) join() {
+	var match []rune
+	for k, child := range t.Children {
+		if k > 0 && len(child.Leading) == 0 {
+			match = append(match, ' ')
+		}
+		match = append(match, child.Match...)
+	}
+	t.Match, t.Leading, t.Trailing = match, nil, nil
+	if n := len(t.Children); n > 0 {
+		if leading := len(t.Children[0].Leading); leading > 0 {
+			t.Leading = match[:leading]
+		}
+		if trailing := len(t.Children[n-1].Trailing); trailing > 0 {
+			t.Trailing = match[len(match)-trailing:]
+		}
+	}
+}
+
+// Wrap returns a tree tagged tag with the given children, whose Match covers
+// theirs, provided they match the same input, in order. Otherwise its Match
+// is made from theirs: see RewriteRule.
+func Wrap(tag string, children ...*Tree) *Tree {
+	result := &Tree{Tag: tag, Children: children}
+	if !inOrder(children) {
+		result.Start = children[0].Start
+		result.join()
+		return result
+	}
+	for k, child := range children {
+		if k == 0 {
+			result.Start, result.Match = child.Start, child.Match
+			continue
+		}
+		result.cover(child)
+	}
+	return result
+}
@@ -0,0 +1,194 @@
+package speg
+
+import (
+	"github.com/shoenig/test"
+	"strings"
+	"testing"
+)
+
+// sumGrammar matches sums like "1 + (2 + 3)".
+func sumGrammar() Parser {
+	var sum Parser
+	term := Or(Token(Digits()).Tagged("num"), Between(Token(Exactly("(")), Indirect(&sum), Token(Exactly(")"))).Tagged("group"))
+	sum = Seq(term, Star(Seq(Token(Exactly("+")).Omit(), term))).Tagged("sum")
+	return sum
+}
+
+func parseSum(t *testing.T, input string) *Tree {
+	tree := sumGrammar().Parse([]rune(input), 0, NewContext())
+	test.NotNil(t, tree)
+	return tree
+}
+
+func TestWalk(t *testing.T) {
+	tree := parseSum(t, "1 + (2 + 3) + 4")
+	var events []string
+	Walk(tree, func(c *Cursor) Action {
+		if c.Tree().Tag != "" {
+			events = append(events, "<"+c.Tree().Tag)
+		}
+		if c.Tree().Tag == "group" {
+			return SkipChildren
+		}
+		return Continue
+	}, func(c *Cursor) Action {
+		if c.Tree().Tag != "" {
+			events = append(events, c.Tree().Tag+">")
+		}
+		return Continue
+	})
+	test.Eq(t, []string{"<sum", "<num", "num>", "<group", "group>", "<num", "num>", "sum>"}, events)
+
+	// Stop ends the walk.
+	var count int
+	complete := Walk(tree, func(c *Cursor) Action {
+		count++
+		if c.Tree().Tag == "group" {
+			return Stop
+		}
+		return Continue
+	}, nil)
+	test.False(t, complete)
+	test.Eq(t, 6, count)
+}
+
+func TestPreorder(t *testing.T) {
+	tree := parseSum(t, "1 + (2 + 3)")
+	var nums []string
+	for c, n := range tree.Preorder() {
+		if n.Tag != "num" {
+			continue
+		}
+		// The path holds the ancestors, so nesting is easy to tell.
+		depth := 0
+		for _, a := range c.Path() {
+			if a.Tag == "group" {
+				depth++
+			}
+		}
+		test.Eq(t, c.Path()[len(c.Path())-1], c.Parent())
+		nums = append(nums, strings.Repeat("(", depth)+n.Text())
+	}
+	test.Eq(t, []string{"1", "(2", "(3"}, nums)
+
+	// SkipChildren and break work in range loops.
+	var tags []string
+	for c, n := range tree.Preorder() {
+		if n.Tag == "group" {
+			c.SkipChildren()
+		}
+		if n.Tag != "" {
+			tags = append(tags, n.Tag)
+		}
+	}
+	test.Eq(t, []string{"sum", "num", "group"}, tags)
+	var first *Tree
+	for _, n := range tree.Preorder() {
+		if n.Tag == "num" {
+			first = n
+			break
+		}
+	}
+	test.Eq(t, "1", first.Text())
+}
+
+func TestPostorder(t *testing.T) {
+	tree := parseSum(t, "1 + (2 + 3)")
+	var tags []string
+	for c, n := range tree.Postorder() {
+		if n.Tag != "" {
+			tags = append(tags, n.Tag)
+		}
+		if n == tree {
+			test.Eq(t, -1, c.Index())
+			test.Eq(t, 0, c.Depth())
+			test.Nil(t, c.Parent())
+		}
+	}
+	test.Eq(t, []string{"num", "num", "num", "sum", "group", "sum"}, tags)
+}
+
+func TestRewrite(t *testing.T) {
+	input := "1 + (2 + 3) + 4"
+	tree := parseSum(t, input)
+	original := tree.String()
+
+	// Replace groups with the sums inside them.
+	flat := Rewrite(tree, func(c *Cursor, t *Tree) *Tree {
+		if t.Tag == "group" {
+			return t.Children[0]
+		}
+		return t
+	})
+	test.Eq(t, `(sum (num "1") (((sum (num "2") (((num "3"))))) ((num "4"))))`, flat.String())
+	test.Eq(t, original, tree.String())
+
+	// Delete the terms after the first, so the sum shrinks to it.
+	first := Rewrite(tree, func(c *Cursor, t *Tree) *Tree {
+		if c.Depth() == 1 && c.Index() > 0 {
+			return nil
+		}
+		return t
+	})
+	test.Eq(t, `(sum (num "1"))`, first.String())
+	test.Eq(t, "1", first.Text())
+	test.Eq(t, 0, first.Start)
+
+	// Deleting the last term but one leaves the text between the others.
+	middle := Rewrite(tree, func(c *Cursor, t *Tree) *Tree {
+		if t.Tag == "group" {
+			return nil
+		}
+		return t
+	})
+	test.Eq(t, `(sum (num "1") (" +" ((num "4"))))`, middle.String())
+	test.Eq(t, input, middle.Text())
+
+	// Wrap each number, and the span of a wrapper covers its children.
+	wrapped := Rewrite(tree, func(c *Cursor, t *Tree) *Tree {
+		if t.Tag == "num" && t.Text() != "1" {
+			return Wrap("neg", t)
+		}
+		return t
+	})
+	test.Eq(t, `(sum (num "1") (((group (sum (neg (num "2")) (((neg (num "3"))))))) ((neg (num "4")))))`, wrapped.String())
+	w := Wrap("pair", tree.Children[0], wrapped.Children[1].Children[0])
+	test.Eq(t, 0, w.Start)
+	test.Eq(t, "1 + (2 + 3)", string(w.Match))
+
+	// Out of order, the span of a wrapper is made from its children.
+	w = Wrap("pair", tree.Children[1].Children[1].Children[0], tree.Children[0])
+	test.Eq(t, `(pair (num "4") (num "1"))`, w.String())
+	test.Eq(t, "4 1", w.Text())
+}
+
+func TestRewriteDelete(t *testing.T) {
+	tree := parseSum(t, "1 + (2 + 3) + 4")
+	group := tree.Children[1].Children[0].Children[0]
+	sum := group.Children[0]
+	tests := []struct {
+		name     string
+		tree     *Tree
+		delete   string
+		expected string
+		text     string
+		start    int
+	}{
+		{"last", Wrap("pair", tree.Children[0], sum), "sum", `(pair (num "1"))`, "1", 0},
+		{"first", Wrap("pair", tree.Children[0], sum), "num", `(pair (sum (num "2") (((num "3")))))`, "2 + 3", 5},
+		{"inside delimiters", group, "sum", `(group " (2 + 3)")`, " (2 + 3)", 3},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			result := Rewrite(tc.tree, func(c *Cursor, t *Tree) *Tree {
+				if c.Depth() == 1 && t.Tag == tc.delete {
+					return nil
+				}
+				return t
+			})
+			test.Eq(t, tc.expected, result.String())
+			test.Eq(t, tc.text, result.Text())
+			test.Eq(t, tc.start, result.Start)
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package speg
+
+import (
+	"errors"
+	"github.com/google/uuid"
+)
+
+// A PredicateParser matches what its parser matches, provided a function of
+// the result accepts it. Build one with Where or Check.
+type PredicateParser struct {
+	id       ID
+	parser   Parser
+	check    func(tree *Tree) error
+	expected string
+}
+
+// errRejected is returned by the check function of a Where parser.
+var errRejected = errors.New("rejected")
+
+// Where returns a parser that matches what p matches, provided accept returns
+// true for the result. It fails otherwise, as if p had failed:
+//
+//	small := Where(Digits(), func(t *Tree) bool { return len(t.Match) <= 3 })
+//
+// Use Expecting to describe what Where accepts in error messages.
+func Where(p Parser, accept func(tree *Tree) bool) PredicateParser {
+	return PredicateParser{
+		id:     uuid.New(),
+		parser: p,
+		check: func(tree *Tree) error {
+			if !accept(tree) {
+				return errRejected
+			}
+			return nil
+		},
+	}
+}
+
+// Check is like Where, but check returns an error to reject the result. The
+// error is reported, at the start of the rejected match, by Context.Error:
+//
+//	int32 := Check(Digits(), func(t *Tree) error {
+//		_, err := strconv.ParseInt(string(t.Match), 10, 32)
+//		return err
+//	})
+func Check(p Parser, check func(tree *Tree) error) PredicateParser {
+	return PredicateParser{
+		id:     uuid.New(),
+		parser: p,
+		check:  check,
+	}
+}
+
+// Expecting returns a copy of p that is described as expected when its
+// predicate rejects a match, instead of any error returned by the function
+// given to Check.
+func (p PredicateParser) Expecting(expected string) PredicateParser {
+	p.id = uuid.New()
+	p.expected = expected
+	return p
+}
+
+func (p PredicateParser) Parse(input []rune, start int, ctx *Context) *Tree {
+	key := exitKey{ctx.memoKey(ctx.mark()), site{p.id, start}}
+	cached, ok := ctx.getCachedValue(p.id, start)
+	if ok {
+		if cached == nil {
+			// The failure may have been recorded quietly, or not at all,
+			// the first time, so it's recorded again.
+			if record, rejected := ctx.memo.failures[key]; rejected {
+				record(ctx)
+			} else {
+				ctx.parse(p.parser, input, start)
+			}
+		}
+		return cached
+	}
+	tree := ctx.parse(p.parser, input, start)
+	if tree != nil {
+		if err := p.check(tree); err != nil {
+			record := func(ctx *Context) {
+				switch {
+				case p.expected != "":
+					ctx.expect(start, p.expected)
+				case err != errRejected:
+					ctx.reject(start, err)
+				default:
+					ctx.failAt(start)
+				}
+			}
+			record(ctx)
+			ctx.memo.failures[key] = record
+			tree = nil
+		}
+	}
+	ctx.setCachedValue(p.id, start, tree)
+	return tree
+}
+
+func (p PredicateParser) ID() uuid.UUID {
+	return p.id
+}
+
+func (p PredicateParser) Omit() Parser {
+	return Omit(p)
+}
+
+func (p PredicateParser) Star() Parser {
+	return Star(p)
+}
+
+func (p PredicateParser) Tagged(tag string) TaggedParser {
+	return Tagged(p, tag)
+}
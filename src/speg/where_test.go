@@ -0,0 +1,115 @@
+package speg
+
+import (
+	"errors"
+	"fmt"
+	"github.com/shoenig/test"
+	"strconv"
+	"testing"
+)
+
+func TestWhere(t *testing.T) {
+	small := Where(Digits(), func(t *Tree) bool { return len(t.Match) <= 3 })
+	tests := []struct {
+		name     string
+		parser   Parser
+		input    string
+		expected string
+	}{
+		{"accepted", small, "123", `"123"`},
+		{"rejected", small, "1234", `<nil>`},
+		{"inner fails", small, "x", `<nil>`},
+		{"alternative", Or(small, Letters()), "abc", `"abc"`},
+		{"tag", Where(Letters(), func(t *Tree) bool { return string(t.Match) != "if" }).Tagged("id"), "x", `(id "x")`},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			test.Eq(t, tc.expected, tc.parser.Parse([]rune(tc.input), 0, NewContext()).String())
+		})
+	}
+}
+
+var errMismatchedTag = errors.New("mismatched tag")
+
+func TestCheck(t *testing.T) {
+	i32 := Check(Digits(), func(t *Tree) error {
+		_, err := strconv.ParseInt(string(t.Match), 10, 32)
+		return err
+	})
+	ctx := NewContext()
+	test.Eq(t, `"2147483647"`, i32.Parse([]rune("2147483647"), 0, ctx).String())
+	test.Nil(t, Seq(Exactly("x="), i32).Parse([]rune("x=2147483648"), 0, ctx))
+	err := ctx.Error()
+	test.EqError(t, err, `parse error at 2: strconv.ParseInt: parsing "2147483648": value out of range`)
+	test.ErrorIs(t, err, strconv.ErrRange)
+
+	name := Letters().Tagged("name")
+	element := Check(Seq(Exactly("<"), name, Exactly(">"), Letters(), Exactly("</"), name, Exactly(">")), func(t *Tree) error {
+		if open, close := string(t.Children[1].Match), string(t.Children[5].Match); open != close {
+			return fmt.Errorf("%w: <%s> closed by </%s>", errMismatchedTag, open, close)
+		}
+		return nil
+	})
+	test.NotNil(t, element.Parse([]rune("<b>bold</b>"), 0, NewContext()))
+	ctx = NewContext()
+	test.Nil(t, element.Parse([]rune("<b>bold</i>"), 0, ctx))
+	test.EqError(t, ctx.Error(), `parse error at 0: mismatched tag: <b> closed by </i>`)
+	test.ErrorIs(t, ctx.Error(), errMismatchedTag)
+}
+
+func TestCheckFarthestFailure(t *testing.T) {
+	octet := Check(Digits(), func(t *Tree) error {
+		_, err := strconv.ParseUint(string(t.Match), 10, 8)
+		if err != nil {
+			return errors.New("byte out of range")
+		}
+		return nil
+	})
+	ip := Seq(octet, Exactly("."), octet, Exactly("."), octet, Exactly("."), octet)
+
+	// The error from the last octet is farther than anything else.
+	ctx := NewContext()
+	test.Nil(t, ip.Parse([]rune("10.0.0.256"), 0, ctx))
+	test.EqError(t, ctx.Error(), `parse error at 7: byte out of range`)
+
+	// A failure past the rejected match takes precedence.
+	ctx = NewContext()
+	test.Nil(t, Or(octet, Seq(Digits(), Exactly("!"))).Parse([]rune("300"), 0, ctx))
+	test.EqError(t, ctx.Error(), `parse error at 3: expected "!"`)
+
+	// With Expecting, a rejection is reported as an expectation alongside
+	// others at the same position.
+	ctx = NewContext()
+	test.Nil(t, Or(octet.Expecting("byte"), Letters()).Parse([]rune("300"), 0, ctx))
+	test.EqError(t, ctx.Error(), `parse error at 0: expected byte or letters`)
+}
+
+func TestWhereCachedFailure(t *testing.T) {
+	small := Where(Digits(), func(t *Tree) bool { return len(t.Match) <= 3 })
+	described := small.Expecting("small number")
+	byteValue := Check(Digits(), func(t *Tree) error {
+		if _, err := strconv.ParseUint(string(t.Match), 10, 8); err != nil {
+			return errors.New("byte out of range")
+		}
+		return nil
+	})
+	tests := []struct {
+		name     string
+		parser   Parser
+		input    string
+		expected string
+	}{
+		{"plain rejection", small, "1234", `parse error at 0`},
+		{"rejection after Not", Seq(Not(Seq(small, Exactly("!"))), small), "1234", `parse error at 0`},
+		{"check after LookingAt", Seq(Not(LookingAt(byteValue)), byteValue), "300", `parse error at 0: byte out of range`},
+		{"expectation after Not", Seq(Not(described), described), "1234", `parse error at 0: expected small number`},
+		{"inner failure after Not", Seq(Not(Seq(small, Exactly("!"))), small), "x", `parse error at 0: expected digits`},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := NewContext()
+			test.Nil(t, tc.parser.Parse([]rune(tc.input), 0, ctx))
+			test.EqError(t, ctx.Error(), tc.expected)
+		})
+	}
+}
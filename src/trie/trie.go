@@ -0,0 +1,158 @@
+// Package trie implements a set of words that can be matched against
+// prefixes of []rune input in a single pass, for use by the keyword and
+// literal matchers in sparse and speg.
+package trie
+
+import "unicode"
+
+// A Trie is a set of words. Each word is identified by its index, the
+// order in which it was first added.
+type Trie struct {
+	root  node
+	words []string
+	fold  bool
+}
+
+type node struct {
+	children map[rune]*node
+	// word is the index of the word that ends here, or -1.
+	word int
+}
+
+// A Match is a word found at the start of some input.
+type Match struct {
+	// Length is the length of the word, in runes.
+	Length int
+	// Word is the index of the word.
+	Word int
+}
+
+// New returns a Trie containing words.
+func New(words ...string) *Trie {
+	t := &Trie{root: node{word: -1}}
+	for _, w := range words {
+		t.Add(w)
+	}
+	return t
+}
+
+// NewFolded returns a Trie containing words that matches without regard to
+// case, using Unicode simple case folding, so "Σίσυφος" matches "ΣΊΣΥΦΟΣ".
+// Simple folding maps each rune to a single rune, so "straße" does not match
+// "STRASSE". Words that differ only in case are the same word.
+func NewFolded(words ...string) *Trie {
+	t := &Trie{root: node{word: -1}, fold: true}
+	for _, w := range words {
+		t.Add(w)
+	}
+	return t
+}
+
+// key returns the rune under which r is stored.
+func (t *Trie) key(r rune) rune {
+	if t.fold {
+		return Fold(r)
+	}
+	return r
+}
+
+// Fold returns the smallest rune that is equivalent to r under Unicode
+// simple case folding. Two runes are equal ignoring case if they have the
+// same Fold.
+func Fold(r rune) rune {
+	least := r
+	for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+		least = min(least, f)
+	}
+	return least
+}
+
+// Folded reports whether t ignores case.
+func (t *Trie) Folded() bool {
+	return t.fold
+}
+
+// Add adds word to t, if it's not already there, and returns its index.
+func (t *Trie) Add(word string) int {
+	n := &t.root
+	for _, r := range word {
+		r = t.key(r)
+		child, ok := n.children[r]
+		if !ok {
+			if n.children == nil {
+				n.children = make(map[rune]*node)
+			}
+			child = &node{word: -1}
+			n.children[r] = child
+		}
+		n = child
+	}
+	if n.word < 0 {
+		n.word = len(t.words)
+		t.words = append(t.words, word)
+	}
+	return n.word
+}
+
+// Words returns the words in t, in order of their indexes.
+func (t *Trie) Words() []string {
+	return append([]string(nil), t.words...)
+}
+
+// Len returns the number of words in t.
+func (t *Trie) Len() int {
+	return len(t.words)
+}
+
+// Word returns the word with index k.
+func (t *Trie) Word(k int) string {
+	return t.words[k]
+}
+
+// Contains reports whether word, in its entirety, is in t.
+func (t *Trie) Contains(word []rune) bool {
+	n := &t.root
+	for _, r := range word {
+		n = n.children[t.key(r)]
+		if n == nil {
+			return false
+		}
+	}
+	return n.word >= 0
+}
+
+// Longest returns the longest word in t that is a prefix of input. If there
+// is none, ok is false.
+func (t *Trie) Longest(input []rune) (m Match, ok bool) {
+	m = Match{Word: -1}
+	t.walk(input, func(match Match) {
+		m = match
+	})
+	return m, m.Word >= 0
+}
+
+// Prefixes returns every word in t that is a prefix of input, shortest first.
+func (t *Trie) Prefixes(input []rune) []Match {
+	var result []Match
+	t.walk(input, func(match Match) {
+		result = append(result, match)
+	})
+	return result
+}
+
+// walk calls visit for each word in t that is a prefix of input, shortest first.
+func (t *Trie) walk(input []rune, visit func(Match)) {
+	n := &t.root
+	if n.word >= 0 {
+		visit(Match{Length: 0, Word: n.word})
+	}
+	for k, r := range input {
+		n = n.children[t.key(r)]
+		if n == nil {
+			return
+		}
+		if n.word >= 0 {
+			visit(Match{Length: k + 1, Word: n.word})
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package trie
+
+import (
+	"github.com/shoenig/test"
+	"testing"
+)
+
+func TestTrie(t *testing.T) {
+	tr := New("in", "int", "interface", "if", "in")
+	test.Eq(t, 4, tr.Len())
+	test.Eq(t, []string{"in", "int", "interface", "if"}, tr.Words())
+	test.True(t, tr.Contains([]rune("int")))
+	test.False(t, tr.Contains([]rune("inter")))
+	test.False(t, tr.Contains([]rune("")))
+
+	m, ok := tr.Longest([]rune("interfaces"))
+	test.True(t, ok)
+	test.Eq(t, Match{Length: 9, Word: 2}, m)
+
+	m, ok = tr.Longest([]rune("inter"))
+	test.True(t, ok)
+	test.Eq(t, Match{Length: 3, Word: 1}, m)
+
+	_, ok = tr.Longest([]rune("x"))
+	test.False(t, ok)
+
+	test.Eq(t, []Match{{2, 0}, {3, 1}}, tr.Prefixes([]rune("integer")))
+	test.Nil(t, tr.Prefixes([]rune("for")))
+}
+
+func TestEmptyWord(t *testing.T) {
+	tr := New("", "a")
+	test.Eq(t, []Match{{0, 0}, {1, 1}}, tr.Prefixes([]rune("ab")))
+	test.True(t, tr.Contains(nil))
+}
+
+func TestFolded(t *testing.T) {
+	tr := NewFolded("select", "SELECT", "Σίσυφος", "K")
+	test.Eq(t, 3, tr.Len())
+	test.True(t, tr.Contains([]rune("SeLeCt")))
+	test.True(t, tr.Contains([]rune("ΣΊΣΥΦΟΣ")))
+	test.True(t, tr.Contains([]rune("K"))) // Kelvin sign
+	test.False(t, tr.Contains([]rune("STRASSE")))
+	m, ok := tr.Longest([]rune("SELECT *"))
+	test.True(t, ok)
+	test.Eq(t, Match{Length: 6, Word: 0}, m)
+}
+
+func TestFold(t *testing.T) {
+	test.Eq(t, Fold('k'), Fold('K'))
+	test.Eq(t, Fold('k'), Fold('K'))
+	test.Eq(t, Fold('ς'), Fold('Σ'))
+	test.NotEq(t, Fold('a'), Fold('b'))
+	test.Eq(t, '1', Fold('1'))
+}